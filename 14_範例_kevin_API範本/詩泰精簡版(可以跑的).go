@@ -1,27 +1,61 @@
 package main
 
+// 環控每秒紀錄查詢範本(精簡版)
+// 正式的環控 API 已併入考勤 API 的 /env/readings(支援 sensor、metric、location 篩選與欄位選擇),
+// 此範本只保留最基本的 from、to、limit 查詢,錯誤格式與正式 API 相同: {"status":400,"error":"錯誤訊息"}
+
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"gopkg.in/mgo.v2/bson"
 )
 
+const (
+	mongoURI       = `mongodb://localhost:27017`
+	dbName         = `Leapsy-Environmental-Control-Database`
+	collectionName = `second-records`
+
+	defaultRangeHours = 24    // 未指定 from 時,往前查詢的小時數
+	maxRangeDays      = 31    // 查詢區間上限(天)
+	defaultLimit      = 1000  // 預設筆數
+	maxLimit          = 10000 // 筆數上限
+)
+
+// mongoClientPointer 共用的 MongoDB 連線(啟動時建立一次,不在每個請求重新連線)
+var mongoClientPointer *mongo.Client
+
 type Data struct {
 	Time  time.Time `json:"time"`
 	Score int       `json:"score"`
 }
 
 func main() {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var err error
+	mongoClientPointer, err = mongo.Connect(ctx, options.Client().ApplyURI(mongoURI)) // 連接預設主機
+	if err != nil {
+		log.Fatal("連接 MongoDB Server 發生問題: ", err)
+	}
+
+	if err = mongoClientPointer.Ping(ctx, nil); err != nil {
+		log.Fatal("連接 MongoDB Server 發生問題: ", err)
+	}
+
 	router := mux.NewRouter() // 新路由
-	router.HandleFunc(`/api`, dailyAPIHandler)
+	router.HandleFunc(`/api`, dailyAPIHandler).Methods(http.MethodGet)
 
 	apiServerPointer := &http.Server{
 		Addr:           ":7777",
@@ -35,49 +69,109 @@ func main() {
 
 }
 
-func dailyAPIHandler(w http.ResponseWriter, r *http.Request) {
+// writeError 回應錯誤,格式統一為 {"status":400,"error":"錯誤訊息"}
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{"status": status, "error": message})
+}
 
-	mongoClientPointer, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(`mongodb://localhost:27017`)) // 連接預設主機
+// writeJSON 回應JSON
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 
-	if nil != err {
-		fmt.Fprintf(w, "連接 MongoDB Server 發生問題") // 寫入回應
-		return
+	jsonBytes, err := json.Marshal(data) // 轉成JSON
+	if err != nil {
+		status = http.StatusInternalServerError
+		jsonBytes = []byte(fmt.Sprintf(`{"status":%d,"error":%q}`, status, err.Error()))
 	}
 
-	cursor, err := mongoClientPointer.
-		Database(`Leapsy-Environmental-Control-Database`).
-		Collection(`second-records`).
-		Find(context.TODO(), bson.M{"time": bson.M{`$gt`: time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local), `$lt`: time.Date(2020, 12, 1, 0, 0, 0, 0, time.Local)}}) //時間要大於某時間 並且小於某時間
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(jsonBytes) // 寫入回應
+}
 
-	if nil != err {
-		fmt.Fprintf(w, "連結 MongoDB.Collection 發生問題") // 寫入回應
-		return
+// parseQueryTime 解析 RFC 3339 時間參數
+func parseQueryTime(name string, value string) (time.Time, error) {
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, errors.New(name + " 時間格式錯誤(應為 RFC 3339,ex: 2020-01-01T08:00:00+08:00)")
 	}
 
-	var results []Data
+	return t, nil
+}
 
-	for cursor.Next(context.TODO()) { // 針對每一紀錄
+// parseQuery 解析 ?from=&to=&limit=,未指定 to 為現在,未指定 from 為 to 往前 defaultRangeHours 小時
+func parseQuery(r *http.Request) (time.Time, time.Time, int, error) {
 
-		var data Data
+	query := r.URL.Query()
 
-		err = cursor.Decode(&data) // 解析紀錄
+	to := time.Now()
+	if query.Get("to") != "" {
 
-		if nil != err {
-			fmt.Fprintf(w, "no data(MongoDB)") // 寫入回應
-			return
+		var err error
+		if to, err = parseQueryTime("to", query.Get("to")); err != nil {
+			return to, to, 0, err
 		}
+	}
 
-		results = append(results, data) // 儲存紀錄
+	from := to.Add(-defaultRangeHours * time.Hour)
+	if query.Get("from") != "" {
 
+		var err error
+		if from, err = parseQueryTime("from", query.Get("from")); err != nil {
+			return from, to, 0, err
+		}
+	}
+
+	if !from.Before(to) {
+		return from, to, 0, errors.New("from 必須早於 to")
+	}
+
+	if to.Sub(from) > maxRangeDays*24*time.Hour {
+		return from, to, 0, fmt.Errorf("查詢區間不可超過 %d 天", maxRangeDays)
 	}
 
-	jsonBytes, err := json.Marshal(results) // 轉成JSON
+	limit := defaultLimit
+	if query.Get("limit") != "" {
+
+		var err error
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 || limit > maxLimit {
+			return from, to, 0, fmt.Errorf("limit 必須為 1 到 %d 的整數", maxLimit)
+		}
+	}
+
+	return from, to, limit, nil
+}
+
+// 查詢環控紀錄(/api?from=&to=&limit=,時間為 RFC 3339,期間為 from <= time < to)
+func dailyAPIHandler(w http.ResponseWriter, r *http.Request) {
+
+	from, to, limit, err := parseQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cursor, err := mongoClientPointer.
+		Database(dbName).
+		Collection(collectionName).
+		Find(
+			r.Context(),
+			bson.M{"time": bson.M{`$gte`: from, `$lt`: to}}, //時間要大於等於 from 並且小於 to
+			options.Find().SetSort(bson.M{"time": 1}).SetLimit(int64(limit)),
+		)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "查詢 MongoDB.Collection 發生問題: "+err.Error())
+		return
+	}
 
-	if nil != err {
-		fmt.Fprintf(w, "no data(json)") // 寫入回應
+	results := []Data{}
+	if err = cursor.All(r.Context(), &results); err != nil { // 解析紀錄
+		writeError(w, http.StatusInternalServerError, "解析紀錄發生問題: "+err.Error())
 		return
 	}
 
-	fmt.Fprintf(w, "%s", string(jsonBytes)) // 寫入回應
+	writeJSON(w, http.StatusOK, results)
 
 }
@@ -0,0 +1,466 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Analytics(出勤趨勢分析) 相關 functions */
+
+const (
+	trendByDay   = "day"
+	trendByWeek  = "week"
+	trendByMonth = "month"
+)
+
+// trendDefaultWindows 各分組方式預設的移動平均期間數
+var trendDefaultWindows = map[string]int{
+	trendByDay:   7,
+	trendByWeek:  4,
+	trendByMonth: 3,
+}
+
+// trendPeriodFormats 各分組方式的期間格式($dateToString,週為 ISO 週 ex: 2020-W02)
+var trendPeriodFormats = map[string]string{
+	trendByDay:   "%Y-%m-%d",
+	trendByWeek:  "%G-W%V",
+	trendByMonth: "%Y-%m",
+}
+
+// trendPoint 聚合結果(每個期間一筆,Start 為期間內第一個應到日,以 UTC 表示當地日期)
+type trendPoint struct {
+	Start                      time.Time `bson:"start"`
+	model.AttendanceTrendPoint `bson:",inline"`
+}
+
+// dateTimeFromStringExpression 把 YYYY-MM-DD 或 YYYY-MM-DD HH:MM:SS 字串(可能沒有補零)組回日期
+// 以 UTC 表示當地的日期時間,格式錯誤時為 null(不會中斷整個聚合)
+func dateTimeFromStringExpression(value interface{}) bson.M {
+
+	toInt := func(array string, index int) bson.M {
+		return bson.M{"$convert": bson.M{
+			"input":   bson.M{"$arrayElemAt": bson.A{array, index}},
+			"to":      "int",
+			"onError": nil,
+			"onNull":  nil,
+		}}
+	}
+
+	return bson.M{"$let": bson.M{
+		"vars": bson.M{"parts": bson.M{"$split": bson.A{bson.M{"$ifNull": bson.A{value, ""}}, " "}}},
+		"in": bson.M{"$let": bson.M{
+			"vars": bson.M{
+				"date":  bson.M{"$split": bson.A{bson.M{"$arrayElemAt": bson.A{"$$parts", 0}}, "-"}},
+				"clock": bson.M{"$split": bson.A{bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$$parts", 1}}, "0:0:0"}}, ":"}},
+			},
+			"in": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{
+					bson.M{"$lte": bson.A{bson.M{"$size": "$$parts"}, 2}},
+					bson.M{"$eq": bson.A{bson.M{"$size": "$$date"}, 3}},
+					bson.M{"$eq": bson.A{bson.M{"$size": "$$clock"}, 3}},
+				}},
+				bson.M{"$dateFromParts": bson.M{
+					"year":   toInt("$$date", 0),
+					"month":  toInt("$$date", 1),
+					"day":    toInt("$$date", 2),
+					"hour":   toInt("$$clock", 0),
+					"minute": toInt("$$clock", 1),
+					"second": toInt("$$clock", 2),
+				}},
+				nil,
+			}},
+		}},
+	}}
+}
+
+// localFromUTCParts 把以 UTC 表示的當地日期時間轉回當地時區
+func localFromUTCParts(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+}
+
+// clockMinutesExpression 把 HH:MM 字串轉為當天的分鐘數,格式錯誤時為 null
+func clockMinutesExpression(value interface{}) bson.M {
+
+	toInt := func(index int) bson.M {
+		return bson.M{"$convert": bson.M{
+			"input":   bson.M{"$arrayElemAt": bson.A{"$$clock", index}},
+			"to":      "int",
+			"onError": nil,
+			"onNull":  nil,
+		}}
+	}
+
+	return bson.M{"$let": bson.M{
+		"vars": bson.M{"clock": bson.M{"$split": bson.A{bson.M{"$ifNull": bson.A{value, ""}}, ":"}}},
+		"in":   bson.M{"$add": bson.A{bson.M{"$multiply": bson.A{toInt(0), 60}}, toInt(1)}},
+	}}
+}
+
+// rateExpression 比率(分母為 0 時為 0)
+func rateExpression(numerator interface{}, denominator interface{}) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{denominator, 0}},
+		0.0,
+		bson.M{"$divide": bson.A{numerator, denominator}},
+	}}
+}
+
+// attendanceTrendPipeline 出勤趨勢的聚合 pipeline(需要 MongoDB 5.0 以上,移動平均使用 $setWindowFields)
+// 1. 取出營業日與打卡時間(日期字串可能沒有補零,拆開後以數字組回日期,格式錯誤的紀錄略過)
+// 2. 彙整為每人每營業日一筆:假別與最早一筆打卡的完整時間(夜班跨日仍以時間先後比較),再依人彙整
+// 3. 併入員工名冊,依排班、班別、行事曆展開每人在期間內的應到日(規則同 model.DayType)
+// 4. 依期間、假別加總人次後計算各比率與移動平均
+// 日期時間都以 UTC 表示當地的日期時間;今天班別尚未開始(上班時間加遲到寬限)且還沒打卡的人不計入
+func attendanceTrendPipeline(from time.Time, to time.Time, groupBy string, department string, window int, now time.Time) bson.A {
+
+	const dayMilliseconds = int64(24 * time.Hour / time.Millisecond)
+
+	match := businessDateRangeFilter(from, to)
+	employeeMatch := bson.M{}
+	if department != "" {
+		match["department"] = department
+		employeeMatch["department"] = department
+	}
+
+	utcParts := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	}
+
+	defaultStartMinutes, _ := model.ParseClock(settings.DefaultShiftStartTime)
+	graceMilliseconds := int64(settings.LateGraceMinutes) * int64(time.Minute/time.Millisecond)
+	days := len(datesBetween(from, to))
+
+	attended := bson.M{"$and": bson.A{
+		bson.M{"$eq": bson.A{"$leave_type", ""}},
+		bson.M{"$ne": bson.A{bson.M{"$ifNull": bson.A{"$first_in", nil}}, nil}},
+	}}
+
+	// 不在應到日的紀錄不計入,與 model.DayType 相同: 行事曆例外日 > 輪班休息日 > 週六、週日 > 工作日
+	holidayOfDay := bson.M{"$arrayElemAt": bson.A{
+		bson.M{"$filter": bson.M{
+			"input": "$holidays",
+			"cond":  bson.M{"$eq": bson.A{"$$this.date", "$date"}},
+		}},
+		-1,
+	}}
+
+	rotatingWorkDay := bson.M{"$let": bson.M{
+		"vars": bson.M{"offset": bson.M{"$floor": bson.M{"$divide": bson.A{bson.M{"$subtract": bson.A{"$day", "$cycle_start"}}, dayMilliseconds}}}},
+		"in": bson.M{"$lt": bson.A{
+			bson.M{"$mod": bson.A{bson.M{"$add": bson.A{bson.M{"$mod": bson.A{"$$offset", "$cycle"}}, "$cycle"}}, "$cycle"}},
+			"$on_days",
+		}},
+	}}
+
+	dayType := bson.M{"$let": bson.M{
+		"vars": bson.M{"holiday": holidayOfDay},
+		"in": bson.M{"$switch": bson.M{
+			"branches": bson.A{
+				bson.M{"case": bson.M{"$ne": bson.A{bson.M{"$ifNull": bson.A{"$$holiday", nil}}, nil}}, "then": "$$holiday.type"},
+				bson.M{"case": bson.M{"$and": bson.A{"$rotating", bson.M{"$eq": bson.A{"$cycle_start", nil}}}}, "then": model.DayTypeWorkday},
+				bson.M{"case": "$rotating", "then": bson.M{"$cond": bson.A{rotatingWorkDay, model.DayTypeWorkday, model.DayTypeRestDay}}},
+				bson.M{"case": bson.M{"$eq": bson.A{bson.M{"$isoDayOfWeek": "$day"}, 6}}, "then": model.DayTypeRestDay},
+				bson.M{"case": bson.M{"$eq": bson.A{bson.M{"$isoDayOfWeek": "$day"}, 7}}, "then": model.DayTypeRegularLeave},
+			},
+			"default": model.DayTypeWorkday,
+		}},
+	}}
+
+	movingAverage := func(field string) bson.M {
+		return bson.M{"$avg": field, "window": bson.M{"documents": bson.A{1 - window, "current"}}}
+	}
+
+	return bson.A{
+		bson.M{"$match": match},
+		bson.M{"$project": bson.M{
+			"name":       1,
+			"leave_type": bson.M{"$ifNull": bson.A{"$leave_type", ""}},
+			"_punch": bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{bson.M{"$ifNull": bson.A{"$check_in_time", ""}}, ""}},
+				dateTimeFromStringExpression("$check_in_time"),
+				nil,
+			}},
+			"_day": dateTimeFromStringExpression(bson.M{"$cond": bson.A{
+				bson.M{"$gt": bson.A{bson.M{"$ifNull": bson.A{"$business_date", ""}}, ""}},
+				"$business_date",
+				"$date",
+			}}),
+		}},
+		bson.M{"$match": bson.M{"_day": bson.M{"$ne": nil}}},
+
+		// 每人每營業日一筆($min 會略過 null),再依人彙整
+		bson.M{"$group": bson.M{
+			"_id":        bson.M{"name": "$name", "day": "$_day"},
+			"leave_type": bson.M{"$max": "$leave_type"},
+			"first_in":   bson.M{"$min": "$_punch"},
+		}},
+		bson.M{"$group": bson.M{
+			"_id":  "$_id.name",
+			"days": bson.M{"$push": bson.M{"day": "$_id.day", "leave_type": "$leave_type", "first_in": "$first_in"}},
+		}},
+
+		// 應到的人: 員工名冊與有打卡紀錄的人
+		bson.M{"$unionWith": bson.M{
+			"coll": settings.CollectionNameOfEmployee,
+			"pipeline": bson.A{
+				bson.M{"$match": employeeMatch},
+				bson.M{"$project": bson.M{"_id": "$name", "days": bson.M{"$literal": bson.A{}}}},
+			},
+		}},
+		bson.M{"$group": bson.M{"_id": "$_id", "days": bson.M{"$push": "$days"}}},
+
+		// 排班與班別(未排班或班別不存在時使用預設班別,同 shiftTable.lookup)
+		bson.M{"$lookup": bson.M{"from": settings.CollectionNameOfShiftAssignment, "localField": "_id", "foreignField": "name", "as": "assignment"}},
+		bson.M{"$addFields": bson.M{"assignment": bson.M{"$arrayElemAt": bson.A{"$assignment", -1}}}},
+		bson.M{"$lookup": bson.M{"from": settings.CollectionNameOfShift, "localField": "assignment.shift_code", "foreignField": "code", "as": "shift"}},
+		bson.M{"$lookup": bson.M{
+			"from":     settings.CollectionNameOfHoliday,
+			"pipeline": bson.A{bson.M{"$match": bson.M{"date": bson.M{"$gte": from.Format(model.DateLayout), "$lte": to.Format(model.DateLayout)}}}},
+			"as":       "holidays",
+		}},
+		bson.M{"$project": bson.M{
+			"days":        bson.M{"$reduce": bson.M{"input": "$days", "initialValue": bson.A{}, "in": bson.M{"$concatArrays": bson.A{"$$value", "$$this"}}}},
+			"holidays":    1,
+			"rotating":    bson.M{"$gt": bson.A{bson.M{"$ifNull": bson.A{"$assignment.off_days", 0}}, 0}},
+			"on_days":     "$assignment.on_days",
+			"cycle":       bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$assignment.on_days", 0}}, bson.M{"$ifNull": bson.A{"$assignment.off_days", 0}}}},
+			"cycle_start": dateTimeFromStringExpression("$assignment.cycle_start"),
+			"start_minutes": bson.M{"$ifNull": bson.A{
+				clockMinutesExpression(bson.M{"$arrayElemAt": bson.A{"$shift.start_time", -1}}),
+				defaultStartMinutes,
+			}},
+		}},
+
+		// 展開期間內的每一天,只留應到日
+		bson.M{"$addFields": bson.M{"day": bson.M{"$range": bson.A{0, days}}}},
+		bson.M{"$unwind": "$day"},
+		bson.M{"$addFields": bson.M{"day": bson.M{"$add": bson.A{utcParts(from), bson.M{"$multiply": bson.A{"$day", dayMilliseconds}}}}}},
+		bson.M{"$addFields": bson.M{"date": bson.M{"$dateToString": bson.M{"format": "%Y-%m-%d", "date": "$day"}}}},
+		bson.M{"$match": bson.M{"$expr": bson.M{"$eq": bson.A{dayType, model.DayTypeWorkday}}}},
+
+		// 當天的出勤
+		bson.M{"$project": bson.M{
+			"day": 1,
+			"record": bson.M{"$arrayElemAt": bson.A{
+				bson.M{"$filter": bson.M{"input": "$days", "cond": bson.M{"$eq": bson.A{"$$this.day", "$day"}}}},
+				0,
+			}},
+			"shift_start": bson.M{"$add": bson.A{"$day", bson.M{"$multiply": bson.A{"$start_minutes", int64(time.Minute / time.Millisecond)}}}},
+		}},
+		bson.M{"$project": bson.M{
+			"day":         1,
+			"shift_start": 1,
+			"leave_type":  bson.M{"$ifNull": bson.A{"$record.leave_type", ""}},
+			"first_in":    bson.M{"$ifNull": bson.A{"$record.first_in", nil}},
+		}},
+		bson.M{"$match": bson.M{"$expr": bson.M{"$or": bson.A{
+			bson.M{"$ne": bson.A{"$leave_type", ""}},
+			bson.M{"$ne": bson.A{"$first_in", nil}},
+			bson.M{"$gte": bson.A{utcParts(now), bson.M{"$add": bson.A{"$shift_start", graceMilliseconds}}}},
+		}}}},
+
+		// 依期間、假別加總人次(遲到: 第一筆打卡晚於上班時間超過寬限分鐘數)
+		bson.M{"$group": bson.M{
+			"_id":      bson.M{"period": bson.M{"$dateToString": bson.M{"format": trendPeriodFormats[groupBy], "date": "$day"}}, "leave_type": "$leave_type"},
+			"start":    bson.M{"$min": "$day"},
+			"expected": bson.M{"$sum": 1},
+			"attended": bson.M{"$sum": bson.M{"$cond": bson.A{attended, 1, 0}}},
+			"late": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{
+					attended,
+					bson.M{"$gte": bson.A{
+						bson.M{"$subtract": bson.A{"$first_in", "$shift_start"}},
+						graceMilliseconds + int64(time.Minute/time.Millisecond),
+					}},
+				}},
+				1,
+				0,
+			}}},
+			"on_leave": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$ne": bson.A{"$leave_type", ""}}, 1, 0}}},
+		}},
+		bson.M{"$group": bson.M{
+			"_id":      "$_id.period",
+			"start":    bson.M{"$min": "$start"},
+			"expected": bson.M{"$sum": "$expected"},
+			"attended": bson.M{"$sum": "$attended"},
+			"late":     bson.M{"$sum": "$late"},
+			"on_leave": bson.M{"$sum": "$on_leave"},
+			"leaves":   bson.M{"$push": bson.M{"k": "$_id.leave_type", "v": "$on_leave"}},
+		}},
+		bson.M{"$addFields": bson.M{"leaves": bson.M{"$filter": bson.M{"input": "$leaves", "cond": bson.M{"$ne": bson.A{"$$this.k", ""}}}}}},
+		bson.M{"$project": bson.M{
+			"_id":             0,
+			"period":          "$_id",
+			"start":           1,
+			"expected":        1,
+			"attended":        1,
+			"late":            1,
+			"on_leave":        1,
+			"leave_by_type":   bson.M{"$arrayToObject": "$leaves"},
+			"attendance_rate": rateExpression("$attended", "$expected"),
+			"late_rate":       rateExpression("$late", "$attended"),
+			"leave_rate":      rateExpression("$on_leave", "$expected"),
+			"leave_rate_by_type": bson.M{"$arrayToObject": bson.M{"$map": bson.M{
+				"input": "$leaves",
+				"in":    bson.M{"k": "$$this.k", "v": rateExpression("$$this.v", "$expected")},
+			}}},
+		}},
+
+		// 移動平均(包含本期與前 window-1 期)
+		bson.M{"$setWindowFields": bson.M{
+			"sortBy": bson.M{"start": 1},
+			"output": bson.M{
+				"attendance_rate_moving_average": movingAverage("$attendance_rate"),
+				"late_rate_moving_average":       movingAverage("$late_rate"),
+				"leave_rate_moving_average":      movingAverage("$leave_rate"),
+			},
+		}},
+		bson.M{"$sort": bson.M{"start": 1}},
+	}
+}
+
+// trendPeriodRange 期間的起迄日(不超出查詢範圍)
+func trendPeriodRange(start time.Time, groupBy string, from time.Time, to time.Time) (time.Time, time.Time) {
+
+	begin := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local)
+	end := begin
+
+	switch groupBy {
+	case trendByWeek:
+		offset := (int(begin.Weekday()) + 6) % 7 // ISO 週從星期一開始
+		begin = begin.AddDate(0, 0, -offset)
+		end = begin.AddDate(0, 0, 6)
+	case trendByMonth:
+		begin = time.Date(begin.Year(), begin.Month(), 1, 0, 0, 0, 0, time.Local)
+		end = begin.AddDate(0, 1, -1)
+	}
+
+	if begin.Before(from) {
+		begin = from
+	}
+
+	if end.After(to) {
+		end = to
+	}
+
+	return begin, end
+}
+
+// ratio 比率(分母為 0 時為 0)
+func ratio(numerator int, denominator int) float64 {
+
+	if denominator == 0 {
+		return 0
+	}
+
+	return float64(numerator) / float64(denominator)
+}
+
+// attendanceTrend 計算出勤趨勢(人次、比率與移動平均都在聚合 pipeline 計算)
+func attendanceTrend(from time.Time, to time.Time, groupBy string, department string, window int) (model.AttendanceTrend, error) {
+
+	trend := model.AttendanceTrend{
+		Group_by:   groupBy,
+		Department: department,
+		From:       from.Format(model.DateLayout),
+		To:         to.Format(model.DateLayout),
+		Window:     window,
+		Points:     []model.AttendanceTrendPoint{},
+	}
+
+	// 未來的日期還不能算缺勤
+	now := time.Now()
+	if today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local); to.After(today) {
+		to = today
+		trend.To = to.Format(model.DateLayout)
+	}
+
+	if from.After(to) {
+		return trend, nil
+	}
+
+	if err := checkNotAnonymized(from, to); err != nil {
+		return trend, err
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
+	if err != nil {
+		return trend, err
+	}
+
+	cur, err := collection.Aggregate(context.Background(), attendanceTrendPipeline(from, to, groupBy, department, window, now))
+	if err != nil {
+		return trend, err
+	}
+
+	var points []trendPoint
+	if err := cur.All(context.Background(), &points); err != nil {
+		return trend, err
+	}
+
+	for _, point := range points {
+
+		begin, end := trendPeriodRange(localFromUTCParts(point.Start), groupBy, from, to)
+
+		point.From = begin.Format(model.DateLayout)
+		point.To = end.Format(model.DateLayout)
+		trend.Points = append(trend.Points, point.AttendanceTrendPoint)
+	}
+
+	return trend, nil
+}
+
+// 取得出勤趨勢(/analytics/attendance-trend?from=&to=&group_by=day|week|month&department=&window=)
+func getAttendanceTrend(c *fiber.Ctx) {
+
+	// points 的欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	from, to, err := parseDateRange(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	groupBy := c.Query("group_by", trendByDay)
+	if _, ok := trendDefaultWindows[groupBy]; !ok {
+		sendError(c, 400, "group_by 必須為 day、week 或 month")
+		return
+	}
+
+	window := trendDefaultWindows[groupBy]
+	if c.Query("window") != "" {
+		window, err = strconv.Atoi(c.Query("window"))
+		if err != nil || window < 1 {
+			sendError(c, 400, "window 必須為正整數")
+			return
+		}
+	}
+
+	department := c.Query("department")
+	fmt.Println("出勤趨勢=", from.Format(model.DateLayout), "~", to.Format(model.DateLayout), "分組=", groupBy, "部門=", department)
+
+	trend, err := attendanceTrend(from, to, groupBy, department, window)
+	if err != nil {
+		sendError(c, aggregateErrorStatus(err), err.Error())
+		return
+	}
+
+	setDateCacheControl(c, to)
+	sendListIn(c, view, trend, "points")
+}
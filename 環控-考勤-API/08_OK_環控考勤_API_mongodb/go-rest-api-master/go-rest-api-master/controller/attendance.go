@@ -0,0 +1,267 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為依營業日彙整出勤資料的共用 functions */
+
+// dailyAttendance 員工單一營業日的出勤(同一營業日的所有打卡與請假)
+type dailyAttendance struct {
+	Name       string
+	Department string
+	Position   string
+	Date       time.Time   // 營業日
+	Punches    []time.Time // 打卡時間(由早到晚)
+	Leave_type string      // 假別(沒有請假為空字串)
+}
+
+// firstIn 第一筆打卡
+func (attendance *dailyAttendance) firstIn() (time.Time, bool) {
+
+	if len(attendance.Punches) == 0 {
+		return time.Time{}, false
+	}
+
+	return attendance.Punches[0], true
+}
+
+// lastOut 最後一筆打卡(只有一筆打卡時視為沒有下班打卡)
+func (attendance *dailyAttendance) lastOut() (time.Time, bool) {
+
+	if len(attendance.Punches) < 2 {
+		return time.Time{}, false
+	}
+
+	return attendance.Punches[len(attendance.Punches)-1], true
+}
+
+// workedMinutes 工作分鐘數(連續工作超過 OvertimeBreakAfterMinutes 時扣除休息時間)
+func workedMinutes(firstIn time.Time, lastOut time.Time) int {
+
+	minutes := int(lastOut.Sub(firstIn) / time.Minute)
+	if minutes > settings.OvertimeBreakAfterMinutes {
+		minutes -= settings.OvertimeBreakMinutes
+	}
+
+	return minutes
+}
+
+// datesBetween 取得期間內每一天(含頭尾)
+func datesBetween(from time.Time, to time.Time) []time.Time {
+
+	var dates []time.Time
+	for date := from; !date.After(to); date = date.AddDate(0, 0, 1) {
+		dates = append(dates, date)
+	}
+
+	return dates
+}
+
+// businessDateRangeFilter 依營業日期間查詢打卡紀錄的 filter
+// 已彙整的資料以 business_date 為準,尚未彙整的資料以 date 為準
+func businessDateRangeFilter(from time.Time, to time.Time) bson.M {
+
+	businessDates := bson.A{}
+	dates := bson.A{}
+
+	for _, date := range datesBetween(from, to) {
+		businessDates = append(businessDates, date.Format(model.DateLayout))
+		for _, variant := range model.DateVariants(date) {
+			dates = append(dates, variant)
+		}
+	}
+
+	return bson.M{"$or": bson.A{
+		bson.M{"business_date": bson.M{"$in": businessDates}},
+		bson.M{"business_date": bson.M{"$in": bson.A{nil, ""}}, "date": bson.M{"$in": dates}},
+	}}
+}
+
+// loadDailyAttendance 載入期間內所有員工每個營業日的出勤(依姓名、日期排序)
+func loadDailyAttendance(from time.Time, to time.Time, extraFilter bson.M) ([]*dailyAttendance, error) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := businessDateRangeFilter(from, to)
+	for key, value := range extraFilter {
+		filter[key] = value
+	}
+
+	// 不取照片,避免載入過多資料
+	cur, err := collection.Find(context.Background(), filter, options.Find().SetProjection(bson.M{"pic": 0}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+
+	attendances := map[string]*dailyAttendance{}
+
+	for cur.Next(context.Background()) {
+
+		var record model.CheckInRecord
+		if err := cur.Decode(&record); err != nil {
+			return nil, err
+		}
+
+		dateString := record.Business_date
+		if dateString == "" {
+			dateString = record.Date
+		}
+
+		date, err := model.ParseDate(dateString)
+		if err != nil {
+			continue
+		}
+
+		key := record.Name + "|" + date.Format(model.DateLayout)
+		attendance, ok := attendances[key]
+		if !ok {
+			attendance = &dailyAttendance{
+				Name:       record.Name,
+				Department: record.Department,
+				Position:   record.Position,
+				Date:       date,
+			}
+			attendances[key] = attendance
+		}
+
+		if record.Leave_type != "" {
+			attendance.Leave_type = record.Leave_type
+		}
+
+		if punch, err := model.ParseCheckInTime(record.Check_in_time); err == nil {
+			attendance.Punches = append(attendance.Punches, punch)
+		}
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	results := make([]*dailyAttendance, 0, len(attendances))
+	for _, attendance := range attendances {
+		sort.Slice(attendance.Punches, func(i, j int) bool { return attendance.Punches[i].Before(attendance.Punches[j]) })
+		results = append(results, attendance)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Name != results[j].Name {
+			return results[i].Name < results[j].Name
+		}
+		return results[i].Date.Before(results[j].Date)
+	})
+
+	return results, nil
+}
+
+// loadHolidays 載入期間內的行事曆例外日(key: YYYY-MM-DD)
+func loadHolidays(from time.Time, to time.Time) (map[string]model.Holiday, error) {
+
+	holidays := map[string]model.Holiday{}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfHoliday)
+	if err != nil {
+		return holidays, err
+	}
+
+	filter := bson.M{"date": bson.M{"$gte": from.Format(model.DateLayout), "$lte": to.Format(model.DateLayout)}}
+
+	var results []model.Holiday
+	cur, err := collection.Find(context.Background(), filter)
+	if err != nil {
+		return holidays, err
+	}
+
+	if err = cur.All(context.Background(), &results); err != nil {
+		return holidays, err
+	}
+
+	for _, holiday := range results {
+		holidays[holiday.Date] = holiday
+	}
+
+	return holidays, nil
+}
+
+// parseMonth 解析 YYYY-MM,回傳當月第一天與最後一天
+func parseMonth(month string) (time.Time, time.Time, error) {
+
+	first, err := time.ParseInLocation("2006-01", month, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	return first, first.AddDate(0, 1, -1), nil
+}
+
+// parseDateRange 解析查詢參數 date 或 from/to,回傳期間起迄日
+func parseDateRange(c *fiber.Ctx) (time.Time, time.Time, error) {
+
+	if myDate := c.Query("date"); myDate != "" {
+		date, err := model.ParseDate(myDate)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("日期格式錯誤(應為 date=YYYY-MM-DD)")
+		}
+		return date, date, nil
+	}
+
+	from, err := model.ParseDate(c.Query("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("必須指定 date=YYYY-MM-DD 或 from=YYYY-MM-DD&to=YYYY-MM-DD")
+	}
+
+	to, err := model.ParseDate(c.Query("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("必須指定 date=YYYY-MM-DD 或 from=YYYY-MM-DD&to=YYYY-MM-DD")
+	}
+
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, errors.New("from 不可晚於 to")
+	}
+
+	return from, to, nil
+}
+
+// loadEmployees 載入員工資料(可指定部門)
+func loadEmployees(department string) ([]model.Employee, error) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfEmployee)
+	if err != nil {
+		return nil, err
+	}
+
+	var filter bson.M = bson.M{}
+	if department != "" {
+		filter = bson.M{"department": department}
+	}
+
+	var results []model.Employee
+	cur, err := collection.Find(context.Background(), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cur.All(context.Background(), &results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
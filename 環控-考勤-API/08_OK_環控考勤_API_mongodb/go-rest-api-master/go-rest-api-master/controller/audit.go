@@ -0,0 +1,174 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Audit(資料異動紀錄) 相關 functions */
+
+// auditContext 取得異動者與異動原因(header: X-Actor、X-Audit-Reason)
+// 修改與刪除必須說明原因,缺少時回應 400 並回傳 false
+func auditContext(c *fiber.Ctx, reasonRequired bool) (string, string, bool) {
+
+	actor := c.Get(settings.AuditActorHeader)
+	reason := c.Get(settings.AuditReasonHeader)
+
+	if actor == "" {
+		sendError(c, 400, "必須以 "+settings.AuditActorHeader+" header 指定異動者")
+		return "", "", false
+	}
+
+	if reasonRequired && reason == "" {
+		sendError(c, 400, "必須以 "+settings.AuditReasonHeader+" header 說明異動原因")
+		return "", "", false
+	}
+
+	return actor, reason, true
+}
+
+// auditDocument 轉為異動紀錄中保存的資料(照片太大,只記錄是否有照片)
+func auditDocument(document interface{}) (bson.M, error) {
+
+	if document == nil {
+		return nil, nil
+	}
+
+	content, err := bson.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	var result bson.M
+	if err := bson.Unmarshal(content, &result); err != nil {
+		return nil, err
+	}
+
+	if pic, ok := result["pic"].(string); ok && pic != "" {
+		result["pic"] = fmt.Sprintf("(照片 %d bytes)", len(pic))
+	}
+
+	return result, nil
+}
+
+// writeAuditLog 新增一筆資料異動紀錄
+func writeAuditLog(entity string, entityID string, action string, actor string, reason string, before interface{}, after interface{}) error {
+
+	beforeDocument, err := auditDocument(before)
+	if err != nil {
+		return err
+	}
+
+	afterDocument, err := auditDocument(after)
+	if err != nil {
+		return err
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfAuditLog)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.InsertOne(context.Background(), model.AuditLog{
+		ID:        primitive.NewObjectID(),
+		Entity:    entity,
+		Entity_id: entityID,
+		Action:    action,
+		Actor:     actor,
+		Reason:    reason,
+		Timestamp: time.Now().Format(model.DateTimeLayout),
+		Before:    beforeDocument,
+		After:     afterDocument,
+	})
+
+	return err
+}
+
+// parseAuditLogLimit 解析 ?limit=(預設 settings.AuditLogDefaultLimit,上限 settings.AuditLogMaxLimit)
+func parseAuditLogLimit(c *fiber.Ctx) (int64, error) {
+
+	if c.Query("limit") == "" {
+		return settings.AuditLogDefaultLimit, nil
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 || limit > settings.AuditLogMaxLimit {
+		return 0, fmt.Errorf("limit 必須為 1 到 %d 的整數", settings.AuditLogMaxLimit)
+	}
+
+	return int64(limit), nil
+}
+
+// 查詢資料異動紀錄(/audit?entity=&entity_id=&actor=&date= 或 &from=&to=&limit=,依時間新到舊)
+func getAuditLog(c *fiber.Ctx) {
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	limit, err := parseAuditLogLimit(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	filter := bson.M{}
+
+	for _, key := range []string{"entity", "entity_id", "actor"} {
+		if value := c.Query(key); value != "" {
+			filter[key] = value
+		}
+	}
+
+	if c.Query("date") != "" || c.Query("from") != "" {
+
+		from, to, err := parseDateRange(c)
+		if err != nil {
+			sendError(c, 400, err.Error())
+			return
+		}
+
+		// 時間以 YYYY-MM-DD HH:MM:SS 字串儲存,可直接比較大小
+		filter["timestamp"] = bson.M{
+			"$gte": from.Format(model.DateLayout),
+			"$lt":  to.AddDate(0, 0, 1).Format(model.DateLayout),
+		}
+	}
+
+	fmt.Println("查詢異動紀錄 filter=", filter)
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfAuditLog)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	cur, err := collection.Find(context.Background(), filter, view.findOptions().SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	logs := []model.AuditLog{}
+	if err := cur.All(context.Background(), &logs); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	sendList(c, view, logs)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 
 	"github.com/gofiber/fiber"
+	"github.com/gofiber/template/html"
 	"go.mongodb.org/mongo-driver/bson"
 
 	"my-rest-api/db"
@@ -25,22 +26,143 @@ import (
 func NewPersonController() {
 
 	fmt.Println("測試")
-	app := fiber.New()
+
+	// 每天結算時自動產生打卡統計
+	startCheckInStatisticsJob()
+
+	// 傳送 webhook 事件(含失敗重試)
+	startWebhookWorker()
+
+	// 即時推播新打卡與統計變動
+	startLiveFeed()
+
+	// 每天依保存規則刪除過期照片、匿名化個人資料
+	startRetentionJob()
+
+	// 環控紀錄依序列與時間查詢的索引
+	ensureEnvIndexes()
+
+	// 檢查環控警報規則(寫入紀錄時與定期)
+	startEnvAlertJob()
+
+	app := fiber.New(&fiber.Settings{
+		Views: html.New(settings.ViewsDirectory, ".html"), //報表頁面樣板
+	})
+
+	// 回應壓縮(brotli、gzip)與 ETag 快取
+	app.Use(compressResponse)
+	app.Use(httpCache)
 
 	/*建立 checkInRecord 路徑*/
 	app.Get("/checkInRecord/query/:date?", getCheckInRecord)                      //應到人員資料
 	app.Get("/checkInRecord/attendance/:date?", getAttendanceOfCheckInStatistics) //實到人員資料
 	app.Get("/checkInRecord/notArrived/:date?", getNotArrivedOfCheckInStatistics) //未到人員資料
+	app.Post("/checkInRecord/consolidate/:date", consolidateCheckInRecord)        //彙整打卡紀錄(計算跨夜班營業日)
+	app.Get("/checkInRecord/:id/photo", getCheckInRecordPhoto)                    //打卡照片
+	app.Post("/checkInRecord", checkInRecordEntity.createHandler)                 //新增打卡紀錄
+	app.Put("/checkInRecord/:id", checkInRecordEntity.updateHandler)              //修改打卡紀錄
+	app.Delete("/checkInRecord/:id", checkInRecordEntity.deleteHandler)           //刪除打卡紀錄
+
+	/*建立 leave 路徑(請假即有假別的打卡紀錄)*/
+	app.Post("/leaves", leaveEntity.createHandler)       //新增請假
+	app.Put("/leaves/:id", leaveEntity.updateHandler)    //修改請假
+	app.Delete("/leaves/:id", leaveEntity.deleteHandler) //刪除請假
 	//app.Post("/person", createPerson)
 	//app.Put("/person/:id", updatePerson)
 	//app.Delete("/person/:id", deletePerson)
 
 	/*建立 checkInStatistics 路徑*/
-	app.Get("/checkInStatistics/query/:date?", getCheckInStatistics) //統計資料
+	app.Get("/checkInStatistics/query/:date?", getCheckInStatistics)             //統計資料
+	app.Get("/checkInStatistics/byDepartment", getCheckInStatisticsByDepartment) //各部門統計(?date= 或 ?from=&to=)
+	app.Get("/checkInStatistics/byPosition", getCheckInStatisticsByPosition)     //各職稱統計(?date= 或 ?from=&to=)
+	app.Post("/checkInStatistics", checkInStatisticsEntity.createHandler)        //新增統計資料
+	app.Put("/checkInStatistics/:id", checkInStatisticsEntity.updateHandler)     //修改統計資料
+	app.Delete("/checkInStatistics/:id", checkInStatisticsEntity.deleteHandler)  //刪除統計資料
 	//app.Post("/person", createPerson)
 	//app.Put("/person/:id", updatePerson)
 	//app.Delete("/person/:id", deletePerson)
 
+	/*建立 shift 路徑*/
+	app.Get("/shift/query", getShift)                            //班別資料
+	app.Post("/shift", upsertShift)                              //新增或更新班別
+	app.Get("/shiftAssignment/query/:name?", getShiftAssignment) //員工排班資料
+	app.Post("/shiftAssignment", upsertShiftAssignment)          //新增或更新員工排班(含輪班)
+
+	/*建立 holiday 路徑*/
+	app.Get("/holiday/query/:year?", getHoliday) //行事曆例外日(國定假日、補班)
+	app.Post("/holiday", upsertHoliday)          //新增或更新行事曆例外日
+
+	/*建立 overtime 路徑*/
+	app.Get("/overtime/query/:date", getOvertime)           //指定日期每位員工加班
+	app.Get("/overtime/monthly/:month", getMonthlyOvertime) //指定月份每位員工加班彙總(薪資用)
+
+	/*建立 employee 路徑*/
+	app.Get("/employees/query/:id?", getEmployee)     //員工資料
+	app.Post("/employees", upsertEmployee)            //新增或更新員工資料
+	app.Delete("/employees/:id", deleteEmployee)      //刪除員工資料
+	app.Get("/employees/:id/timesheet", getTimesheet) //員工出勤月報表(?month=YYYY-MM)
+
+	/*建立 visitor 路徑*/
+	app.Get("/visitors/query/:date?", getVisitor)       //指定日期的訪客
+	app.Post("/visitors", createVisitor)                //訪客預約登記
+	app.Post("/visitors/:id/checkIn", checkInVisitor)   //訪客到訪報到
+	app.Post("/visitors/:id/checkOut", checkOutVisitor) //訪客離開
+
+	/*建立 export 路徑*/
+	app.Get("/export/:dataset", exportData) //匯出 records、leave、statistics、timesheets (?from=&to=&format=xlsx|csv)
+
+	/*建立 report 路徑(列印用 HTML 報表)*/
+	app.Get("/reports/daily/:date?", getDailyReport)     //每日出勤報表(實到、未到、請假、訪客)
+	app.Get("/reports/monthly/:month", getMonthlyReport) //部門月出勤報表
+
+	/*建立 correction 路徑(忘打卡補登)*/
+	app.Get("/corrections", getCorrections)                             //補登申請(?employee_id=&status=&date=)
+	app.Post("/corrections", submitCorrection)                          //提出補登申請
+	app.Get("/corrections/pending/:approver_id", getPendingCorrections) //主管待審核的補登申請
+	app.Post("/corrections/:id/decision", decideCorrection)             //審核補登申請(header X-Actor 為主管員工編號)
+
+	/*建立 webhook 路徑*/
+	app.Get("/webhooks", getWebhooks)                     //已登記的 webhook
+	app.Post("/webhooks", registerWebhook)                //登記 webhook(events: attendance.not_arrived_final、leave.approved、exception.raised、env.alert.opened、env.alert.resolved)
+	app.Delete("/webhooks/:id", deleteWebhook)            //刪除 webhook
+	app.Post("/webhooks/:id/ping", pingWebhook)           //傳送測試事件
+	app.Get("/webhooks/deliveries", getWebhookDeliveries) //傳送紀錄(?webhook_id=&event=&status=)
+
+	/*建立 audit 路徑*/
+	app.Get("/audit", getAuditLog) //資料異動紀錄(?entity=&entity_id=&actor=&date= 或 &from=&to=&limit=)
+
+	/*建立 exception 路徑*/
+	app.Get("/exceptions", getExceptions)                 //出勤異常(?date=&status=open|resolved|cleared|all&department=)
+	app.Post("/exceptions/scan/:date", scanExceptions)    //重新掃描指定營業日的出勤異常
+	app.Post("/exceptions/:id/resolve", resolveException) //處理出勤異常
+
+	/*建立 analytics 路徑*/
+	app.Get("/analytics/attendance-trend", getAttendanceTrend) //出勤趨勢(?from=&to=&group_by=day|week|month&department=&window=)
+
+	/*建立 payroll 路徑*/
+	app.Get("/payroll/export/:month", exportPayroll) //匯出薪資檔(?layout=版面定義檔名稱)
+
+	/*建立 live 路徑*/
+	app.Get("/live", getLiveFeed) //即時推播打卡與統計變動(Server-Sent Events,?department=A,B 只訂閱指定部門)
+
+	/*建立 retention 路徑*/
+	app.Get("/retention/policy", getRetentionPolicy)    //資料保存規則
+	app.Get("/retention/last-run", getLastRetentionRun) //最近一次清理報告(?dry_run=true|false)
+	app.Post("/retention/run", runRetentionNow)         //立即執行清理(?dry_run=true 只試算)
+
+	/*建立 environmental 路徑*/
+	app.Get("/env/readings", getEnvironmentalReadings)            //環控紀錄(?from=&to=&limit=&sensor=&metric=&location=,時間為 RFC 3339)
+	app.Post("/env/readings", postEnvironmentalReadings)          //批次寫入環控紀錄(JSON 陣列或 InfluxDB line protocol,?precision=ns|us|ms|s)
+	app.Get("/env/readings/aggregate", getEnvironmentalAggregate) //環控彙總(&interval=1m|5m|1h|1d 或 &mode=lttb&points=)
+	app.Get("/env/sensors/:id?", getSensors)                      //感測器(?location=&metric=)
+	app.Post("/env/sensors", upsertSensor)                        //新增或更新感測器(依 sensor_id)
+	app.Delete("/env/sensors/:id", deleteSensor)                  //刪除感測器
+	app.Get("/env/alert-rules/:id?", getEnvAlertRules)            //警報規則(?sensor=&metric=)
+	app.Post("/env/alert-rules", upsertEnvAlertRule)              //新增或更新警報規則(依 rule_id)
+	app.Delete("/env/alert-rules/:id", deleteEnvAlertRule)        //刪除警報規則(未結束的警報一併結束)
+	app.Get("/env/alerts/:id?", getEnvAlerts)                     //警報與歷史(?status=active|open|acknowledged|resolved|all&sensor=&metric=&location=&rule_id=&from=&to=)
+	app.Post("/env/alerts/:id/acknowledge", acknowledgeEnvAlert)  //確認警報
+
 	/*建立範例 person 路徑*/
 	// app.Get("/person/:id?", getPerson)
 	// app.Post("/person", createPerson)
@@ -54,6 +176,13 @@ func NewPersonController() {
 // 取得指定日期<應到>人員資料
 func getCheckInRecord(c *fiber.Ctx) {
 
+	// 列表欄位(?fields= 只回傳指定欄位,預設不回傳照片,?include=pic 才回傳)
+	view, err := parseListView(c, "pic")
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
 	// 取得 collection
 	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
 
@@ -74,13 +203,19 @@ func getCheckInRecord(c *fiber.Ctx) {
 		myDate := c.Params("date")
 		fmt.Println("查詢日期=", myDate)
 
-		filter = bson.M{"date": myDate}
-		fmt.Println("filter=", filter) //filter 型態 Map[date:2020-01-01]
+		filter = businessDateFilter(myDate) //依營業日查詢(跨夜班歸屬上班那一天)
+		fmt.Println("filter=", filter)
+
+	}
 
+	// 資料沒有異動時直接回應 304,不查詢資料
+	if notModified(c, settings.DbName, settings.CollectionNameOfCheckInRecord, filter) {
+		setDateParamCacheControl(c, c.Params("date"))
+		return
 	}
 
 	var results []bson.M
-	cur, err := collection.Find(context.Background(), filter)
+	cur, err := collection.Find(context.Background(), filter, view.findOptions())
 	defer cur.Close(context.Background())
 
 	if err != nil {
@@ -96,6 +231,9 @@ func getCheckInRecord(c *fiber.Ctx) {
 		return
 	}
 
+	// 已結算的營業日允許快取
+	setDateParamCacheControl(c, c.Params("date"))
+
 	json, _ := json.Marshal(results)
 	c.Send(json)
 }
@@ -103,6 +241,13 @@ func getCheckInRecord(c *fiber.Ctx) {
 // 取得指定日期<實到>人員資料
 func getAttendanceOfCheckInStatistics(c *fiber.Ctx) {
 
+	// 列表欄位(?fields= 只回傳指定欄位,預設不回傳照片,?include=pic 才回傳)
+	view, err := parseListView(c, "pic")
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
 	// 取得 collection
 	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
 
@@ -124,13 +269,20 @@ func getAttendanceOfCheckInStatistics(c *fiber.Ctx) {
 		fmt.Println("查詢日期=", myDate)
 
 		//bson.M{} 裡面所用的欄位名稱 必須使用mongoDb欄位名稱 而非struct的欄位名稱 (與JAVA相異)
-		filter = bson.M{"date": myDate, "leave_type": ""} //應到:leave_type is NULL
-		fmt.Println("filter=", filter)                    //filter 型態 Map[date:2020-01-01]
+		filter = businessDateFilter(myDate) //依營業日查詢(跨夜班歸屬上班那一天)
+		filter["leave_type"] = ""           //應到:leave_type is NULL
+		fmt.Println("filter=", filter)
+
+	}
 
+	// 資料沒有異動時直接回應 304,不查詢資料
+	if notModified(c, settings.DbName, settings.CollectionNameOfCheckInRecord, filter) {
+		setDateParamCacheControl(c, c.Params("date"))
+		return
 	}
 
 	var results []bson.M
-	cur, err := collection.Find(context.Background(), filter)
+	cur, err := collection.Find(context.Background(), filter, view.findOptions())
 	defer cur.Close(context.Background())
 
 	if err != nil {
@@ -146,6 +298,9 @@ func getAttendanceOfCheckInStatistics(c *fiber.Ctx) {
 		return
 	}
 
+	// 已結算的營業日允許快取
+	setDateParamCacheControl(c, c.Params("date"))
+
 	json, _ := json.Marshal(results)
 	c.Send(json)
 }
@@ -153,6 +308,13 @@ func getAttendanceOfCheckInStatistics(c *fiber.Ctx) {
 // 取得指定日期<未到>人員資料
 func getNotArrivedOfCheckInStatistics(c *fiber.Ctx) {
 
+	// 列表欄位(?fields= 只回傳指定欄位,預設不回傳照片,?include=pic 才回傳)
+	view, err := parseListView(c, "pic")
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
 	// 取得 collection
 	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
 
@@ -174,13 +336,20 @@ func getNotArrivedOfCheckInStatistics(c *fiber.Ctx) {
 		fmt.Println("查詢日期=", myDate)
 
 		//bson.M{} 裡面所用的欄位名稱 必須使用mongoDb欄位名稱 而非struct的欄位名稱 (與JAVA相異)
-		filter = bson.M{"date": myDate, "leave_type": bson.M{"$ne": ""}} //應到:leave_type is NOT Equal NULL
+		filter = businessDateFilter(myDate)      //依營業日查詢(跨夜班歸屬上班那一天)
+		filter["leave_type"] = bson.M{"$ne": ""} //應到:leave_type is NOT Equal NULL
 		fmt.Println("filter=", filter)
 
 	}
 
+	// 資料沒有異動時直接回應 304,不查詢資料
+	if notModified(c, settings.DbName, settings.CollectionNameOfCheckInRecord, filter) {
+		setDateParamCacheControl(c, c.Params("date"))
+		return
+	}
+
 	var results []bson.M
-	cur, err := collection.Find(context.Background(), filter)
+	cur, err := collection.Find(context.Background(), filter, view.findOptions())
 	defer cur.Close(context.Background())
 
 	if err != nil {
@@ -196,6 +365,9 @@ func getNotArrivedOfCheckInStatistics(c *fiber.Ctx) {
 		return
 	}
 
+	// 已結算的營業日允許快取
+	setDateParamCacheControl(c, c.Params("date"))
+
 	json, _ := json.Marshal(results)
 	c.Send(json)
 }
@@ -204,6 +376,13 @@ func getNotArrivedOfCheckInStatistics(c *fiber.Ctx) {
 // 取得指定日期統計資料
 func getCheckInStatistics(c *fiber.Ctx) {
 
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
 	// 取得 collection
 	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInStatistics)
 
@@ -224,13 +403,19 @@ func getCheckInStatistics(c *fiber.Ctx) {
 		myDate := c.Params("date")
 		fmt.Println("查詢日期=", myDate)
 
-		filter = bson.M{"date": myDate}
-		fmt.Println("filter=", filter) //filter 型態 Map[date:2020-01-01]
+		filter = statisticsDateFilter(myDate) //補零與未補零的日期都查(ex: 2020-01-01、2020-1-1)
+		fmt.Println("filter=", filter)        //filter 型態 Map[date:2020-01-01]
 
 	}
 
+	// 資料沒有異動時直接回應 304,不查詢資料
+	if notModified(c, settings.DbName, settings.CollectionNameOfCheckInStatistics, filter) {
+		setDateParamCacheControl(c, c.Params("date"))
+		return
+	}
+
 	var results []bson.M
-	cur, err := collection.Find(context.Background(), filter)
+	cur, err := collection.Find(context.Background(), filter, view.findOptions())
 	defer cur.Close(context.Background())
 
 	if err != nil {
@@ -246,6 +431,9 @@ func getCheckInStatistics(c *fiber.Ctx) {
 		return
 	}
 
+	// 已結算的營業日允許快取
+	setDateParamCacheControl(c, c.Params("date"))
+
 	json, _ := json.Marshal(results)
 	c.Send(json)
 }
@@ -0,0 +1,377 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Correction(忘打卡補登申請、主管審核) 相關 functions */
+
+// claimedTime 補登時間: 可給完整時間,或只給 HH:MM(跨夜班早於上班時間的視為隔天)
+func claimedTime(date time.Time, value string, shift model.Shift) (time.Time, error) {
+
+	minutes, err := model.ParseClock(value)
+	if err != nil {
+		return model.ParseCheckInTime(value)
+	}
+
+	start, _ := model.ParseClock(shift.Start_time)
+	if shift.CrossesMidnight() && minutes < start {
+		date = date.AddDate(0, 0, 1)
+	}
+
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local).Add(time.Duration(minutes) * time.Minute), nil
+}
+
+// 提出忘打卡補登申請(body: {"employee_id": "", "date": "YYYY-MM-DD", "claimed_time": "HH:MM", "reason": ""})
+// 由申請人的直屬主管(Employee.Manager_id)審核
+func submitCorrection(c *fiber.Ctx) {
+
+	var request model.CorrectionRequest
+	if err := json.Unmarshal([]byte(c.Body()), &request); err != nil {
+		sendError(c, 400, "無法解析補登申請: "+err.Error())
+		return
+	}
+
+	date, err := model.ParseDate(request.Date)
+	if err != nil {
+		sendError(c, 400, "日期格式錯誤(應為YYYY-MM-DD)")
+		return
+	}
+
+	employee, err := findEmployee(request.Employee_id)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if employee.Employee_id == "" {
+		sendError(c, 404, "查無員工: "+request.Employee_id)
+		return
+	}
+
+	if employee.Manager_id == "" {
+		sendError(c, 400, "員工沒有設定直屬主管,無法送出申請")
+		return
+	}
+
+	table, err := loadShiftTable()
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	shift, assignment := table.lookup(employee.Name)
+
+	punch, err := claimedTime(date, request.Claimed_time, shift)
+	if err != nil {
+		sendError(c, 400, "補登時間格式錯誤(應為YYYY-MM-DD HH:MM:SS 或 HH:MM)")
+		return
+	}
+
+	// 補登時間必須落在申請日的班別內(與彙整相同的營業日判斷),避免補到別天
+	if !model.BusinessDate(punch, shift, assignment).Equal(date) {
+		sendError(c, 400, "補登時間不屬於 "+date.Format(model.DateLayout)+" 的班別("+shift.Start_time+"~"+shift.End_time+")")
+		return
+	}
+
+	request.ID = primitive.NewObjectID()
+	request.Employee_id = employee.Employee_id
+	request.Name = employee.Name
+	request.Department = employee.Department
+	request.Position = employee.Position
+	request.Date = date.Format(model.DateLayout)
+	request.Claimed_time = punch.Format(model.DateTimeLayout)
+	request.Approver_id = employee.Manager_id
+	request.Status = model.CorrectionStatusPending
+	request.Submitted_at = time.Now().Format(model.DateTimeLayout)
+	request.Decided_by = ""
+	request.Decided_at = ""
+	request.Decision_note = ""
+	request.Record_id = ""
+
+	if err := request.Validate(); err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCorrectionRequest)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 同一時間已有待審核的申請
+	count, err := collection.CountDocuments(context.Background(), bson.M{
+		"employee_id":  request.Employee_id,
+		"claimed_time": request.Claimed_time,
+		"status":       model.CorrectionStatusPending,
+	})
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if count > 0 {
+		sendError(c, 409, "已有相同時間的補登申請待審核")
+		return
+	}
+
+	if _, err := collection.InsertOne(context.Background(), request); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	c.Status(201)
+	sendJSON(c, request)
+}
+
+// findCorrections 查詢補登申請(依申請時間排序)
+func findCorrections(filter bson.M, opts *options.FindOptions) ([]model.CorrectionRequest, error) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCorrectionRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := collection.Find(context.Background(), filter, opts.SetSort(bson.M{"submitted_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	requests := []model.CorrectionRequest{}
+	err = cur.All(context.Background(), &requests)
+
+	return requests, err
+}
+
+// 取得主管待審核的補登申請
+func getPendingCorrections(c *fiber.Ctx) {
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	approverID := c.Params("approver_id")
+
+	requests, err := findCorrections(bson.M{"approver_id": approverID, "status": model.CorrectionStatusPending}, view.findOptions())
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	sendList(c, view, requests)
+}
+
+// 查詢補登申請(?employee_id=&status=&date=)
+func getCorrections(c *fiber.Ctx) {
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	filter := bson.M{}
+
+	for _, key := range []string{"employee_id", "status"} {
+		if value := c.Query(key); value != "" {
+			filter[key] = value
+		}
+	}
+
+	if c.Query("date") != "" {
+
+		date, err := model.ParseDate(c.Query("date"))
+		if err != nil {
+			sendError(c, 400, "日期格式錯誤(應為 date=YYYY-MM-DD)")
+			return
+		}
+
+		filter["date"] = date.Format(model.DateLayout)
+	}
+
+	requests, err := findCorrections(filter, view.findOptions())
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	sendList(c, view, requests)
+}
+
+// 審核補登申請(header X-Actor: 主管員工編號,body: {"decision": "approve|reject", "note": ""})
+// 核准時新增一筆補登的打卡紀錄,原始打卡紀錄保留不動
+func decideCorrection(c *fiber.Ctx) {
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		sendError(c, 400, "申請id格式錯誤")
+		return
+	}
+
+	actor, _, ok := auditContext(c, false)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Decision string `json:"decision"`
+		Note     string `json:"note"`
+	}
+
+	if err := json.Unmarshal([]byte(c.Body()), &body); err != nil {
+		sendError(c, 400, "無法解析審核資料: "+err.Error())
+		return
+	}
+
+	status := map[string]string{
+		"approve": model.CorrectionStatusApproved,
+		"reject":  model.CorrectionStatusRejected,
+	}[body.Decision]
+
+	if status == "" {
+		sendError(c, 400, "decision 必須為 approve 或 reject")
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCorrectionRequest)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var request model.CorrectionRequest
+	err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&request)
+	if err == mongo.ErrNoDocuments {
+		c.SendStatus(404)
+		return
+	}
+
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if request.Approver_id != actor {
+		sendError(c, 403, "只有申請人的直屬主管可以審核")
+		return
+	}
+
+	// 只有待審核的申請可以審核(避免重複核准)
+	err = collection.FindOneAndUpdate(
+		context.Background(),
+		bson.M{"_id": objID, "status": model.CorrectionStatusPending},
+		bson.M{"$set": bson.M{
+			"status":        status,
+			"decided_by":    actor,
+			"decided_at":    time.Now().Format(model.DateTimeLayout),
+			"decision_note": body.Note,
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&request)
+
+	if err == mongo.ErrNoDocuments {
+		sendError(c, 409, "此申請已審核")
+		return
+	}
+
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if status == model.CorrectionStatusApproved {
+
+		recordID, err := applyCorrection(request, actor)
+		if err != nil {
+
+			// 補登失敗時退回待審核
+			collection.UpdateOne(context.Background(), bson.M{"_id": objID}, bson.M{"$set": bson.M{"status": model.CorrectionStatusPending, "decided_by": "", "decided_at": "", "decision_note": ""}})
+			sendError(c, 500, err.Error())
+			return
+		}
+
+		request.Record_id = recordID
+		if _, err := collection.UpdateOne(context.Background(), bson.M{"_id": objID}, bson.M{"$set": bson.M{"record_id": recordID}}); err != nil {
+			fmt.Println("補登紀錄id寫入失敗:", err)
+		}
+	}
+
+	sendJSON(c, request)
+}
+
+// applyCorrection 新增補登的打卡紀錄並寫入異動紀錄,重新計算當天統計與出勤異常,回傳打卡紀錄id
+func applyCorrection(request model.CorrectionRequest, actor string) (string, error) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
+	if err != nil {
+		return "", err
+	}
+
+	// date 為打卡的日曆日(跨夜班隔天凌晨的下班打卡不是營業日當天),營業日另存於 business_date
+	punch, err := model.ParseCheckInTime(request.Claimed_time)
+	if err != nil {
+		return "", err
+	}
+
+	recordID := primitive.NewObjectID()
+	record := bson.M{
+		"_id":           recordID,
+		"name":          request.Name,
+		"check_in_time": request.Claimed_time,
+		"pic":           "",
+		"leave_type":    "",
+		"date":          punch.Format(model.DateLayout),
+		"department":    request.Department,
+		"position":      request.Position,
+		"business_date": request.Date,
+		"correction_id": request.ID.Hex(),
+		updatedAtField:  time.Now(),
+	}
+
+	// 先寫入異動紀錄,寫不進去就不補登
+	if err := writeAuditLog(model.AuditEntityCheckInRecord, recordID.Hex(), model.AuditActionCreate, actor, "補登打卡: "+request.Reason, nil, record); err != nil {
+		return "", err
+	}
+
+	// 補登失敗時寫入撤銷的異動紀錄,異動紀錄才不會留下不存在的新增
+	if _, err := collection.InsertOne(context.Background(), record); err != nil {
+		if auditErr := writeAuditLog(model.AuditEntityCheckInRecord, recordID.Hex(), model.AuditActionDelete, actor, "補登打卡寫入失敗,撤銷新增: "+err.Error(), record, nil); auditErr != nil {
+			fmt.Println("補登撤銷異動紀錄寫入失敗:", auditErr)
+		}
+		return "", err
+	}
+
+	date, _ := model.ParseDate(request.Date)
+
+	if _, err := materializeCheckInStatistics(date); err != nil {
+		fmt.Println(request.Date, "統計失敗:", err)
+	}
+
+	if _, err := scanExceptionsOfDate(date); err != nil {
+		fmt.Println(request.Date, "出勤異常掃描失敗:", err)
+	}
+
+	return recordID.Hex(), nil
+}
@@ -0,0 +1,381 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為可編輯資料(打卡紀錄、請假、打卡統計) 的新增、修改、刪除,每次異動都寫入異動紀錄 */
+
+// editableEntity 可透過 API 編輯的資料
+type editableEntity struct {
+	entity     string                      // 異動紀錄的資料類別
+	collection string                      // Collection名
+	fields     []string                    // 可編輯欄位(皆以字串儲存)
+	scope      bson.M                      // 限定範圍(ex: 請假只處理有假別的紀錄)
+	normalize  func(document bson.M) error // 檢查並整理完整資料
+	event      string                      // 新增後發布的 webhook 事件(空字串為不發布)
+}
+
+// checkInRecordEntity 打卡紀錄
+var checkInRecordEntity = editableEntity{
+	entity:     model.AuditEntityCheckInRecord,
+	collection: settings.CollectionNameOfCheckInRecord,
+	fields:     []string{"name", "check_in_time", "leave_type", "date", "department", "position"},
+	normalize:  normalizeCheckInRecord,
+}
+
+// leaveEntity 請假(有假別的打卡紀錄)
+var leaveEntity = editableEntity{
+	entity:     model.AuditEntityLeave,
+	collection: settings.CollectionNameOfCheckInRecord,
+	fields:     []string{"name", "leave_type", "date", "department", "position"},
+	scope:      bson.M{"leave_type": bson.M{"$nin": bson.A{nil, ""}}},
+	event:      model.WebhookEventLeaveApproved,
+	normalize: func(document bson.M) error {
+		if document["leave_type"] == "" {
+			return errors.New("假別不可為空")
+		}
+		return normalizeCheckInRecord(document)
+	},
+}
+
+// checkInStatisticsEntity 打卡統計
+var checkInStatisticsEntity = editableEntity{
+	entity:     model.AuditEntityCheckInStatistics,
+	collection: settings.CollectionNameOfCheckInStatistics,
+	fields:     []string{"date", "expected", "attendance", "not_arrived", "guests"},
+	normalize:  normalizeCheckInStatistics,
+}
+
+// normalizeCheckInRecord 檢查打卡紀錄,日期與打卡時間統一補零
+// 日期或打卡時間改變後營業日需要重新彙整,因此清除 business_date(查詢時改以 date 為準)
+func normalizeCheckInRecord(document bson.M) error {
+
+	if document["name"] == "" {
+		return errors.New("姓名不可為空")
+	}
+
+	date, err := model.ParseDate(fmt.Sprint(document["date"]))
+	if err != nil {
+		return errors.New("日期格式錯誤(應為YYYY-MM-DD)")
+	}
+	document["date"] = date.Format(model.DateLayout)
+
+	if checkInTime := fmt.Sprint(document["check_in_time"]); checkInTime != "" {
+
+		punch, err := model.ParseCheckInTime(checkInTime)
+		if err != nil {
+			return errors.New("打卡時間格式錯誤(應為YYYY-MM-DD HH:MM:SS)")
+		}
+		document["check_in_time"] = punch.Format(model.DateTimeLayout)
+	}
+
+	document["business_date"] = ""
+
+	return nil
+}
+
+// normalizeCheckInStatistics 檢查打卡統計(數字沿用既有格式以字串儲存)
+func normalizeCheckInStatistics(document bson.M) error {
+
+	date, err := model.ParseDate(fmt.Sprint(document["date"]))
+	if err != nil {
+		return errors.New("日期格式錯誤(應為YYYY-MM-DD)")
+	}
+	document["date"] = date.Format(model.DateLayout)
+
+	for _, key := range []string{"expected", "attendance", "not_arrived", "guests"} {
+
+		value := fmt.Sprint(document[key])
+		if value == "" {
+			value = "0"
+		}
+
+		if number, err := strconv.Atoi(value); err != nil || number < 0 {
+			return fmt.Errorf("%s 必須為非負整數", key)
+		}
+
+		document[key] = value
+	}
+
+	return nil
+}
+
+// editableFields 從 request body 取出可編輯欄位(數字轉為字串)
+func editableFields(c *fiber.Ctx, fields []string) (bson.M, error) {
+
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(c.Body()), &body); err != nil {
+		return nil, errors.New("無法解析資料: " + err.Error())
+	}
+
+	result := bson.M{}
+
+	for _, field := range fields {
+
+		value, ok := body[field]
+		if !ok {
+			continue
+		}
+
+		switch v := value.(type) {
+		case nil:
+			result[field] = ""
+		case string:
+			result[field] = v
+		case float64:
+			result[field] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return nil, fmt.Errorf("%s 必須為字串或數字", field)
+		}
+	}
+
+	return result, nil
+}
+
+// scopedFilter 依id查詢,並限定在資料範圍內
+func (entity editableEntity) scopedFilter(objID primitive.ObjectID) bson.M {
+
+	filter := bson.M{"_id": objID}
+	for key, value := range entity.scope {
+		filter[key] = value
+	}
+
+	return filter
+}
+
+// createHandler 新增資料
+func (entity editableEntity) createHandler(c *fiber.Ctx) {
+
+	actor, reason, ok := auditContext(c, false)
+	if !ok {
+		return
+	}
+
+	document, err := editableFields(c, entity.fields)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	// 沒有給的欄位以空字串儲存,與既有資料一致
+	for _, field := range entity.fields {
+		if _, ok := document[field]; !ok {
+			document[field] = ""
+		}
+	}
+
+	if err := entity.normalize(document); err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	objID := primitive.NewObjectID()
+	document["_id"] = objID
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, entity.collection)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 先寫入異動紀錄,寫不進去就不異動資料
+	if err := writeAuditLog(entity.entity, objID.Hex(), model.AuditActionCreate, actor, reason, nil, document); err != nil {
+		sendError(c, 500, "異動紀錄寫入失敗: "+err.Error())
+		return
+	}
+
+	document[updatedAtField] = time.Now()
+	if _, err := collection.InsertOne(context.Background(), document); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if entity.event != "" {
+		publishWebhookEvent(entity.event, document)
+	}
+
+	c.Status(201)
+	sendJSON(c, document)
+}
+
+// updateHandler 修改資料(只更新 body 中有給的欄位)
+func (entity editableEntity) updateHandler(c *fiber.Ctx) {
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		sendError(c, 400, "id格式錯誤")
+		return
+	}
+
+	actor, reason, ok := auditContext(c, true)
+	if !ok {
+		return
+	}
+
+	changes, err := editableFields(c, entity.fields)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, entity.collection)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var before bson.M
+	err = collection.FindOne(context.Background(), entity.scopedFilter(objID)).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		c.SendStatus(404)
+		return
+	}
+
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 以修改後的完整資料檢查
+	document := bson.M{}
+	for _, field := range entity.fields {
+		document[field] = ""
+		if value, ok := before[field]; ok && value != nil {
+			document[field] = fmt.Sprint(value)
+		}
+	}
+
+	for field, value := range changes {
+		document[field] = value
+	}
+
+	if err := entity.normalize(document); err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	// 先寫入異動紀錄(異動後資料為修改前資料加上這次修改的欄位),寫不進去就不異動資料
+	expected := bson.M{}
+	for field, value := range before {
+		expected[field] = value
+	}
+	for field, value := range document {
+		expected[field] = value
+	}
+
+	if err := writeAuditLog(entity.entity, objID.Hex(), model.AuditActionUpdate, actor, reason, before, expected); err != nil {
+		sendError(c, 500, "異動紀錄寫入失敗: "+err.Error())
+		return
+	}
+
+	var after bson.M
+	err = collection.FindOneAndUpdate(
+		context.Background(),
+		entity.scopedFilter(objID),
+		bson.M{"$set": document, "$currentDate": bson.M{updatedAtField: true}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&after)
+
+	if err == mongo.ErrNoDocuments {
+		c.SendStatus(404)
+		return
+	}
+
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	entity.publishLive(model.AuditActionUpdate, before, after)
+
+	delete(after, "pic")
+	sendJSON(c, after)
+}
+
+// deleteHandler 刪除資料
+func (entity editableEntity) deleteHandler(c *fiber.Ctx) {
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		sendError(c, 400, "id格式錯誤")
+		return
+	}
+
+	actor, reason, ok := auditContext(c, true)
+	if !ok {
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, entity.collection)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var before bson.M
+	err = collection.FindOne(context.Background(), entity.scopedFilter(objID)).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		c.SendStatus(404)
+		return
+	}
+
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 先寫入異動紀錄,寫不進去就不異動資料
+	if err := writeAuditLog(entity.entity, objID.Hex(), model.AuditActionDelete, actor, reason, before, nil); err != nil {
+		sendError(c, 500, "異動紀錄寫入失敗: "+err.Error())
+		return
+	}
+
+	result, err := collection.DeleteOne(context.Background(), entity.scopedFilter(objID))
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if result.DeletedCount == 0 {
+		c.SendStatus(404)
+		return
+	}
+
+	entity.publishLive(model.AuditActionDelete, before, before)
+
+	c.SendStatus(204)
+}
+
+// publishLive 打卡紀錄(含請假)修改、刪除時即時推播,改到別天時舊營業日的統計也重新計算
+// 新增的紀錄由即時推播定期檢查新資料時推播,這裡不重複推播
+func (entity editableEntity) publishLive(action string, before bson.M, after bson.M) {
+
+	if entity.collection != settings.CollectionNameOfCheckInRecord {
+		return
+	}
+
+	publishCheckIn(action, after)
+
+	if date, err := model.ParseDate(fmt.Sprint(before["date"])); err == nil {
+		liveStatistics.touch(date)
+	}
+}
@@ -0,0 +1,414 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Employee(員工、出勤月報表) 相關 functions */
+
+// findEmployee 以員工編號查詢員工,查無時以姓名查詢
+// 打卡紀錄只有姓名,尚未建立員工資料但有打卡紀錄的人也能以姓名查詢;都查無時回傳空的員工資料
+func findEmployee(id string) (model.Employee, error) {
+
+	var employee model.Employee
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfEmployee)
+	if err != nil {
+		return employee, err
+	}
+
+	err = collection.FindOne(context.Background(), bson.M{"employee_id": id}).Decode(&employee)
+	if err == mongo.ErrNoDocuments {
+		err = collection.FindOne(context.Background(), bson.M{"name": id}).Decode(&employee)
+	}
+
+	if err != mongo.ErrNoDocuments {
+		return employee, err
+	}
+
+	// 取得 collection
+	records, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
+	if err != nil {
+		return employee, err
+	}
+
+	count, err := records.CountDocuments(context.Background(), bson.M{"name": id}, options.Count().SetLimit(1))
+	if err != nil || count == 0 {
+		return employee, err
+	}
+
+	return model.Employee{Name: id}, nil
+}
+
+// loadEmployeesBetween 員工名冊加上期間內有打卡紀錄、但不在名冊中的人(依姓名排序)
+// allDepartments 為 true 時不限部門,否則只取 department 部門(空字串代表沒有部門)
+func loadEmployeesBetween(from time.Time, to time.Time, department string, allDepartments bool) ([]model.Employee, error) {
+
+	filter := businessDateRangeFilter(from, to)
+	rosterDepartment := ""
+
+	if !allDepartments {
+		filter["department"] = departmentFilter(department)
+		rosterDepartment = department
+	}
+
+	employees, err := loadEmployees(rosterDepartment)
+	if err != nil {
+		return nil, err
+	}
+
+	// 不限部門時 loadEmployees 已取全部;限定「沒有部門」時需排除有部門的人
+	if !allDepartments && department == "" {
+		var withoutDepartment []model.Employee
+		for _, employee := range employees {
+			if employee.Department == "" {
+				withoutDepartment = append(withoutDepartment, employee)
+			}
+		}
+		employees = withoutDepartment
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := collection.Distinct(context.Background(), "name", filter)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := map[string]bool{}
+	for _, employee := range employees {
+		listed[employee.Name] = true
+	}
+
+	for _, value := range names {
+		if name, ok := value.(string); ok && !listed[name] {
+			employees = append(employees, model.Employee{Name: name, Department: department})
+			listed[name] = true
+		}
+	}
+
+	sort.Slice(employees, func(i, j int) bool { return employees[i].Name < employees[j].Name })
+
+	return employees, nil
+}
+
+// 取得員工資料(可指定員工編號)
+func getEmployee(c *fiber.Ctx) {
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfEmployee)
+
+	// 若連線有誤
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var filter bson.M = bson.M{}
+
+	// 若有給id
+	if c.Params("id") != "" {
+		filter = bson.M{"employee_id": c.Params("id")}
+	}
+
+	var results []model.Employee
+	cur, err := collection.Find(context.Background(), filter, view.findOptions().SetSort(bson.M{"employee_id": 1}))
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if err = cur.All(context.Background(), &results); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 若查無資料
+	if results == nil {
+		c.SendStatus(404)
+		return
+	}
+
+	sendList(c, view, results)
+}
+
+// 新增或更新員工資料(以員工編號為key)
+func upsertEmployee(c *fiber.Ctx) {
+
+	var employee model.Employee
+	if err := json.Unmarshal([]byte(c.Body()), &employee); err != nil {
+		sendError(c, 400, "無法解析員工資料: "+err.Error())
+		return
+	}
+
+	if err := employee.Validate(); err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfEmployee)
+
+	// 若連線有誤
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var before bson.M
+	err = collection.FindOne(context.Background(), bson.M{"employee_id": employee.Employee_id}).Decode(&before)
+	if err != nil && err != mongo.ErrNoDocuments {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 修改既有員工必須說明原因
+	action := model.AuditActionCreate
+	if before != nil {
+		action = model.AuditActionUpdate
+	}
+
+	actor, reason, ok := auditContext(c, action == model.AuditActionUpdate)
+	if !ok {
+		return
+	}
+
+	// 先寫入異動紀錄,寫不進去就不異動資料
+	if err := writeAuditLog(model.AuditEntityEmployee, employee.Employee_id, action, actor, reason, before, employee); err != nil {
+		sendError(c, 500, "異動紀錄寫入失敗: "+err.Error())
+		return
+	}
+
+	_, err = collection.ReplaceOne(context.Background(), bson.M{"employee_id": employee.Employee_id}, employee, options.Replace().SetUpsert(true))
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	sendJSON(c, employee)
+}
+
+// 刪除員工資料(打卡紀錄不受影響)
+func deleteEmployee(c *fiber.Ctx) {
+
+	actor, reason, ok := auditContext(c, true)
+	if !ok {
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfEmployee)
+
+	// 若連線有誤
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var before bson.M
+	err = collection.FindOne(context.Background(), bson.M{"employee_id": c.Params("id")}).Decode(&before)
+	if err == mongo.ErrNoDocuments {
+		c.SendStatus(404)
+		return
+	}
+
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 先寫入異動紀錄,寫不進去就不異動資料
+	if err := writeAuditLog(model.AuditEntityEmployee, c.Params("id"), model.AuditActionDelete, actor, reason, before, nil); err != nil {
+		sendError(c, 500, "異動紀錄寫入失敗: "+err.Error())
+		return
+	}
+
+	result, err := collection.DeleteOne(context.Background(), bson.M{"employee_id": c.Params("id")})
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if result.DeletedCount == 0 {
+		c.SendStatus(404)
+		return
+	}
+
+	c.SendStatus(204)
+}
+
+// buildTimesheet 產生員工出勤月報表
+func buildTimesheet(employee model.Employee, month string, from time.Time, to time.Time) (model.Timesheet, error) {
+
+	timesheet := model.Timesheet{
+		Employee_id: employee.Employee_id,
+		Name:        employee.Name,
+		Department:  employee.Department,
+		Month:       month,
+		Totals:      model.TimesheetTotals{Leave_by_type: map[string]int{}},
+	}
+
+	if err := checkNotAnonymized(from, to); err != nil {
+		return timesheet, err
+	}
+
+	attendances, err := loadDailyAttendance(from, to, bson.M{"name": employee.Name})
+	if err != nil {
+		return timesheet, err
+	}
+
+	table, err := loadShiftTable()
+	if err != nil {
+		return timesheet, err
+	}
+
+	holidays, err := loadHolidays(from, to)
+	if err != nil {
+		return timesheet, err
+	}
+
+	attendanceOfDate := map[string]*dailyAttendance{}
+	for _, attendance := range attendances {
+		attendanceOfDate[attendance.Date.Format(model.DateLayout)] = attendance
+		if timesheet.Department == "" {
+			timesheet.Department = attendance.Department
+		}
+	}
+
+	shift, assignment := table.lookup(employee.Name)
+	now := time.Now()
+
+	for _, date := range datesBetween(from, to) {
+
+		day := model.TimesheetDay{
+			Date:       date.Format(model.DateLayout),
+			Day_type:   model.DayType(date, holidays, assignment),
+			Shift_code: shift.Code,
+		}
+
+		attendance, ok := attendanceOfDate[day.Date]
+		if ok {
+
+			firstIn, hasIn := attendance.firstIn()
+			lastOut, hasOut := attendance.lastOut()
+
+			if hasIn {
+				day.First_in = firstIn.Format(model.DateTimeLayout)
+			}
+
+			if hasOut {
+				day.Last_out = lastOut.Format(model.DateTimeLayout)
+				day.Worked_minutes = workedMinutes(firstIn, lastOut)
+			}
+
+			switch {
+			case attendance.Leave_type != "":
+				day.Status = model.TimesheetStatusLeave
+				day.Leave_type = attendance.Leave_type
+			case !hasIn:
+				day.Status = model.TimesheetStatusAbsent
+			default:
+				day.Status = model.TimesheetStatusPresent
+
+				// 只有工作日才判斷遲到
+				late := int(firstIn.Sub(shift.StartAt(date)) / time.Minute)
+				if day.Day_type == model.DayTypeWorkday && late > settings.LateGraceMinutes {
+					day.Status = model.TimesheetStatusLate
+					day.Late_minutes = late
+				}
+			}
+
+		} else {
+
+			switch {
+			case day.Day_type != model.DayTypeWorkday:
+				day.Status = model.TimesheetStatusHoliday
+			case shiftNotStarted(shift, date, now):
+				day.Status = model.TimesheetStatusUpcoming
+			default:
+				day.Status = model.TimesheetStatusAbsent
+			}
+
+		}
+
+		switch day.Status {
+		case model.TimesheetStatusPresent:
+			timesheet.Totals.Present_days++
+		case model.TimesheetStatusLate:
+			timesheet.Totals.Present_days++
+			timesheet.Totals.Late_days++
+		case model.TimesheetStatusLeave:
+			timesheet.Totals.Leave_days++
+			timesheet.Totals.Leave_by_type[day.Leave_type]++
+		case model.TimesheetStatusHoliday:
+			timesheet.Totals.Holiday_days++
+		case model.TimesheetStatusAbsent:
+			timesheet.Totals.Absent_days++
+		}
+
+		timesheet.Totals.Worked_minutes += day.Worked_minutes
+		timesheet.Totals.Late_minutes += day.Late_minutes
+		timesheet.Days = append(timesheet.Days, day)
+	}
+
+	return timesheet, nil
+}
+
+// 取得員工指定月份的出勤月報表
+func getTimesheet(c *fiber.Ctx) {
+
+	month := c.Query("month")
+
+	from, to, err := parseMonth(month)
+	if err != nil {
+		sendError(c, 400, "月份格式錯誤(應為 month=YYYY-MM)")
+		return
+	}
+
+	employee, err := findEmployee(c.Params("id"))
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 若查無員工
+	if employee.Name == "" {
+		c.SendStatus(404)
+		return
+	}
+
+	fmt.Println("查詢員工=", employee.Name, "月份=", month)
+
+	timesheet, err := buildTimesheet(employee, month, from, to)
+	if err != nil {
+		sendError(c, aggregateErrorStatus(err), err.Error())
+		return
+	}
+
+	sendJSON(c, timesheet)
+}
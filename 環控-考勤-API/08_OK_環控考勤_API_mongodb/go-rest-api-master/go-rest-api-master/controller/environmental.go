@@ -0,0 +1,513 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+	"my-rest-api/timeseries"
+)
+
+/* 以下為 Environmental(環控時間序列資料) 相關 functions */
+
+// parseEnvTime 解析 RFC 3339 時間(ex: 2020-01-01T08:00:00+08:00)
+func parseEnvTime(name string, value string) (time.Time, error) {
+
+	// 網址中未編碼的 + 會變成空白(ex: 08:00:00 08:00)
+	t, err := time.Parse(time.RFC3339, strings.Replace(value, " ", "+", 1))
+	if err != nil {
+		return t, errors.New(name + " 時間格式錯誤(應為 RFC 3339,ex: 2020-01-01T08:00:00+08:00)")
+	}
+
+	return t, nil
+}
+
+// parseEnvRange 解析 ?from=&to=(RFC 3339),未指定 to 為現在,未指定 from 為 to 往前 settings.EnvDefaultRangeHours 小時
+func parseEnvRange(c *fiber.Ctx) (time.Time, time.Time, error) {
+
+	to := time.Now()
+	if c.Query("to") != "" {
+
+		var err error
+		if to, err = parseEnvTime("to", c.Query("to")); err != nil {
+			return to, to, err
+		}
+	}
+
+	from := to.Add(-time.Duration(settings.EnvDefaultRangeHours) * time.Hour)
+	if c.Query("from") != "" {
+
+		var err error
+		if from, err = parseEnvTime("from", c.Query("from")); err != nil {
+			return from, to, err
+		}
+	}
+
+	if !from.Before(to) {
+		return from, to, errors.New("from 必須早於 to")
+	}
+
+	if to.Sub(from) > time.Duration(settings.EnvMaxRangeDays)*24*time.Hour {
+		return from, to, fmt.Errorf("查詢區間不可超過 %d 天", settings.EnvMaxRangeDays)
+	}
+
+	return from, to, nil
+}
+
+// parseEnvLimit 解析 ?limit=(預設 settings.EnvDefaultLimit,上限 settings.EnvMaxLimit)
+func parseEnvLimit(c *fiber.Ctx) (int, error) {
+
+	if c.Query("limit") == "" {
+		return settings.EnvDefaultLimit, nil
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 || limit > settings.EnvMaxLimit {
+		return 0, fmt.Errorf("limit 必須為 1 到 %d 的整數", settings.EnvMaxLimit)
+	}
+
+	return limit, nil
+}
+
+// setEnvCacheControl 查詢期間(from <= time < to)早於現在 settings.EnvSettleMinutes 分鐘以上時允許快取,否則每次都要確認
+func setEnvCacheControl(c *fiber.Ctx, to time.Time) {
+
+	if time.Since(to) < time.Duration(settings.EnvSettleMinutes)*time.Minute {
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		return
+	}
+
+	c.Set(fiber.HeaderCacheControl, "private, max-age="+strconv.Itoa(settings.ClosedDateMaxAgeSeconds))
+}
+
+// envLegacyMetric 舊資料沒有 metric 欄位,查詢時視為 score
+var envLegacyMetric = bson.M{"$ifNull": bson.A{"$metric", model.MetricScore}}
+
+// parseEnvFilter 解析 ?sensor=A,B&metric=co2,pm25&location=101會議室,產生期間內(from <= time < to)的查詢條件
+// location 依感測器登記的位置換成 sensor_id;metric=score 包含沒有 metric 欄位的舊資料
+func parseEnvFilter(c *fiber.Ctx, from time.Time, to time.Time) (bson.M, error) {
+
+	conditions := bson.A{bson.M{"time": bson.M{"$gte": from, "$lt": to}}}
+
+	if sensors := splitQueryList(c.Query("sensor")); len(sensors) > 0 {
+		conditions = append(conditions, bson.M{"sensor_id": bson.M{"$in": sensors}})
+	}
+
+	if metrics := splitQueryList(c.Query("metric")); len(metrics) > 0 {
+
+		for _, metric := range metrics {
+			if metric != model.MetricScore && !model.IsMetric(metric) {
+				return nil, errors.New("不支援的量測項目: " + metric)
+			}
+		}
+
+		condition := bson.A{bson.M{"metric": bson.M{"$in": metrics}}}
+		if containsString(metrics, model.MetricScore) {
+			condition = append(condition, bson.M{"metric": bson.M{"$exists": false}})
+		}
+
+		conditions = append(conditions, bson.M{"$or": condition})
+	}
+
+	if locations := splitQueryList(c.Query("location")); len(locations) > 0 {
+
+		sensors, err := findSensors(bson.M{"location": bson.M{"$in": locations}})
+		if err != nil {
+			return nil, err
+		}
+
+		sensorIDs := []string{}
+		for _, sensor := range sensors {
+			sensorIDs = append(sensorIDs, sensor.Sensor_id)
+		}
+
+		conditions = append(conditions, bson.M{"sensor_id": bson.M{"$in": sensorIDs}})
+	}
+
+	if len(conditions) == 1 {
+		return conditions[0].(bson.M), nil
+	}
+
+	return bson.M{"$and": conditions}, nil
+}
+
+// findEnvironmentalData 查詢符合條件的環控紀錄(依時間排序)
+func findEnvironmentalData(filter bson.M, limit int) ([]model.EnvironmentalData, error) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvSecondRecord)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := collection.Find(
+		context.Background(),
+		filter,
+		options.Find().SetSort(bson.D{{Key: "time", Value: 1}, {Key: "sensor_id", Value: 1}}).SetLimit(int64(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []model.EnvironmentalData{}
+	if err := cur.All(context.Background(), &results); err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		if results[i].Metric == "" {
+			results[i].Metric = model.MetricScore
+		}
+	}
+
+	return results, nil
+}
+
+// 查詢環控紀錄(/env/readings?from=&to=&limit=,時間為 RFC 3339;可加 &sensor=&metric=&location= 篩選)
+// 筆數達到 limit 時 header X-Result-Truncated: true,可用最後一筆的時間作為下一次的 from 繼續查詢
+func getEnvironmentalReadings(c *fiber.Ctx) {
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	from, to, err := parseEnvRange(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	limit, err := parseEnvLimit(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	filter, err := parseEnvFilter(c, from, to)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	// 資料沒有異動時直接回應 304,不查詢資料
+	if notModified(c, settings.EnvDbName, settings.CollectionNameOfEnvSecondRecord, filter) {
+		setEnvCacheControl(c, to)
+		return
+	}
+
+	// 多查一筆判斷是否還有資料
+	results, err := findEnvironmentalData(filter, limit+1)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if len(results) > limit {
+		results = results[:limit]
+		c.Set("X-Result-Truncated", "true")
+	}
+
+	// 已結算的日期允許快取
+	setEnvCacheControl(c, to)
+	sendList(c, view, results)
+}
+
+// envIntervals 可用的彙總區間
+var envIntervals = map[string]time.Duration{
+	"1m": time.Minute,
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// envBucketPipeline 依感測器、量測項目、區間彙總的 aggregation pipeline
+// 區間開始時間 = time - ((time - 1970-01-01 + 時區偏移) mod 區間),1d 區間從當地午夜開始
+func envBucketPipeline(filter bson.M, interval time.Duration) mongo.Pipeline {
+
+	_, offset := time.Now().Zone()
+	epoch := time.Unix(0, 0).UTC()
+	ms := interval.Milliseconds()
+
+	return mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$sort", Value: bson.M{"time": 1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"sensor_id": bson.M{"$ifNull": bson.A{"$sensor_id", ""}},
+				"metric":    envLegacyMetric,
+				"time": bson.M{"$subtract": bson.A{
+					"$time",
+					bson.M{"$mod": bson.A{
+						bson.M{"$add": bson.A{bson.M{"$subtract": bson.A{"$time", epoch}}, int64(offset) * 1000}},
+						ms,
+					}},
+				}},
+			},
+			"min":       bson.M{"$min": "$score"},
+			"max":       bson.M{"$max": "$score"},
+			"avg":       bson.M{"$avg": "$score"},
+			"count":     bson.M{"$sum": 1},
+			"last":      bson.M{"$last": "$score"},
+			"last_time": bson.M{"$last": "$time"},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":       0,
+			"sensor_id": "$_id.sensor_id",
+			"metric":    "$_id.metric",
+			"time":      "$_id.time",
+			"min":       1,
+			"max":       1,
+			"avg":       1,
+			"count":     1,
+			"last":      1,
+			"last_time": 1,
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "sensor_id", Value: 1}, {Key: "metric", Value: 1}, {Key: "time", Value: 1}}}},
+	}
+}
+
+// aggregateEnvironmentalData 依區間彙總符合條件的環控紀錄(最小、最大、平均、筆數、最後一筆)
+func aggregateEnvironmentalData(filter bson.M, interval time.Duration) ([]model.EnvironmentalBucket, error) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvSecondRecord)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := collection.Aggregate(context.Background(), envBucketPipeline(filter, interval), options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := []model.EnvironmentalBucket{}
+	err = cur.All(context.Background(), &buckets)
+
+	return buckets, err
+}
+
+// envSeries 一個感測器的一個量測項目(舊資料兩者皆為空字串)
+type envSeries struct {
+	Sensor_id string `bson:"sensor_id"`
+	Metric    string `bson:"metric"`
+}
+
+// countEnvironmentalSeries 統計符合條件的每個序列筆數
+func countEnvironmentalSeries(collection *mongo.Collection, filter bson.M) (map[envSeries]int, error) {
+
+	cur, err := collection.Aggregate(context.Background(), mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"sensor_id": "$sensor_id", "metric": "$metric"},
+			"count": bson.M{"$sum": 1},
+		}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []struct {
+		Series envSeries `bson:"_id"`
+		Count  int       `bson:"count"`
+	}
+	if err := cur.All(context.Background(), &groups); err != nil {
+		return nil, err
+	}
+
+	counts := map[envSeries]int{}
+	for _, group := range groups {
+		counts[group.Series] = group.Count
+	}
+
+	return counts, nil
+}
+
+// ensureEnvIndexes 建立環控紀錄依序列(感測器 + 量測項目)與時間排序的索引,以及查詢未結束警報的索引
+// 降採樣依序列讀出所有紀錄、警報檢查依時間逐筆讀出每個序列的紀錄,沒有索引時需要掃描並在記憶體中排序
+func ensureEnvIndexes() {
+
+	keys := bson.D{{Key: "sensor_id", Value: 1}, {Key: "metric", Value: 1}, {Key: "time", Value: 1}}
+	if err := db.EnsureMongoDbIndex(settings.EnvDbName, settings.CollectionNameOfEnvSecondRecord, keys); err != nil {
+		fmt.Println("環控紀錄建立索引失敗:", err)
+	}
+
+	keys = bson.D{{Key: "rule_id", Value: 1}, {Key: "sensor_id", Value: 1}, {Key: "status", Value: 1}}
+	if err := db.EnsureMongoDbIndex(settings.EnvDbName, settings.CollectionNameOfEnvAlert, keys); err != nil {
+		fmt.Println("環控警報建立索引失敗:", err)
+	}
+
+	// 警報依寫入順序(_id)取出各序列新寫入的紀錄
+	keys = bson.D{{Key: "sensor_id", Value: 1}, {Key: "metric", Value: 1}, {Key: "_id", Value: 1}}
+	if err := db.EnsureMongoDbIndex(settings.EnvDbName, settings.CollectionNameOfEnvSecondRecord, keys); err != nil {
+		fmt.Println("環控紀錄建立索引失敗:", err)
+	}
+
+	keys = bson.D{{Key: "rule_id", Value: 1}, {Key: "sensor_id", Value: 1}}
+	if err := db.EnsureMongoDbIndex(settings.EnvDbName, settings.CollectionNameOfEnvAlertCursor, keys); err != nil {
+		fmt.Println("環控警報檢查進度建立索引失敗:", err)
+	}
+}
+
+// downsampleEnvironmentalData 以 LTTB 把每個序列(感測器 + 量測項目)各降為 points 個點(保留峰值、谷值,適合畫圖)
+func downsampleEnvironmentalData(filter bson.M, points int) ([]model.EnvironmentalData, error) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvSecondRecord)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := countEnvironmentalSeries(collection, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// 依序列排序,同一序列的紀錄連續讀出
+	cur, err := collection.Find(
+		context.Background(),
+		filter,
+		options.Find().
+			SetSort(bson.D{{Key: "sensor_id", Value: 1}, {Key: "metric", Value: 1}, {Key: "time", Value: 1}}).
+			SetProjection(bson.M{"time": 1, "sensor_id": 1, "metric": 1, "score": 1}).
+			SetBatchSize(settings.EnvCursorBatchSize),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(context.Background())
+
+	results := []model.EnvironmentalData{}
+
+	var series envSeries
+	var lttb *timeseries.LTTB
+
+	// flush 輸出目前序列的降取樣結果
+	flush := func() {
+
+		if lttb == nil {
+			return
+		}
+
+		metric := series.Metric
+		if metric == "" {
+			metric = model.MetricScore
+		}
+
+		for _, point := range lttb.Result() {
+			results = append(results, model.EnvironmentalData{Time: point.Time, Sensor_id: series.Sensor_id, Metric: metric, Score: point.Value})
+		}
+	}
+
+	// 逐筆讀取,不把整個期間的資料放進記憶體
+	for cur.Next(context.Background()) {
+
+		var data model.EnvironmentalData
+		if err := cur.Decode(&data); err != nil {
+			return nil, err
+		}
+
+		current := envSeries{Sensor_id: data.Sensor_id, Metric: data.Metric}
+		if lttb == nil || current != series {
+			flush()
+			series = current
+			lttb = timeseries.NewLTTB(counts[series], points)
+		}
+
+		lttb.Add(timeseries.Point{Time: data.Time, Value: data.Score})
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	flush()
+
+	return results, nil
+}
+
+// 彙總環控紀錄(/env/readings/aggregate?from=&to=,時間為 RFC 3339;可加 &sensor=&metric=&location= 篩選)
+// 每個感測器、量測項目分開計算
+// 區間彙總: &interval=1m|5m|1h|1d,回傳每個區間的 min、max、avg、count、last
+// 圖表降取樣: &mode=lttb&points=500,回傳固定點數的原始紀錄
+func getEnvironmentalAggregate(c *fiber.Ctx) {
+
+	from, to, err := parseEnvRange(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	filter, err := parseEnvFilter(c, from, to)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	// 資料沒有異動時直接回應 304,不查詢資料
+	if notModified(c, settings.EnvDbName, settings.CollectionNameOfEnvSecondRecord, filter) {
+		setEnvCacheControl(c, to)
+		return
+	}
+
+	switch c.Query("mode", "buckets") {
+
+	case "buckets":
+
+		interval, ok := envIntervals[c.Query("interval", "1h")]
+		if !ok {
+			sendError(c, 400, "interval 必須為 1m、5m、1h 或 1d")
+			return
+		}
+
+		if to.Sub(from)/interval > time.Duration(settings.EnvMaxBuckets) {
+			sendError(c, 400, fmt.Sprintf("區間數不可超過 %d,請縮短查詢期間或加大 interval", settings.EnvMaxBuckets))
+			return
+		}
+
+		buckets, err := aggregateEnvironmentalData(filter, interval)
+		if err != nil {
+			sendError(c, 500, err.Error())
+			return
+		}
+
+		setEnvCacheControl(c, to)
+		sendJSON(c, buckets)
+
+	case "lttb":
+
+		points := settings.EnvDefaultPoints
+		if c.Query("points") != "" {
+			points, err = strconv.Atoi(c.Query("points"))
+			if err != nil || points < 3 || points > settings.EnvMaxPoints {
+				sendError(c, 400, fmt.Sprintf("points 必須為 3 到 %d 的整數", settings.EnvMaxPoints))
+				return
+			}
+		}
+
+		results, err := downsampleEnvironmentalData(filter, points)
+		if err != nil {
+			sendError(c, 500, err.Error())
+			return
+		}
+
+		setEnvCacheControl(c, to)
+		sendJSON(c, results)
+
+	default:
+		sendError(c, 400, "mode 必須為 buckets 或 lttb")
+	}
+}
@@ -0,0 +1,1025 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Environmental alert(環控警報規則與警報) 相關 functions */
+
+// envAlertActive 未結束的警報狀態
+var envAlertActive = bson.M{"$in": bson.A{model.AlertStatusOpen, model.AlertStatusAcknowledged}}
+
+// envAlertTrigger 記錄有新紀錄寫入的感測器,由警報檢查程序處理
+type envAlertTrigger struct {
+	sync.Mutex
+	dirty   chan struct{}
+	sensors map[string]bool
+}
+
+// envAlerts :全域的警報檢查觸發
+var envAlerts = &envAlertTrigger{
+	dirty:   make(chan struct{}, 1),
+	sensors: map[string]bool{},
+}
+
+// touch 標記感測器需要重新檢查警報
+func (trigger *envAlertTrigger) touch(sensorIDs []string) {
+
+	trigger.Lock()
+	for _, sensorID := range sensorIDs {
+		trigger.sensors[sensorID] = true
+	}
+	trigger.Unlock()
+
+	select {
+	case trigger.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// take 取出被標記的感測器
+func (trigger *envAlertTrigger) take() map[string]bool {
+
+	trigger.Lock()
+	defer trigger.Unlock()
+
+	sensors := trigger.sensors
+	trigger.sensors = map[string]bool{}
+
+	return sensors
+}
+
+// findEnvAlertRules 查詢警報規則
+func findEnvAlertRules(filter bson.M) ([]model.EnvironmentalAlertRule, error) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvAlertRule)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := collection.Find(context.Background(), filter, options.Find().SetSort(bson.M{"rule_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	results := []model.EnvironmentalAlertRule{}
+	err = cur.All(context.Background(), &results)
+
+	return results, err
+}
+
+// envBreachFilter 超過(breached 為 false 時為未超過)門檻的紀錄條件
+func envBreachFilter(rule model.EnvironmentalAlertRule, breached bool) bson.M {
+
+	operator := "$gt"
+	switch {
+	case rule.Operator == model.AlertOperatorBelow && breached:
+		operator = "$lt"
+	case rule.Operator == model.AlertOperatorBelow:
+		operator = "$gte"
+	case !breached:
+		operator = "$lte"
+	}
+
+	return bson.M{operator: rule.Threshold}
+}
+
+// findEnvReading 查詢一筆環控紀錄(查無資料回傳 nil)
+func findEnvReading(collection *mongo.Collection, filter bson.M, sort bson.D) (*model.EnvironmentalData, error) {
+
+	var reading model.EnvironmentalData
+	err := collection.FindOne(context.Background(), filter, options.FindOne().SetSort(sort)).Decode(&reading)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &reading, nil
+}
+
+// envBreachStart 找出最近一段連續超過門檻的開始紀錄(latest 為超過門檻的最新一筆)
+// 感測器離線期間沒有紀錄,視為延續前後的狀態
+func envBreachStart(collection *mongo.Collection, rule model.EnvironmentalAlertRule, sensor model.Sensor, latest model.EnvironmentalData) (*model.EnvironmentalData, error) {
+
+	series := bson.M{"sensor_id": sensor.Sensor_id, "metric": sensor.Metric}
+
+	// 最近一筆未超過門檻的紀錄
+	lastNormal, err := findEnvReading(collection, bson.M{
+		"sensor_id": sensor.Sensor_id,
+		"metric":    sensor.Metric,
+		"time":      bson.M{"$lte": latest.Time},
+		"score":     envBreachFilter(rule, false),
+	}, bson.D{{Key: "time", Value: -1}})
+	if err != nil {
+		return nil, err
+	}
+
+	if lastNormal != nil {
+		series["time"] = bson.M{"$gt": lastNormal.Time}
+	}
+
+	return findEnvReading(collection, series, bson.D{{Key: "time", Value: 1}})
+}
+
+// openEnvAlert 發出警報,期間最嚴重的數值取開始到最新一筆之間,回傳發出的警報
+func openEnvAlert(collection *mongo.Collection, rule model.EnvironmentalAlertRule, sensor model.Sensor, start model.EnvironmentalData, latest model.EnvironmentalData, now time.Time) (*model.EnvironmentalAlert, error) {
+
+	// 取得 collection
+	alerts, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvAlert)
+	if err != nil {
+		return nil, err
+	}
+
+	direction := -1
+	if rule.Operator == model.AlertOperatorBelow {
+		direction = 1
+	}
+
+	peak, err := findEnvReading(collection, bson.M{
+		"sensor_id": sensor.Sensor_id,
+		"metric":    sensor.Metric,
+		"time":      bson.M{"$gte": start.Time, "$lte": latest.Time},
+	}, bson.D{{Key: "score", Value: direction}})
+	if err != nil {
+		return nil, err
+	}
+
+	if peak == nil {
+		peak = &latest
+	}
+
+	alert := model.EnvironmentalAlert{
+		Rule_id:          rule.Rule_id,
+		Rule_name:        rule.Name,
+		Sensor_id:        sensor.Sensor_id,
+		Location:         sensor.Location,
+		Metric:           sensor.Metric,
+		Operator:         rule.Operator,
+		Threshold:        rule.Threshold,
+		Duration_seconds: rule.Duration_seconds,
+		Status:           model.AlertStatusOpen,
+		Started_at:       start.Time,
+		Opened_at:        now,
+		Peak_value:       peak.Score,
+		Last_value:       latest.Score,
+		Last_time:        latest.Time,
+		History: []model.EnvironmentalAlertEvent{
+			{Time: now, Status: model.AlertStatusOpen, Value: latest.Score, Note: fmt.Sprintf("%s %s %g 持續 %d 秒", sensor.Metric, rule.Operator, rule.Threshold, rule.Duration_seconds)},
+		},
+	}
+
+	result, err := alerts.InsertOne(context.Background(), alert)
+	if err != nil {
+		return nil, err
+	}
+
+	alert.ID, _ = result.InsertedID.(primitive.ObjectID)
+
+	fmt.Println("發出環控警報 規則=", rule.Rule_id, "感測器=", sensor.Sensor_id, "數值=", latest.Score)
+	publishWebhookEvent(model.WebhookEventEnvAlertOpened, alert)
+
+	return &alert, nil
+}
+
+// updateEnvAlert 更新未結束的警報: 回到門檻內(含緩衝)時結束,否則更新最新數值與最嚴重的數值
+func updateEnvAlert(alert model.EnvironmentalAlert, rule model.EnvironmentalAlertRule, latest model.EnvironmentalData, now time.Time) error {
+
+	// 取得 collection
+	alerts, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvAlert)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": alert.ID, "status": envAlertActive}
+
+	if !rule.Cleared(latest.Score) {
+
+		peak := "$max"
+		if rule.Operator == model.AlertOperatorBelow {
+			peak = "$min"
+		}
+
+		_, err := alerts.UpdateOne(context.Background(), filter, bson.M{
+			"$set": bson.M{"last_value": latest.Score, "last_time": latest.Time},
+			peak:   bson.M{"peak_value": latest.Score},
+		})
+
+		return err
+	}
+
+	err = alerts.FindOneAndUpdate(
+		context.Background(),
+		filter,
+		bson.M{
+			"$set":  bson.M{"status": model.AlertStatusResolved, "resolved_at": now, "last_value": latest.Score, "last_time": latest.Time},
+			"$push": bson.M{"history": model.EnvironmentalAlertEvent{Time: now, Status: model.AlertStatusResolved, Value: latest.Score, Note: "已恢復正常"}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&alert)
+
+	// 同時被其他流程結束
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("環控警報恢復正常 規則=", rule.Rule_id, "感測器=", alert.Sensor_id, "數值=", latest.Score)
+	publishWebhookEvent(model.WebhookEventEnvAlertResolved, alert)
+
+	return nil
+}
+
+// resolveEnvAlerts 結束符合條件的未結束警報並通知其他系統(規則刪除、停用,或感測器刪除、停用)
+func resolveEnvAlerts(filter bson.M, note string, now time.Time) error {
+
+	// 取得 collection
+	alerts, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvAlert)
+	if err != nil {
+		return err
+	}
+
+	active := bson.M{"status": envAlertActive}
+	for key, value := range filter {
+		active[key] = value
+	}
+
+	// 逐筆結束,每筆都要發出通知
+	for {
+
+		var alert model.EnvironmentalAlert
+		err := alerts.FindOneAndUpdate(
+			context.Background(),
+			active,
+			bson.M{
+				"$set":  bson.M{"status": model.AlertStatusResolved, "resolved_at": now},
+				"$push": bson.M{"history": model.EnvironmentalAlertEvent{Time: now, Status: model.AlertStatusResolved, Note: note}},
+			},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&alert)
+
+		if err == mongo.ErrNoDocuments {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("環控警報結束 規則=", alert.Rule_id, "感測器=", alert.Sensor_id, note)
+		publishWebhookEvent(model.WebhookEventEnvAlertResolved, alert)
+	}
+}
+
+// resolveOrphanEnvAlerts 結束已不再檢查的警報: 規則停用或刪除、感測器停用或刪除、規則不再適用此感測器
+func resolveOrphanEnvAlerts(rules map[string]model.EnvironmentalAlertRule, sensors map[string]model.Sensor, now time.Time) error {
+
+	// 取得 collection
+	alerts, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvAlert)
+	if err != nil {
+		return err
+	}
+
+	cur, err := alerts.Find(context.Background(), bson.M{"status": envAlertActive}, options.Find().SetProjection(bson.M{"rule_id": 1, "sensor_id": 1}))
+	if err != nil {
+		return err
+	}
+
+	var active []model.EnvironmentalAlert
+	if err := cur.All(context.Background(), &active); err != nil {
+		return err
+	}
+
+	for _, alert := range active {
+
+		rule, ruleOK := rules[alert.Rule_id]
+		sensor, sensorOK := sensors[alert.Sensor_id]
+
+		note := ""
+		switch {
+		case !ruleOK:
+			note = "規則已停用或刪除"
+		case !sensorOK:
+			note = "感測器已停用或刪除"
+		case sensor.Metric != rule.Metric || (rule.Sensor_id != "" && rule.Sensor_id != sensor.Sensor_id):
+			note = "規則已不適用此感測器"
+		default:
+			continue
+		}
+
+		if err := resolveEnvAlerts(bson.M{"_id": alert.ID}, note, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// envAlertCursor 規則、感測器已檢查到的紀錄(依寫入順序的 _id),補傳的舊紀錄寫入後 _id 仍較新,一樣會被檢查
+type envAlertCursor struct {
+	Rule_id   string
+	Sensor_id string
+	Last_id   primitive.ObjectID
+}
+
+// envAlertCheckpoint 取得規則、感測器已檢查到的紀錄 _id,第一次檢查時從 EnvAlertStaleSeconds 秒前寫入的紀錄開始
+func envAlertCheckpoint(cursors *mongo.Collection, rule model.EnvironmentalAlertRule, sensor model.Sensor, now time.Time) (primitive.ObjectID, error) {
+
+	var cursor envAlertCursor
+	err := cursors.FindOne(context.Background(), bson.M{"rule_id": rule.Rule_id, "sensor_id": sensor.Sensor_id}).Decode(&cursor)
+	if err == mongo.ErrNoDocuments {
+		return primitive.NewObjectIDFromTimestamp(now.Add(-time.Duration(settings.EnvAlertStaleSeconds) * time.Second)), nil
+	}
+
+	return cursor.Last_id, err
+}
+
+// findEnvAlertOverlapping 查詢與 from 到 until 期間重疊的最近一筆警報(未結束的警報視為延續到現在,until 為 nil 時不限)
+func findEnvAlertOverlapping(alerts *mongo.Collection, rule model.EnvironmentalAlertRule, sensor model.Sensor, from time.Time, until *time.Time) (*model.EnvironmentalAlert, error) {
+
+	filter := bson.M{
+		"rule_id":   rule.Rule_id,
+		"sensor_id": sensor.Sensor_id,
+		"$or":       bson.A{bson.M{"status": envAlertActive}, bson.M{"last_time": bson.M{"$gte": from}}},
+	}
+
+	if until != nil {
+		filter["started_at"] = bson.M{"$lte": *until}
+	}
+
+	var alert model.EnvironmentalAlert
+	err := alerts.FindOne(context.Background(), filter, options.FindOne().SetSort(bson.M{"started_at": -1})).Decode(&alert)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &alert, nil
+}
+
+// findEnvAlertOfBreach 查詢涵蓋這段連續超標(start 為開始紀錄)的警報,補傳的紀錄可能落在已發出的警報期間
+func findEnvAlertOfBreach(collection *mongo.Collection, alerts *mongo.Collection, rule model.EnvironmentalAlertRule, sensor model.Sensor, start model.EnvironmentalData) (*model.EnvironmentalAlert, error) {
+
+	// 這段超標之後第一筆未超過門檻的紀錄
+	end, err := findEnvReading(collection, bson.M{
+		"sensor_id": sensor.Sensor_id,
+		"metric":    sensor.Metric,
+		"time":      bson.M{"$gt": start.Time},
+		"score":     envBreachFilter(rule, false),
+	}, bson.D{{Key: "time", Value: 1}})
+	if err != nil {
+		return nil, err
+	}
+
+	var until *time.Time
+	if end != nil {
+		until = &end.Time
+	}
+
+	return findEnvAlertOverlapping(alerts, rule, sensor, start.Time, until)
+}
+
+// replayEnvAlertRule 從 from 開始依紀錄時間逐筆檢查一個規則,超標持續到規定的時間即發出警報,回到門檻內(含緩衝)即結束
+// 至少檢查到 to(新寫入紀錄的最晚時間),之後的紀錄已檢查過,沒有需要延續的警報或超標期間即停止
+func replayEnvAlertRule(collection *mongo.Collection, alerts *mongo.Collection, rule model.EnvironmentalAlertRule, sensor model.Sensor, from time.Time, to time.Time, now time.Time) error {
+
+	var alert *model.EnvironmentalAlert // 檢查中的未結束警報
+	var start *model.EnvironmentalData  // 這段連續超標的開始紀錄
+	covered := false                    // 這段連續超標已有警報(含已結束的警報)
+
+	// from 之前最近一筆紀錄決定開始時的狀態
+	prev, err := findEnvReading(collection, bson.M{
+		"sensor_id": sensor.Sensor_id,
+		"metric":    sensor.Metric,
+		"time":      bson.M{"$lt": from},
+	}, bson.D{{Key: "time", Value: -1}})
+	if err != nil {
+		return err
+	}
+
+	if prev != nil {
+
+		var existing *model.EnvironmentalAlert
+
+		if rule.Breached(prev.Score) {
+
+			if start, err = envBreachStart(collection, rule, sensor, *prev); err != nil {
+				return err
+			}
+
+			if start == nil {
+				start = prev
+			}
+
+			if existing, err = findEnvAlertOfBreach(collection, alerts, rule, sensor, *start); err != nil {
+				return err
+			}
+
+			covered = existing != nil
+
+		} else if existing, err = findEnvAlertOverlapping(alerts, rule, sensor, prev.Time, &prev.Time); err != nil {
+			return err
+		}
+
+		if existing != nil && existing.Status != model.AlertStatusResolved {
+			alert = existing
+		}
+	}
+
+	cur, err := collection.Find(
+		context.Background(),
+		bson.M{"sensor_id": sensor.Sensor_id, "metric": sensor.Metric, "time": bson.M{"$gte": from}},
+		options.Find().SetSort(bson.M{"time": 1}).SetBatchSize(settings.EnvCursorBatchSize),
+	)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(context.Background())
+
+	for cur.Next(context.Background()) {
+
+		var reading model.EnvironmentalData
+		if err := cur.Decode(&reading); err != nil {
+			return err
+		}
+
+		if reading.Time.After(to) {
+
+			if alert == nil && (start == nil || covered) {
+				break
+			}
+
+			if alert != nil && !reading.Time.After(alert.Last_time) {
+				break
+			}
+		}
+
+		// 已有未結束的警報: 早於警報最近一次判斷的紀錄已涵蓋在警報期間
+		if alert != nil {
+
+			if !reading.Time.After(alert.Last_time) {
+				continue
+			}
+
+			if err := updateEnvAlert(*alert, rule, reading, now); err != nil {
+				return err
+			}
+
+			if rule.Cleared(reading.Score) {
+				alert, start, covered = nil, nil, false
+			} else {
+				alert.Last_time = reading.Time
+			}
+
+			continue
+		}
+
+		if !rule.Breached(reading.Score) {
+			start, covered = nil, false
+			continue
+		}
+
+		// 開始一段連續超標
+		if start == nil {
+
+			current := reading
+			start = &current
+
+			existing, err := findEnvAlertOfBreach(collection, alerts, rule, sensor, *start)
+			if err != nil {
+				return err
+			}
+
+			covered = existing != nil
+
+			if existing != nil && existing.Status != model.AlertStatusResolved {
+				alert = existing
+				continue
+			}
+		}
+
+		// 已有警報或尚未持續到規定的時間
+		if covered || reading.Time.Sub(start.Time) < time.Duration(rule.Duration_seconds)*time.Second {
+			continue
+		}
+
+		if alert, err = openEnvAlert(collection, rule, sensor, *start, reading, now); err != nil {
+			return err
+		}
+
+		covered = true
+	}
+
+	return cur.Err()
+}
+
+// evaluateEnvAlertRule 取出上次檢查後新寫入(含補傳)的紀錄,從其中最早的紀錄時間開始依時間逐筆檢查一個規則
+// 同一批寫入內開始又恢復的超標也會發出警報並隨即結束
+func evaluateEnvAlertRule(rule model.EnvironmentalAlertRule, sensor model.Sensor, now time.Time) error {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvSecondRecord)
+	if err != nil {
+		return err
+	}
+
+	alerts, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvAlert)
+	if err != nil {
+		return err
+	}
+
+	cursors, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvAlertCursor)
+	if err != nil {
+		return err
+	}
+
+	checkpoint, err := envAlertCheckpoint(cursors, rule, sensor, now)
+	if err != nil {
+		return err
+	}
+
+	// 依寫入順序取出新寫入的紀錄(只需要紀錄時間)
+	cur, err := collection.Find(
+		context.Background(),
+		bson.M{"sensor_id": sensor.Sensor_id, "metric": sensor.Metric, "_id": bson.M{"$gt": checkpoint}},
+		options.Find().
+			SetSort(bson.M{"_id": 1}).
+			SetProjection(bson.M{"time": 1}).
+			SetLimit(int64(settings.EnvAlertBatchSize)),
+	)
+	if err != nil {
+		return err
+	}
+
+	var ingested []struct {
+		ID   primitive.ObjectID `bson:"_id"`
+		Time time.Time
+	}
+
+	if err := cur.All(context.Background(), &ingested); err != nil {
+		return err
+	}
+
+	if len(ingested) == 0 {
+		return nil
+	}
+
+	from, to := ingested[0].Time, ingested[0].Time
+	for _, reading := range ingested {
+
+		if reading.Time.Before(from) {
+			from = reading.Time
+		}
+
+		if reading.Time.After(to) {
+			to = reading.Time
+		}
+	}
+
+	if err := replayEnvAlertRule(collection, alerts, rule, sensor, from, to, now); err != nil {
+		return err
+	}
+
+	_, err = cursors.UpdateOne(
+		context.Background(),
+		bson.M{"rule_id": rule.Rule_id, "sensor_id": sensor.Sensor_id},
+		bson.M{"$set": bson.M{"last_id": ingested[len(ingested)-1].ID}, "$currentDate": bson.M{updatedAtField: true}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return err
+	}
+
+	// 還有未取出的紀錄,下一輪接續檢查
+	if len(ingested) == settings.EnvAlertBatchSize {
+		envAlerts.touch([]string{sensor.Sensor_id})
+	}
+
+	return nil
+}
+
+// evaluateEnvAlerts 檢查啟用中的規則,sensorIDs 為 nil 時檢查所有感測器;不再檢查的警報一併結束
+func evaluateEnvAlerts(sensorIDs map[string]bool, now time.Time) error {
+
+	rules, err := findEnvAlertRules(bson.M{"enabled": true})
+	if err != nil {
+		return err
+	}
+
+	sensors, err := findSensors(bson.M{"active": true})
+	if err != nil {
+		return err
+	}
+
+	ruleOf := map[string]model.EnvironmentalAlertRule{}
+	for _, rule := range rules {
+		ruleOf[rule.Rule_id] = rule
+	}
+
+	sensorOf := map[string]model.Sensor{}
+	for _, sensor := range sensors {
+		sensorOf[sensor.Sensor_id] = sensor
+	}
+
+	for _, rule := range rules {
+		for _, sensor := range sensors {
+
+			if sensor.Metric != rule.Metric || (rule.Sensor_id != "" && rule.Sensor_id != sensor.Sensor_id) {
+				continue
+			}
+
+			if sensorIDs != nil && !sensorIDs[sensor.Sensor_id] {
+				continue
+			}
+
+			// 單一規則失敗不影響其他規則
+			if err := evaluateEnvAlertRule(rule, sensor, now); err != nil {
+				fmt.Println("環控警報檢查失敗 規則=", rule.Rule_id, "感測器=", sensor.Sensor_id, err)
+			}
+		}
+	}
+
+	return resolveOrphanEnvAlerts(ruleOf, sensorOf, now)
+}
+
+// startEnvAlertJob 啟動環控警報檢查: 寫入紀錄後檢查相關感測器,並定期檢查全部(含外部直接寫入資料庫的紀錄)
+// 由同一個程序依序處理,同一規則、感測器不會同時發出兩筆警報
+func startEnvAlertJob() {
+
+	go func() {
+
+		ticker := time.NewTicker(time.Duration(settings.EnvAlertEvaluateSeconds) * time.Second)
+		defer ticker.Stop()
+
+		for {
+
+			var sensorIDs map[string]bool
+
+			select {
+			case <-ticker.C:
+				envAlerts.take()
+			case <-envAlerts.dirty:
+				sensorIDs = envAlerts.take()
+			}
+
+			if err := evaluateEnvAlerts(sensorIDs, time.Now()); err != nil {
+				fmt.Println("環控警報檢查失敗:", err)
+			}
+		}
+	}()
+}
+
+// 查詢警報規則(/env/alert-rules/:id? ,?sensor=&metric=)
+func getEnvAlertRules(c *fiber.Ctx) {
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	filter := bson.M{}
+
+	// 若有給id
+	if c.Params("id") != "" {
+		filter["rule_id"] = c.Params("id")
+	}
+
+	if sensors := splitQueryList(c.Query("sensor")); len(sensors) > 0 {
+		filter["sensor_id"] = bson.M{"$in": sensors}
+	}
+
+	if metrics := splitQueryList(c.Query("metric")); len(metrics) > 0 {
+		filter["metric"] = bson.M{"$in": metrics}
+	}
+
+	results, err := findEnvAlertRules(filter)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 若查無指定的規則
+	if c.Params("id") != "" && len(results) == 0 {
+		c.SendStatus(404)
+		return
+	}
+
+	sendList(c, view, results)
+}
+
+// 新增或更新警報規則(依 rule_id)
+func upsertEnvAlertRule(c *fiber.Ctx) {
+
+	var rule model.EnvironmentalAlertRule
+	if err := json.Unmarshal([]byte(c.Body()), &rule); err != nil {
+		sendError(c, 400, "無法解析警報規則: "+err.Error())
+		return
+	}
+
+	if err := rule.Validate(); err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	// 指定感測器時,量測項目必須相同
+	if rule.Sensor_id != "" {
+
+		sensors, err := findSensors(bson.M{"sensor_id": rule.Sensor_id})
+		if err != nil {
+			sendError(c, 500, err.Error())
+			return
+		}
+
+		if len(sensors) == 0 {
+			sendError(c, 400, "感測器未登記: "+rule.Sensor_id)
+			return
+		}
+
+		if sensors[0].Metric != rule.Metric {
+			sendError(c, 400, "感測器 "+rule.Sensor_id+" 的量測項目為 "+sensors[0].Metric)
+			return
+		}
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvAlertRule)
+
+	// 若連線有誤
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	_, err = collection.ReplaceOne(context.Background(), bson.M{"rule_id": rule.Rule_id}, rule, options.Replace().SetUpsert(true))
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 停用的規則未結束的警報一併結束(其他變更由下次檢查處理)
+	if !rule.Enabled {
+		if err := resolveEnvAlerts(bson.M{"rule_id": rule.Rule_id}, "規則已停用", time.Now()); err != nil {
+			sendError(c, 500, err.Error())
+			return
+		}
+	}
+
+	sendJSON(c, rule)
+}
+
+// 刪除警報規則(此規則未結束的警報一併結束)
+func deleteEnvAlertRule(c *fiber.Ctx) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvAlertRule)
+
+	// 若連線有誤
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	err = collection.FindOneAndDelete(context.Background(), bson.M{"rule_id": c.Params("id")}).Err()
+	if err == mongo.ErrNoDocuments {
+		c.SendStatus(404)
+		return
+	}
+
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if err := resolveEnvAlerts(bson.M{"rule_id": c.Params("id")}, "規則已刪除", time.Now()); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 刪除檢查進度,同編號的規則重新建立時從頭檢查
+	cursors, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvAlertCursor)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if _, err := cursors.DeleteMany(context.Background(), bson.M{"rule_id": c.Params("id")}); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	c.SendStatus(204)
+}
+
+// 查詢警報(/env/alerts/:id? ,?status=active|open|acknowledged|resolved|all&sensor=&metric=&location=&rule_id=&from=&to=&limit=)
+// status 預設 active(open 與 acknowledged);from、to 為發出時間(RFC 3339);列表預設不回傳 history,?include=history 才回傳
+func getEnvAlerts(c *fiber.Ctx) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvAlert)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 若有給id,回傳單筆(含 history)
+	if c.Params("id") != "" {
+
+		objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+		if err != nil {
+			sendError(c, 400, "警報id格式錯誤")
+			return
+		}
+
+		var alert model.EnvironmentalAlert
+		err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&alert)
+		if err == mongo.ErrNoDocuments {
+			c.SendStatus(404)
+			return
+		}
+
+		if err != nil {
+			sendError(c, 500, err.Error())
+			return
+		}
+
+		sendJSON(c, alert)
+		return
+	}
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c, "history")
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	filter := bson.M{}
+
+	switch status := c.Query("status", "active"); status {
+	case model.AlertStatusOpen, model.AlertStatusAcknowledged, model.AlertStatusResolved:
+		filter["status"] = status
+	case "active":
+		filter["status"] = envAlertActive
+	case "all":
+	default:
+		sendError(c, 400, "status 必須為 active、open、acknowledged、resolved 或 all")
+		return
+	}
+
+	if sensors := splitQueryList(c.Query("sensor")); len(sensors) > 0 {
+		filter["sensor_id"] = bson.M{"$in": sensors}
+	}
+
+	if metrics := splitQueryList(c.Query("metric")); len(metrics) > 0 {
+		filter["metric"] = bson.M{"$in": metrics}
+	}
+
+	if locations := splitQueryList(c.Query("location")); len(locations) > 0 {
+		filter["location"] = bson.M{"$in": locations}
+	}
+
+	if rules := splitQueryList(c.Query("rule_id")); len(rules) > 0 {
+		filter["rule_id"] = bson.M{"$in": rules}
+	}
+
+	opened := bson.M{}
+	for _, key := range []string{"from", "to"} {
+
+		if c.Query(key) == "" {
+			continue
+		}
+
+		t, err := parseEnvTime(key, c.Query(key))
+		if err != nil {
+			sendError(c, 400, err.Error())
+			return
+		}
+
+		if key == "from" {
+			opened["$gte"] = t
+		} else {
+			opened["$lt"] = t
+		}
+	}
+
+	if len(opened) > 0 {
+		filter["opened_at"] = opened
+	}
+
+	limit, err := parseEnvLimit(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	cur, err := collection.Find(context.Background(), filter, view.findOptions().SetSort(bson.M{"opened_at": -1}).SetLimit(int64(limit)))
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	alerts := []model.EnvironmentalAlert{}
+	if err := cur.All(context.Background(), &alerts); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	sendList(c, view, alerts)
+}
+
+// 確認警報(確認人由 X-Actor header 指定,body 可選填 {"note": "說明"}),恢復正常後自動結束
+func acknowledgeEnvAlert(c *fiber.Ctx) {
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		sendError(c, 400, "警報id格式錯誤")
+		return
+	}
+
+	actor, _, ok := auditContext(c, false)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Note string `json:"note"`
+	}
+
+	if len(strings.TrimSpace(c.Body())) > 0 {
+		if err := json.Unmarshal([]byte(c.Body()), &body); err != nil {
+			sendError(c, 400, "無法解析確認資料: "+err.Error())
+			return
+		}
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvAlert)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var before model.EnvironmentalAlert
+	if err := collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&before); err == mongo.ErrNoDocuments {
+		c.SendStatus(404)
+		return
+	} else if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	now := time.Now()
+
+	var alert model.EnvironmentalAlert
+	err = collection.FindOneAndUpdate(
+		context.Background(),
+		bson.M{"_id": objID, "status": model.AlertStatusOpen},
+		bson.M{
+			"$set": bson.M{
+				"status":          model.AlertStatusAcknowledged,
+				"acknowledged_by": actor,
+				"acknowledged_at": now,
+			},
+			"$push": bson.M{"history": model.EnvironmentalAlertEvent{Time: now, Status: model.AlertStatusAcknowledged, Value: before.Last_value, Actor: actor, Note: body.Note}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&alert)
+
+	if err == mongo.ErrNoDocuments {
+		sendError(c, 409, "此警報已確認或已結束")
+		return
+	}
+
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	sendJSON(c, alert)
+}
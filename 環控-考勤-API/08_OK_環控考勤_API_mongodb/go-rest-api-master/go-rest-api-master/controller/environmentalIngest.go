@@ -0,0 +1,353 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+	"my-rest-api/timeseries"
+)
+
+/* 以下為 Environmental ingest(環控紀錄批次寫入) 相關 functions */
+
+// envReadingInput JSON 格式的一筆環控紀錄(metric 可省略,以感測器登記的量測項目為準)
+type envReadingInput struct {
+	Time      string   `json:"time"`      // RFC 3339
+	Sensor_id string   `json:"sensor_id"` // 感測器編號
+	Metric    string   `json:"metric"`    // 量測項目
+	Score     *float64 `json:"score"`     // 數值
+}
+
+// envPendingReading 待驗證的一筆環控紀錄
+type envPendingReading struct {
+	index int // JSON 陣列序號或 line protocol 行號
+	data  model.EnvironmentalData
+}
+
+// envIngestReport 累計批次寫入結果
+type envIngestReport struct {
+	result model.EnvironmentalIngestResult
+}
+
+// reject 記錄一筆失敗
+func (report *envIngestReport) reject(index int, sensorID string, err string) {
+	report.result.Rejected++
+	report.result.Errors = append(report.result.Errors, model.EnvironmentalIngestError{Index: index, Sensor_id: sensorID, Error: err})
+}
+
+// parseEnvJSONReadings 解析 JSON 陣列,格式錯誤的項目記為失敗,其餘繼續處理
+func parseEnvJSONReadings(body []byte, report *envIngestReport) ([]envPendingReading, error) {
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, fmt.Errorf("無法解析環控紀錄(應為 JSON 陣列): %s", err.Error())
+	}
+
+	report.result.Received = len(items)
+	if len(items) > settings.EnvIngestMaxPoints {
+		return nil, fmt.Errorf("每次最多寫入 %d 筆", settings.EnvIngestMaxPoints)
+	}
+
+	readings := []envPendingReading{}
+	for index, item := range items {
+
+		var input envReadingInput
+		if err := json.Unmarshal(item, &input); err != nil {
+			report.reject(index, "", "格式錯誤: "+err.Error())
+			continue
+		}
+
+		if input.Time == "" {
+			report.reject(index, input.Sensor_id, "缺少 time")
+			continue
+		}
+
+		t, err := parseEnvTime("time", input.Time)
+		if err != nil {
+			report.reject(index, input.Sensor_id, err.Error())
+			continue
+		}
+
+		if input.Score == nil {
+			report.reject(index, input.Sensor_id, "缺少 score")
+			continue
+		}
+
+		readings = append(readings, envPendingReading{
+			index: index,
+			data:  model.EnvironmentalData{Time: t, Sensor_id: input.Sensor_id, Metric: input.Metric, Score: *input.Score},
+		})
+	}
+
+	return readings, nil
+}
+
+// parseEnvLineReadings 解析 InfluxDB line protocol,一行一筆
+// measurement 為量測項目,tag sensor_id 為感測器編號,field value(或 score)為數值,沒有 timestamp 時為收到的時間
+// ex: co2,sensor_id=room101-co2 value=612 1600000000000000000
+func parseEnvLineReadings(body []byte, precision time.Duration, report *envIngestReport) ([]envPendingReading, error) {
+
+	received := time.Now()
+	readings := []envPendingReading{}
+
+	scanner := bufio.NewScanner(strings.NewReader(string(body)))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	number := 0
+	for scanner.Scan() {
+
+		number++
+
+		text := strings.TrimSpace(scanner.Text())
+
+		// 空行、註解略過
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		report.result.Received++
+		if report.result.Received > settings.EnvIngestMaxPoints {
+			return nil, fmt.Errorf("每次最多寫入 %d 筆", settings.EnvIngestMaxPoints)
+		}
+
+		line, err := timeseries.ParseLine(text, precision)
+		if err != nil {
+			report.reject(number, "", err.Error())
+			continue
+		}
+
+		sensorID := line.Tags["sensor_id"]
+
+		value, ok := line.Fields["value"]
+		if !ok {
+			value, ok = line.Fields["score"]
+		}
+
+		if !ok {
+			report.reject(number, sensorID, "缺少數值欄位 value")
+			continue
+		}
+
+		t := line.Time
+		if t.IsZero() {
+			t = received
+		}
+
+		readings = append(readings, envPendingReading{
+			index: number,
+			data:  model.EnvironmentalData{Time: t, Sensor_id: sensorID, Metric: line.Measurement, Score: value},
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("無法讀取 line protocol: %s", err.Error())
+	}
+
+	return readings, nil
+}
+
+// validateEnvReadings 依感測器登記資料檢查,回傳可寫入的紀錄
+func validateEnvReadings(readings []envPendingReading, report *envIngestReport) ([]envPendingReading, error) {
+
+	sensorIDs := []string{}
+	seen := map[string]bool{}
+	for _, reading := range readings {
+		if !seen[reading.data.Sensor_id] {
+			seen[reading.data.Sensor_id] = true
+			sensorIDs = append(sensorIDs, reading.data.Sensor_id)
+		}
+	}
+
+	sensors, err := findSensors(bson.M{"sensor_id": bson.M{"$in": sensorIDs}})
+	if err != nil {
+		return nil, err
+	}
+
+	registry := map[string]model.Sensor{}
+	for _, sensor := range sensors {
+		registry[sensor.Sensor_id] = sensor
+	}
+
+	latest := time.Now().Add(time.Duration(settings.EnvIngestMaxFutureSeconds) * time.Second)
+
+	valid := []envPendingReading{}
+	for _, reading := range readings {
+
+		data := &reading.data
+
+		if data.Sensor_id == "" {
+			report.reject(reading.index, "", "缺少 sensor_id")
+			continue
+		}
+
+		sensor, ok := registry[data.Sensor_id]
+		if !ok {
+			report.reject(reading.index, data.Sensor_id, "感測器未登記")
+			continue
+		}
+
+		if !sensor.Active {
+			report.reject(reading.index, data.Sensor_id, "感測器已停用")
+			continue
+		}
+
+		if data.Metric == "" {
+			data.Metric = sensor.Metric
+		}
+
+		if data.Metric != sensor.Metric {
+			report.reject(reading.index, data.Sensor_id, "量測項目 "+data.Metric+" 與感測器登記的 "+sensor.Metric+" 不符")
+			continue
+		}
+
+		if data.Time.After(latest) {
+			report.reject(reading.index, data.Sensor_id, "time 超前伺服器時間: "+data.Time.Format(time.RFC3339))
+			continue
+		}
+
+		valid = append(valid, reading)
+	}
+
+	return valid, nil
+}
+
+// insertEnvReadings 以 unordered bulk write 分批寫入,單筆失敗不影響同批其他紀錄
+func insertEnvReadings(readings []envPendingReading, report *envIngestReport) error {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvSecondRecord)
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(readings); start += settings.EnvIngestBatchSize {
+
+		end := start + settings.EnvIngestBatchSize
+		if end > len(readings) {
+			end = len(readings)
+		}
+
+		batch := readings[start:end]
+
+		models := []mongo.WriteModel{}
+		for _, reading := range batch {
+			models = append(models, mongo.NewInsertOneModel().SetDocument(reading.data))
+		}
+
+		result, err := collection.BulkWrite(context.Background(), models, options.BulkWrite().SetOrdered(false))
+		if result != nil {
+			report.result.Inserted += int(result.InsertedCount)
+		}
+
+		if err == nil {
+			continue
+		}
+
+		// 部分失敗: 依 bulk write 的序號找回原本的紀錄
+		if exception, ok := err.(mongo.BulkWriteException); ok && exception.WriteConcernError == nil {
+
+			for _, writeError := range exception.WriteErrors {
+				reading := batch[writeError.Index]
+				report.reject(reading.index, reading.data.Sensor_id, writeError.Message)
+			}
+
+			if result == nil {
+				report.result.Inserted += len(batch) - len(exception.WriteErrors)
+			}
+
+			continue
+		}
+
+		// 連線等錯誤: 無法確定這批寫入多少筆,整批記為失敗後繼續下一批
+		fmt.Println("環控紀錄寫入失敗:", err)
+		for _, reading := range batch {
+			report.reject(reading.index, reading.data.Sensor_id, "寫入失敗: "+err.Error())
+		}
+	}
+
+	return nil
+}
+
+// 批次寫入環控紀錄(POST /env/readings)
+// Content-Type: application/json 為 JSON 陣列 [{"time":"RFC 3339","sensor_id":"","metric":"","score":0}]
+// 其他為 InfluxDB line protocol(?precision=ns|us|ms|s,預設 ns)
+// 全部寫入回傳 200,部分失敗回傳 207,全部失敗回傳 422,內容皆為寫入結果與失敗明細
+func postEnvironmentalReadings(c *fiber.Ctx) {
+
+	body := []byte(c.Body())
+	if len(strings.TrimSpace(string(body))) == 0 {
+		sendError(c, 400, "沒有環控紀錄")
+		return
+	}
+
+	report := &envIngestReport{result: model.EnvironmentalIngestResult{Errors: []model.EnvironmentalIngestError{}}}
+
+	var readings []envPendingReading
+	var err error
+
+	if strings.HasPrefix(strings.ToLower(c.Get(fiber.HeaderContentType)), fiber.MIMEApplicationJSON) {
+		readings, err = parseEnvJSONReadings(body, report)
+	} else {
+
+		precision, ok := timeseries.Precisions[c.Query("precision", "ns")]
+		if !ok {
+			sendError(c, 400, "precision 必須為 ns、us、ms 或 s")
+			return
+		}
+
+		readings, err = parseEnvLineReadings(body, precision, report)
+	}
+
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	if readings, err = validateEnvReadings(readings, report); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if err := insertEnvReadings(readings, report); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 有寫入紀錄的感測器重新檢查警報
+	if report.result.Inserted > 0 {
+
+		sensorIDs := []string{}
+		for _, reading := range readings {
+			sensorIDs = append(sensorIDs, reading.data.Sensor_id)
+		}
+
+		envAlerts.touch(sensorIDs)
+	}
+
+	sort.SliceStable(report.result.Errors, func(i, j int) bool {
+		return report.result.Errors[i].Index < report.result.Errors[j].Index
+	})
+
+	switch {
+	case report.result.Rejected == 0:
+		c.Status(200)
+	case report.result.Inserted > 0:
+		c.Status(207)
+	default:
+		c.Status(422)
+	}
+
+	sendJSON(c, report.result)
+}
@@ -0,0 +1,377 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Exception(出勤異常) 相關 functions */
+
+// detectExceptions 偵測員工單日的出勤異常
+func detectExceptions(attendance *dailyAttendance, shift model.Shift) []model.AttendanceException {
+
+	var exceptions []model.AttendanceException
+
+	add := func(exceptionType string, evidence ...string) {
+		exceptions = append(exceptions, model.AttendanceException{
+			Date:       attendance.Date.Format(model.DateLayout),
+			Name:       attendance.Name,
+			Department: attendance.Department,
+			Type:       exceptionType,
+			Evidence:   evidence,
+		})
+	}
+
+	punches := attendance.Punches
+	if len(punches) == 0 {
+		return nil
+	}
+
+	// 請假當天有打卡
+	if attendance.Leave_type != "" {
+		add(model.ExceptionPunchOnLeave, append([]string{"假別: " + attendance.Leave_type}, formatPunches(punches)...)...)
+	}
+
+	// 重複打卡: 與前一筆間隔太短的只算一次
+	distinct := []time.Time{punches[0]}
+	var duplicates []string
+	for i := 1; i < len(punches); i++ {
+		if punches[i].Sub(punches[i-1]) < time.Duration(settings.DuplicatePunchSeconds)*time.Second {
+			duplicates = append(duplicates, punches[i-1].Format(model.DateTimeLayout)+" / "+punches[i].Format(model.DateTimeLayout))
+			continue
+		}
+		distinct = append(distinct, punches[i])
+	}
+
+	if len(duplicates) > 0 {
+		add(model.ExceptionDuplicatePunch, duplicates...)
+	}
+
+	shiftEvidence := "班別: " + shift.Code + " " + shift.Start_time + "-" + shift.End_time
+	startAt := shift.StartAt(attendance.Date)
+	endAt := shift.EndAt(attendance.Date)
+
+	// 只有一筆打卡,或打卡都在班別前半段(缺少下班打卡)
+	switch {
+	case len(distinct) == 1:
+		add(model.ExceptionSinglePunch, distinct[0].Format(model.DateTimeLayout), shiftEvidence)
+	case attendance.Leave_type == "" && distinct[len(distinct)-1].Before(startAt.Add(endAt.Sub(startAt)/2)):
+		add(model.ExceptionMissingCheckOut, append(formatPunches(distinct), shiftEvidence)...)
+	}
+
+	// 打卡時間離上下班時間太遠
+	tolerance := time.Duration(settings.OddPunchToleranceMinutes) * time.Minute
+	var oddPunches []string
+	for _, punch := range distinct {
+		if punch.Before(startAt.Add(-tolerance)) || punch.After(endAt.Add(tolerance)) {
+			oddPunches = append(oddPunches, punch.Format(model.DateTimeLayout))
+		}
+	}
+
+	if len(oddPunches) > 0 {
+		add(model.ExceptionOddHourPunch, append(oddPunches, shiftEvidence)...)
+	}
+
+	return exceptions
+}
+
+// formatPunches 打卡時間轉文字
+func formatPunches(punches []time.Time) []string {
+
+	texts := make([]string, len(punches))
+	for i, punch := range punches {
+		texts[i] = punch.Format(model.DateTimeLayout)
+	}
+
+	return texts
+}
+
+// scanExceptionsOfDate 彙整並掃描指定營業日的出勤異常並寫入,回傳目前待處理的筆數
+// 已處理(resolved)的異常不會被更新;更正後不再成立的待處理異常標記為 cleared(再次發現時重新開啟)
+func scanExceptionsOfDate(date time.Time) (int, error) {
+
+	// 已匿名化的姓名對不到班別,不能重新掃描
+	if err := checkNotAnonymized(date, date); err != nil {
+		return 0, err
+	}
+
+	// 先彙整,跨夜班的下班打卡才不會被當成缺少下班打卡
+	if err := consolidateBusinessDate(date); err != nil {
+		return 0, err
+	}
+
+	attendances, err := loadDailyAttendance(date, date, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	table, err := loadShiftTable()
+	if err != nil {
+		return 0, err
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfAttendanceException)
+	if err != nil {
+		return 0, err
+	}
+
+	myDate := date.Format(model.DateLayout)
+	now := time.Now().Format(model.DateTimeLayout)
+	grace := time.Duration(settings.StatisticsSettleGraceMinutes) * time.Minute
+
+	var detected bson.A
+
+	for _, attendance := range attendances {
+
+		shift, _ := table.lookup(attendance.Name)
+
+		// 班別還沒結束(含跨夜班)的人還可能打卡,先不判斷,既有的待處理異常也保留
+		if time.Now().Before(shift.EndAt(date).Add(grace)) {
+			detected = append(detected, bson.M{"date": myDate, "name": attendance.Name})
+			continue
+		}
+
+		for _, exception := range detectExceptions(attendance, shift) {
+
+			key := bson.M{"date": myDate, "name": exception.Name, "type": exception.Type}
+			detected = append(detected, key)
+
+			var existing model.AttendanceException
+			err := collection.FindOne(context.Background(), key).Decode(&existing)
+			if err != nil && err != mongo.ErrNoDocuments {
+				return 0, err
+			}
+
+			// 已處理的異常不再新增或更新
+			if err == nil && existing.Status == model.ExceptionStatusResolved {
+				continue
+			}
+
+			update := bson.M{
+				"$set": bson.M{
+					"department":  exception.Department,
+					"evidence":    exception.Evidence,
+					"detected_at": now,
+					"status":      model.ExceptionStatusOpen,
+				},
+				"$unset": bson.M{"cleared_at": ""},
+			}
+
+			result, err := collection.UpdateOne(context.Background(), key, update, options.Update().SetUpsert(true))
+			if err != nil {
+				return 0, err
+			}
+
+			exception.ID = existing.ID
+			if objID, ok := result.UpsertedID.(primitive.ObjectID); ok {
+				exception.ID = objID
+			}
+
+			// 新發現或重新開啟的異常通知其他系統
+			if result.UpsertedID != nil || existing.Status == model.ExceptionStatusCleared {
+				exception.Status = model.ExceptionStatusOpen
+				exception.Detected_at = now
+				publishWebhookEvent(model.WebhookEventExceptionRaised, exception)
+			}
+		}
+	}
+
+	// 已不成立的待處理異常標記為 cleared 並通知其他系統(已發出 exception.raised,訂閱端需要對帳)
+	stale := bson.M{"date": myDate, "status": model.ExceptionStatusOpen}
+	if len(detected) > 0 {
+		stale["$nor"] = detected
+	}
+
+	var cleared []model.AttendanceException
+	cur, err := collection.Find(context.Background(), stale)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = cur.All(context.Background(), &cleared); err != nil {
+		return 0, err
+	}
+
+	for _, exception := range cleared {
+
+		result, err := collection.UpdateOne(context.Background(),
+			bson.M{"_id": exception.ID, "status": model.ExceptionStatusOpen},
+			bson.M{"$set": bson.M{"status": model.ExceptionStatusCleared, "cleared_at": now}},
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		// 同時被處理的異常不通知
+		if result.ModifiedCount == 0 {
+			continue
+		}
+
+		exception.Status = model.ExceptionStatusCleared
+		exception.Cleared_at = now
+		publishWebhookEvent(model.WebhookEventExceptionCleared, exception)
+	}
+
+	count, err := collection.CountDocuments(context.Background(), bson.M{"date": myDate, "status": model.ExceptionStatusOpen})
+
+	return int(count), err
+}
+
+// 重新掃描指定營業日的出勤異常
+func scanExceptions(c *fiber.Ctx) {
+
+	date, err := model.ParseDate(c.Params("date"))
+	if err != nil {
+		sendError(c, 400, "日期格式錯誤(應為YYYY-MM-DD)")
+		return
+	}
+
+	open, err := scanExceptionsOfDate(date)
+	if err != nil {
+		sendError(c, aggregateErrorStatus(err), err.Error())
+		return
+	}
+
+	sendJSON(c, fiber.Map{
+		"date": date.Format(model.DateLayout),
+		"open": open, // 待處理筆數
+	})
+}
+
+// 取得出勤異常(/exceptions?date=YYYY-MM-DD&status=open|resolved|cleared|all,預設只列待處理)
+func getExceptions(c *fiber.Ctx) {
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	filter := bson.M{}
+
+	if c.Query("date") != "" {
+
+		date, err := model.ParseDate(c.Query("date"))
+		if err != nil {
+			sendError(c, 400, "日期格式錯誤(應為 date=YYYY-MM-DD)")
+			return
+		}
+
+		filter["date"] = date.Format(model.DateLayout)
+	}
+
+	switch status := c.Query("status", model.ExceptionStatusOpen); status {
+	case model.ExceptionStatusOpen, model.ExceptionStatusResolved, model.ExceptionStatusCleared:
+		filter["status"] = status
+	case "all":
+	default:
+		sendError(c, 400, "status 必須為 open、resolved、cleared 或 all")
+		return
+	}
+
+	if department := c.Query("department"); department != "" {
+		filter["department"] = department
+	}
+
+	fmt.Println("查詢出勤異常 filter=", filter)
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfAttendanceException)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	cur, err := collection.Find(context.Background(), filter, view.findOptions().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "name", Value: 1}, {Key: "type", Value: 1}}))
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	exceptions := []model.AttendanceException{}
+	if err := cur.All(context.Background(), &exceptions); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	sendList(c, view, exceptions)
+}
+
+// 處理出勤異常(body: {"resolved_by": "處理人", "resolution": "處理說明"})
+func resolveException(c *fiber.Ctx) {
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		sendError(c, 400, "異常id格式錯誤")
+		return
+	}
+
+	var body struct {
+		Resolved_by string `json:"resolved_by"`
+		Resolution  string `json:"resolution"`
+	}
+
+	if err := json.Unmarshal([]byte(c.Body()), &body); err != nil {
+		sendError(c, 400, "無法解析處理資料: "+err.Error())
+		return
+	}
+
+	if body.Resolved_by == "" {
+		sendError(c, 400, "resolved_by 不可為空")
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfAttendanceException)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var exception model.AttendanceException
+	err = collection.FindOneAndUpdate(
+		context.Background(),
+		bson.M{"_id": objID, "status": model.ExceptionStatusOpen},
+		bson.M{"$set": bson.M{
+			"status":      model.ExceptionStatusResolved,
+			"resolved_by": body.Resolved_by,
+			"resolution":  body.Resolution,
+			"resolved_at": time.Now().Format(model.DateTimeLayout),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&exception)
+
+	if err == mongo.ErrNoDocuments {
+
+		// 區分查無異常與已處理
+		count, _ := collection.CountDocuments(context.Background(), bson.M{"_id": objID})
+		if count == 0 {
+			c.SendStatus(404)
+			return
+		}
+
+		sendError(c, 409, "此異常已處理")
+		return
+	}
+
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	sendJSON(c, exception)
+}
@@ -0,0 +1,457 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/export"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Export(匯出 xlsx、csv) 相關 functions */
+
+// noDepartmentSheetName :沒有部門的資料所在的工作表
+const noDepartmentSheetName = "未分類"
+
+// emptySheetName :期間內沒有資料時輸出的工作表
+const emptySheetName = "無資料"
+
+// companySheetName :全公司統計的工作表(也是 CSV 中全公司統計列的部門欄)
+const companySheetName = "全公司"
+
+// exporter 將期間內的資料寫入表格輸出
+type exporter func(writer export.Writer, from time.Time, to time.Time) error
+
+// exporters 可匯出的資料集
+var exporters = map[string]exporter{
+	"records":    exportCheckInRecords,
+	"leave":      exportLeaves,
+	"statistics": exportStatistics,
+	"timesheets": exportTimesheets,
+}
+
+// 匯出資料(/export/:dataset?from=&to=&format=xlsx|csv)
+// 資料在回應時才逐日讀取並寫出,一年份的資料也不會整份放進記憶體
+func exportData(c *fiber.Ctx) {
+
+	dataset := c.Params("dataset")
+
+	exportFunction, ok := exporters[dataset]
+	if !ok {
+		sendError(c, 404, "無此資料集,可匯出: records、leave、statistics、timesheets")
+		return
+	}
+
+	from, to, err := parseDateRange(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	format := strings.ToLower(c.Query("format", export.FormatXLSX))
+	if format != export.FormatXLSX && format != export.FormatCSV {
+		sendError(c, 400, "format 必須為 xlsx 或 csv")
+		return
+	}
+
+	// 統計與月報表依員工名冊計算,已匿名化的期間不能匯出
+	if dataset == "statistics" || dataset == "timesheets" {
+		if err := checkNotAnonymized(from, to); err != nil {
+			sendError(c, aggregateErrorStatus(err), err.Error())
+			return
+		}
+	}
+
+	fmt.Println("匯出", dataset, from.Format(model.DateLayout), "~", to.Format(model.DateLayout), format)
+
+	c.Attachment(fmt.Sprintf("%s_%s_%s.%s", dataset, from.Format(model.DateLayout), to.Format(model.DateLayout), format))
+	c.Set(fiber.HeaderContentType, export.ContentType(format))
+
+	c.Fasthttp.SetBodyStreamWriter(func(w *bufio.Writer) {
+
+		writer := export.NewWriter(format, w)
+
+		// 回應已開始傳送,發生錯誤時只能記錄並結束檔案
+		if err := exportFunction(writer, from, to); err != nil {
+			fmt.Println("匯出失敗:", dataset, err)
+		}
+
+		if err := writer.Close(); err != nil {
+			fmt.Println("匯出失敗:", dataset, err)
+		}
+	})
+}
+
+// departmentSheetName 部門對應的工作表名稱
+func departmentSheetName(department string) string {
+
+	if department == "" {
+		return noDepartmentSheetName
+	}
+
+	return department
+}
+
+// sheetWriter 有資料時才開始部門的工作表,期間內沒有資料的部門不輸出空白工作表
+// 各部門使用相同的表頭,CSV 中各部門的列接在一起輸出
+type sheetWriter struct {
+	writer  export.Writer
+	headers []string
+	current string // 目前的工作表
+	started bool   // 是否已開始任何工作表
+}
+
+// writeRow 寫入一列到指定的工作表(與目前不同時開始新的工作表)
+func (w *sheetWriter) writeRow(sheet string, row []export.Cell) error {
+
+	if !w.started || sheet != w.current {
+
+		if err := w.writer.StartSheet(sheet, w.headers); err != nil {
+			return err
+		}
+
+		w.started = true
+		w.current = sheet
+	}
+
+	return w.writer.WriteRow(row)
+}
+
+// finish 期間內沒有任何資料時仍輸出表頭
+func (w *sheetWriter) finish() error {
+
+	if w.started {
+		return nil
+	}
+
+	return w.writer.StartSheet(emptySheetName, w.headers)
+}
+
+// departmentFilter 查詢指定部門的 filter(空字串代表沒有部門)
+func departmentFilter(department string) interface{} {
+
+	if department == "" {
+		return bson.M{"$in": bson.A{nil, ""}}
+	}
+
+	return department
+}
+
+// loadDepartments 取得所有部門(打卡紀錄與員工名冊)
+func loadDepartments() ([]string, error) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := collection.Distinct(context.Background(), "department", bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	employees, err := loadEmployees("")
+	if err != nil {
+		return nil, err
+	}
+
+	found := map[string]bool{}
+	for _, value := range values {
+		department, _ := value.(string)
+		found[department] = true
+	}
+
+	for _, employee := range employees {
+		found[employee.Department] = true
+	}
+
+	departments := make([]string, 0, len(found))
+	for department := range found {
+		departments = append(departments, department)
+	}
+
+	sort.Strings(departments)
+
+	return departments, nil
+}
+
+// exportCheckInRecordsOf 依部門逐日匯出打卡紀錄(extraFilter 可再加條件,ex: 只匯出請假)
+func exportCheckInRecordsOf(writer export.Writer, from time.Time, to time.Time, headers []string, extraFilter bson.M) error {
+
+	departments, err := loadDepartments()
+	if err != nil {
+		return err
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
+	if err != nil {
+		return err
+	}
+
+	sheets := &sheetWriter{writer: writer, headers: headers}
+
+	for _, department := range departments {
+
+		for _, date := range datesBetween(from, to) {
+
+			filter := businessDateFilter(date.Format(model.DateLayout))
+			filter["department"] = departmentFilter(department)
+			for key, value := range extraFilter {
+				filter[key] = value
+			}
+
+			// 不取照片
+			cur, err := collection.Find(context.Background(), filter, options.Find().SetProjection(bson.M{"pic": 0}).SetSort(bson.M{"name": 1}))
+			if err != nil {
+				return err
+			}
+
+			for cur.Next(context.Background()) {
+
+				var record model.CheckInRecord
+				if err := cur.Decode(&record); err != nil {
+					cur.Close(context.Background())
+					return err
+				}
+
+				checkInTime := export.Empty()
+				if punch, err := model.ParseCheckInTime(record.Check_in_time); err == nil {
+					checkInTime = export.DateTime(punch)
+				}
+
+				row := []export.Cell{
+					export.String(record.Name),
+					export.String(record.Department),
+					export.String(record.Position),
+					export.Date(date),
+					checkInTime,
+					export.String(record.Leave_type),
+				}
+
+				if err := sheets.writeRow(departmentSheetName(department), row); err != nil {
+					cur.Close(context.Background())
+					return err
+				}
+			}
+
+			err = cur.Err()
+			cur.Close(context.Background())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return sheets.finish()
+}
+
+// exportCheckInRecords 匯出打卡紀錄(每個有資料的部門一張工作表)
+func exportCheckInRecords(writer export.Writer, from time.Time, to time.Time) error {
+	headers := []string{"姓名", "部門", "職稱", "營業日", "打卡時間", "假別"}
+	return exportCheckInRecordsOf(writer, from, to, headers, nil)
+}
+
+// exportLeaves 匯出請假紀錄(每個有資料的部門一張工作表)
+func exportLeaves(writer export.Writer, from time.Time, to time.Time) error {
+	headers := []string{"姓名", "部門", "職稱", "日期", "打卡時間", "假別"}
+	return exportCheckInRecordsOf(writer, from, to, headers, bson.M{"leave_type": bson.M{"$nin": bson.A{nil, ""}}})
+}
+
+// exportStatistics 匯出統計: 第一張為全公司每日統計,其後每個部門一張每日統計
+// 全公司與部門使用相同欄位(第一欄為部門),CSV 中可依部門欄區分
+// 全公司的請假人次、出勤率由當天各部門合計;部門沒有訪客欄
+func exportStatistics(writer export.Writer, from time.Time, to time.Time) error {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInStatistics)
+	if err != nil {
+		return err
+	}
+
+	headers := []string{"部門", "日期", "應到", "實到", "請假", "未到", "出勤率", "訪客"}
+	if err := writer.StartSheet(companySheetName, headers); err != nil {
+		return err
+	}
+
+	// 部門統計資料量很小(部門數 x 天數),逐日計算後再依部門分表輸出
+	rowsOfDepartment := map[string][][]export.Cell{}
+
+	for _, date := range datesBetween(from, to) {
+
+		var results []bson.M
+		cur, err := collection.Find(context.Background(), bson.M{"date": bson.M{"$in": model.DateVariants(date)}})
+		if err != nil {
+			return err
+		}
+
+		if err = cur.All(context.Background(), &results); err != nil {
+			return err
+		}
+
+		statistics, err := groupStatisticsBetween(date, date, groupByDepartment, "")
+		if err != nil {
+			return err
+		}
+
+		onLeave := 0
+		for _, statistic := range statistics {
+
+			onLeave += statistic.On_leave
+
+			rowsOfDepartment[statistic.Group] = append(rowsOfDepartment[statistic.Group], []export.Cell{
+				export.String(departmentSheetName(statistic.Group)),
+				export.Date(date),
+				export.Number(float64(statistic.Expected)),
+				export.Number(float64(statistic.Attended)),
+				export.Number(float64(statistic.On_leave)),
+				export.Number(float64(statistic.Absent)),
+				export.Number(statistic.Attendance_rate),
+				export.Empty(),
+			})
+		}
+
+		for _, result := range results {
+
+			expected, _ := strconv.ParseFloat(fmt.Sprint(result["expected"]), 64)
+			attendance, _ := strconv.ParseFloat(fmt.Sprint(result["attendance"]), 64)
+
+			rate := export.Empty()
+			if expected > 0 {
+				rate = export.Number(attendance / expected)
+			}
+
+			row := []export.Cell{
+				export.String(companySheetName),
+				export.Date(date),
+				numberCell(result["expected"]),
+				numberCell(result["attendance"]),
+				export.Number(float64(onLeave)),
+				numberCell(result["not_arrived"]),
+				rate,
+				numberCell(result["guests"]),
+			}
+
+			if err := writer.WriteRow(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	departments := make([]string, 0, len(rowsOfDepartment))
+	for department := range rowsOfDepartment {
+		departments = append(departments, department)
+	}
+	sort.Strings(departments)
+
+	for _, department := range departments {
+
+		if err := writer.StartSheet(departmentSheetName(department), headers); err != nil {
+			return err
+		}
+
+		for _, row := range rowsOfDepartment[department] {
+			if err := writer.WriteRow(row); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// exportTimesheets 匯出每位員工每日出勤(每個有成員的部門一張工作表)
+func exportTimesheets(writer export.Writer, from time.Time, to time.Time) error {
+
+	departments, err := loadDepartments()
+	if err != nil {
+		return err
+	}
+
+	headers := []string{"員工編號", "姓名", "部門", "日期", "日別", "狀態", "假別", "上班打卡", "下班打卡", "工作時數", "遲到分鐘"}
+	sheets := &sheetWriter{writer: writer, headers: headers}
+
+	for _, department := range departments {
+
+		// 部門成員: 員工名冊 + 期間內有打卡紀錄的人
+		employees, err := loadEmployeesBetween(from, to, department, false)
+		if err != nil {
+			return err
+		}
+
+		for _, employee := range employees {
+
+			timesheet, err := buildTimesheet(employee, "", from, to)
+			if err != nil {
+				return err
+			}
+
+			for _, day := range timesheet.Days {
+
+				date, _ := model.ParseDate(day.Date)
+				row := []export.Cell{
+					export.String(employee.Employee_id),
+					export.String(employee.Name),
+					export.String(department),
+					export.Date(date),
+					export.String(day.Day_type),
+					export.String(day.Status),
+					export.String(day.Leave_type),
+					dateTimeCell(day.First_in),
+					dateTimeCell(day.Last_out),
+					export.Number(float64(day.Worked_minutes) / 60),
+					export.Number(float64(day.Late_minutes)),
+				}
+
+				if err := sheets.writeRow(departmentSheetName(department), row); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return sheets.finish()
+}
+
+// numberCell 統計資料中以字串儲存的數字轉為數字儲存格
+func numberCell(value interface{}) export.Cell {
+
+	switch v := value.(type) {
+	case string:
+		if number, err := strconv.ParseFloat(v, 64); err == nil {
+			return export.Number(number)
+		}
+		return export.String(v)
+	case int32:
+		return export.Number(float64(v))
+	case int64:
+		return export.Number(float64(v))
+	case float64:
+		return export.Number(v)
+	}
+
+	return export.Empty()
+}
+
+// dateTimeCell DateTimeLayout 字串轉日期時間儲存格
+func dateTimeCell(value string) export.Cell {
+
+	t, err := time.ParseInLocation(model.DateTimeLayout, value, time.Local)
+	if err != nil {
+		return export.Empty()
+	}
+
+	return export.DateTime(t)
+}
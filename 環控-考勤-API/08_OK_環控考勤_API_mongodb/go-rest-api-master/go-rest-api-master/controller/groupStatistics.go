@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"my-rest-api/model"
+)
+
+/* 以下為部門、職稱出勤統計相關 functions */
+
+const (
+	groupByDepartment = "department"
+	groupByPosition   = "position"
+)
+
+// groupStatisticsBetween 計算期間內各部門或各職稱的出勤統計
+// 應到: 員工在工作日(依行事曆與輪班)的人次;員工名冊中沒有打卡紀錄的人在工作日視為缺勤
+// 今天以後的日期尚未發生,不計入(期間全在未來時回傳空的統計);今天班別尚未開始(上班時間加遲到寬限)且還沒打卡的人也不計入
+func groupStatisticsBetween(from time.Time, to time.Time, groupBy string, department string) ([]model.GroupStatistics, error) {
+
+	now := time.Now()
+	if today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local); to.After(today) {
+		to = today
+	}
+
+	if from.After(to) {
+		return []model.GroupStatistics{}, nil
+	}
+
+	if err := checkNotAnonymized(from, to); err != nil {
+		return nil, err
+	}
+
+	var extraFilter bson.M
+	if department != "" {
+		extraFilter = bson.M{"department": department}
+	}
+
+	attendances, err := loadDailyAttendance(from, to, extraFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	employees, err := loadEmployees(department)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := loadShiftTable()
+	if err != nil {
+		return nil, err
+	}
+
+	holidays, err := loadHolidays(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	// 員工所屬群組(打卡紀錄優先,員工名冊補足)
+	groupOfName := map[string]string{}
+	for _, employee := range employees {
+		groupOfName[employee.Name] = employee.Department
+		if groupBy == groupByPosition {
+			groupOfName[employee.Name] = employee.Position
+		}
+	}
+
+	attendanceOfKey := map[string]*dailyAttendance{}
+	for _, attendance := range attendances {
+		attendanceOfKey[attendance.Name+"|"+attendance.Date.Format(model.DateLayout)] = attendance
+		groupOfName[attendance.Name] = attendance.Department
+		if groupBy == groupByPosition {
+			groupOfName[attendance.Name] = attendance.Position
+		}
+	}
+
+	statistics := map[string]*model.GroupStatistics{}
+
+	for name, group := range groupOfName {
+
+		shift, assignment := table.lookup(name)
+
+		for _, date := range datesBetween(from, to) {
+
+			if model.DayType(date, holidays, assignment) != model.DayTypeWorkday {
+				continue
+			}
+
+			attendance, hasAttendance := attendanceOfKey[name+"|"+date.Format(model.DateLayout)]
+
+			// 班別尚未開始,還沒打卡也沒請假不算缺勤
+			arrived := hasAttendance && (attendance.Leave_type != "" || len(attendance.Punches) > 0)
+			if !arrived && shiftNotStarted(shift, date, now) {
+				continue
+			}
+
+			statistic, ok := statistics[group]
+			if !ok {
+				statistic = &model.GroupStatistics{
+					Group: group,
+					From:  from.Format(model.DateLayout),
+					To:    to.Format(model.DateLayout),
+				}
+				statistics[group] = statistic
+			}
+
+			statistic.Expected++
+
+			switch {
+			case !hasAttendance:
+				statistic.Absent++
+			case attendance.Leave_type != "":
+				statistic.On_leave++
+			case len(attendance.Punches) > 0:
+				statistic.Attended++
+			default:
+				statistic.Absent++
+			}
+		}
+	}
+
+	results := make([]model.GroupStatistics, 0, len(statistics))
+	for _, statistic := range statistics {
+		if statistic.Expected > 0 {
+			statistic.Attendance_rate = float64(statistic.Attended) / float64(statistic.Expected)
+		}
+		results = append(results, *statistic)
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Group < results[j].Group })
+
+	return results, nil
+}
+
+// 取得各部門出勤統計(?date= 或 ?from=&to=,可加 &department= 只看自己部門)
+func getCheckInStatisticsByDepartment(c *fiber.Ctx) {
+	getGroupStatistics(c, groupByDepartment)
+}
+
+// 取得各職稱出勤統計(?date= 或 ?from=&to=,可加 &department= 只看自己部門)
+func getCheckInStatisticsByPosition(c *fiber.Ctx) {
+	getGroupStatistics(c, groupByPosition)
+}
+
+// getGroupStatistics 回應部門或職稱出勤統計
+func getGroupStatistics(c *fiber.Ctx, groupBy string) {
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	from, to, err := parseDateRange(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	department := c.Query("department")
+	fmt.Println("查詢期間=", from.Format(model.DateLayout), "~", to.Format(model.DateLayout), "部門=", department)
+
+	results, err := groupStatisticsBetween(from, to, groupBy, department)
+	if err != nil {
+		sendError(c, aggregateErrorStatus(err), err.Error())
+		return
+	}
+
+	// 若查無資料
+	if len(results) == 0 {
+		c.SendStatus(404)
+		return
+	}
+
+	setDateCacheControl(c, to)
+	sendList(c, view, results)
+}
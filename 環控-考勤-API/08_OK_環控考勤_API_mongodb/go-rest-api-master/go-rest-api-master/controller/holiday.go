@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Holiday(行事曆例外日) 相關 functions */
+
+// yearPattern 年份格式(YYYY)
+var yearPattern = regexp.MustCompile(`^[0-9]{4}$`)
+
+// 取得行事曆例外日(可指定年份)
+func getHoliday(c *fiber.Ctx) {
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfHoliday)
+
+	// 若連線有誤
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var filter bson.M = bson.M{}
+
+	// 若有給year(日期以 YYYY-MM-DD 字串儲存,以範圍查詢)
+	if year := c.Params("year"); year != "" {
+
+		if !yearPattern.MatchString(year) {
+			sendError(c, 400, "年份格式錯誤(應為YYYY)")
+			return
+		}
+
+		// "." 緊接在 "-" 之後,範圍即為 YYYY- 開頭的日期
+		filter = bson.M{"date": bson.M{"$gte": year + "-", "$lt": year + "."}}
+	}
+
+	var results []model.Holiday
+	cur, err := collection.Find(context.Background(), filter, view.findOptions().SetSort(bson.M{"date": 1}))
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if err = cur.All(context.Background(), &results); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 若查無資料
+	if results == nil {
+		c.SendStatus(404)
+		return
+	}
+
+	sendList(c, view, results)
+}
+
+// 新增或更新行事曆例外日(以日期為key)
+func upsertHoliday(c *fiber.Ctx) {
+
+	var holiday model.Holiday
+	if err := json.Unmarshal([]byte(c.Body()), &holiday); err != nil {
+		sendError(c, 400, "無法解析行事曆資料: "+err.Error())
+		return
+	}
+
+	if err := holiday.Validate(); err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	date, _ := model.ParseDate(holiday.Date)
+	holiday.Date = date.Format(model.DateLayout)
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfHoliday)
+
+	// 若連線有誤
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	_, err = collection.ReplaceOne(context.Background(), bson.M{"date": holiday.Date}, holiday, options.Replace().SetUpsert(true))
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	sendJSON(c, holiday)
+}
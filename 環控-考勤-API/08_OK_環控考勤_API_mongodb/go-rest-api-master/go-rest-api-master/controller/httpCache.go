@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"github.com/gofiber/fiber/middleware"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+// updatedAtField 資料最後異動時間(修改既有資料時更新,作為 ETag 的資料版本)
+const updatedAtField = "updated_at"
+
+/* 以下為 HTTP 快取(ETag、Cache-Control、304)與回應壓縮 相關 functions */
+
+// skipCompress 不壓縮的路徑: 即時推播(串流)、照片(已壓縮)
+func skipCompress(c *fiber.Ctx) bool {
+	return c.Path() == "/live" || strings.HasSuffix(c.Path(), "/photo")
+}
+
+// compressResponse 依 Accept-Encoding 以 brotli 或 gzip 壓縮回應
+var compressResponse = middleware.Compress(middleware.CompressConfig{
+	Next:  skipCompress,
+	Level: middleware.CompressLevelDefault,
+})
+
+// strongETag 產生強 ETag: 同一個網址、同一個資料版本、同一種壓縮方式才相同
+// 壓縮在之後進行,gzip、brotli、未壓縮的回應位元組不同,所以要把 Accept-Encoding 一併算進去
+func strongETag(c *fiber.Ctx, version []byte) string {
+
+	hash := sha256.New()
+	hash.Write([]byte(c.OriginalURL()))
+	hash.Write([]byte{0})
+	hash.Write([]byte(c.Get(fiber.HeaderAcceptEncoding)))
+	hash.Write([]byte{0})
+	hash.Write(version)
+
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// dataVersion 查詢條件內資料的版本: 筆數、最大的 _id、最近的異動與讀取時間
+// 新增會改變 _id 與筆數,刪除會改變筆數,修改會改變 updated_at
+func dataVersion(dbName string, collectionName string, filter bson.M) (string, error) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(dbName, collectionName)
+	if err != nil {
+		return "", err
+	}
+
+	cur, err := collection.Aggregate(context.Background(), bson.A{
+		bson.M{"$match": filter},
+		bson.M{"$group": bson.M{
+			"_id":      nil,
+			"count":    bson.M{"$sum": 1},
+			"last_id":  bson.M{"$max": "$_id"},
+			"updated":  bson.M{"$max": "$" + updatedAtField},
+			"ingested": bson.M{"$max": "$" + liveIngestedField},
+		}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var results []bson.M
+	if err := cur.All(context.Background(), &results); err != nil {
+		return "", err
+	}
+
+	if len(results) == 0 {
+		return "empty", nil
+	}
+
+	return fmt.Sprint(results[0]["count"], "|", results[0]["last_id"], "|", results[0]["updated"], "|", results[0]["ingested"]), nil
+}
+
+// notModified 查詢前先以資料版本產生 ETag,與 If-None-Match 相同時回應 304(不查詢資料)
+// 無法取得版本時回傳 false,照常查詢(由 httpCache 依回應內容產生 ETag)
+func notModified(c *fiber.Ctx, dbName string, collectionName string, filter bson.M) bool {
+
+	if c.Method() != fiber.MethodGet {
+		return false
+	}
+
+	version, err := dataVersion(dbName, collectionName, filter)
+	if err != nil {
+		return false
+	}
+
+	etag := strongETag(c, []byte(version))
+	c.Set(fiber.HeaderETag, etag)
+	c.Vary(fiber.HeaderAcceptEncoding)
+
+	if !etagMatches(c.Get(fiber.HeaderIfNoneMatch), etag) {
+		return false
+	}
+
+	c.SendStatus(fiber.StatusNotModified)
+
+	return true
+}
+
+// etagMatches If-None-Match 是否包含此 ETag(If-None-Match 依規範使用弱比較,忽略 W/)
+func etagMatches(ifNoneMatch string, etag string) bool {
+
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// httpCache GET 回應加上 ETag,與 If-None-Match 相同時回應 304 不帶內容
+// 已由 notModified 依資料版本產生 ETag 的回應不再計算;其他回應(ex: 統計報表)依回應內容產生
+// 沒有設定 Cache-Control 的回應預設為 no-cache(每次都要以 ETag 確認)
+func httpCache(c *fiber.Ctx) {
+
+	c.Next()
+
+	if c.Method() != fiber.MethodGet {
+		return
+	}
+
+	response := &c.Fasthttp.Response
+	if response.StatusCode() != fiber.StatusOK || response.IsBodyStream() {
+		return
+	}
+
+	if len(response.Header.Peek(fiber.HeaderCacheControl)) == 0 {
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+	}
+
+	etag := string(response.Header.Peek(fiber.HeaderETag))
+	if etag == "" {
+		etag = strongETag(c, response.Body())
+		c.Set(fiber.HeaderETag, etag)
+		c.Vary(fiber.HeaderAcceptEncoding)
+	}
+
+	if etagMatches(c.Get(fiber.HeaderIfNoneMatch), etag) {
+		response.SetStatusCode(fiber.StatusNotModified)
+		response.ResetBody()
+	}
+}
+
+// dateIsClosed 營業日是否已結算(見 statisticsSettleAt,跨夜班下班後才結算;之後只有補登會異動)
+// 只適用出勤資料,環控資料見 setEnvCacheControl
+func dateIsClosed(date time.Time) bool {
+
+	table, err := loadCachedShiftTable()
+	if err != nil {
+		return false
+	}
+
+	return !time.Now().Before(statisticsSettleAt(date, table))
+}
+
+// setDateCacheControl 查詢的營業日都已結算時允許快取 settings.ClosedDateMaxAgeSeconds 秒,否則每次都要確認
+func setDateCacheControl(c *fiber.Ctx, dates ...time.Time) {
+
+	if len(dates) == 0 {
+		return
+	}
+
+	for _, date := range dates {
+		if !dateIsClosed(date) {
+			c.Set(fiber.HeaderCacheControl, "no-cache")
+			return
+		}
+	}
+
+	c.Set(fiber.HeaderCacheControl, "private, max-age="+strconv.Itoa(settings.ClosedDateMaxAgeSeconds))
+}
+
+// setDateParamCacheControl 依路徑的日期參數設定 Cache-Control(沒給日期或格式錯誤時不快取)
+func setDateParamCacheControl(c *fiber.Ctx, myDate string) {
+
+	date, err := model.ParseDate(myDate)
+	if err != nil {
+		return
+	}
+
+	setDateCacheControl(c, date)
+}
@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/* 以下為列表回應的欄位選擇(?fields=name,date 只回傳指定欄位,預設不回傳照片等大型欄位,?include=pic 才回傳) */
+
+// listFieldPattern 可指定的欄位名稱(可用 . 指定子欄位)
+var listFieldPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z0-9_]+)*$`)
+
+// listView 列表要回傳的欄位
+type listView struct {
+	fields     map[string]bool // fields= 指定的第一層欄位(空的代表全部)
+	projection bson.M          // Mongo projection(nil 代表不限定)
+}
+
+// splitQueryList 拆解逗號分隔的查詢參數
+func splitQueryList(value string) []string {
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// parseListView 解析 fields、include 參數,heavy 為預設不回傳的大型欄位
+// 有給 fields 時只回傳指定欄位(id 一律回傳);沒給時回傳 heavy 以外的全部欄位
+func parseListView(c *fiber.Ctx, heavy ...string) (listView, error) {
+
+	view := listView{}
+
+	fields := splitQueryList(c.Query("fields"))
+	include := splitQueryList(c.Query("include"))
+
+	if len(fields) > 0 {
+
+		view.fields = map[string]bool{"id": true, "_id": true}
+		view.projection = bson.M{}
+
+		for _, field := range fields {
+
+			if !listFieldPattern.MatchString(field) {
+				return view, errors.New("欄位名稱格式錯誤: " + field)
+			}
+
+			if field == "id" {
+				field = "_id"
+			}
+
+			view.projection[field] = 1
+			view.fields[strings.Split(field, ".")[0]] = true
+		}
+
+		return view, nil
+	}
+
+	included := map[string]bool{}
+	for _, field := range include {
+
+		if len(heavy) == 0 {
+			return view, errors.New("此列表沒有可 include 的欄位")
+		}
+
+		if !containsString(heavy, field) {
+			return view, errors.New("include 只支援: " + strings.Join(heavy, ","))
+		}
+
+		included[field] = true
+	}
+
+	for _, field := range heavy {
+		if !included[field] {
+			if view.projection == nil {
+				view.projection = bson.M{}
+			}
+			view.projection[field] = 0
+		}
+	}
+
+	return view, nil
+}
+
+// containsString 字串是否在清單中
+func containsString(list []string, value string) bool {
+
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findOptions 查詢選項(已設定 projection)
+func (view listView) findOptions() *options.FindOptions {
+
+	opts := options.Find()
+	if view.projection != nil {
+		opts.SetProjection(view.projection)
+	}
+
+	return opts
+}
+
+// trim 只保留 fields 指定的欄位(struct 沒有查出的欄位也會輸出零值,所以回應前再過濾一次)
+func (view listView) trim(data interface{}) (interface{}, error) {
+
+	if len(view.fields) == 0 {
+		return data, nil
+	}
+
+	content, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(content, &items); err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		for key := range item {
+			if !view.fields[key] {
+				delete(item, key)
+			}
+		}
+	}
+
+	return items, nil
+}
+
+// sendListIn 回應JSON物件,其中 field 欄位的列表依 fields 過濾欄位(ex: 出勤趨勢的 points)
+func sendListIn(c *fiber.Ctx, view listView, data interface{}, field string) {
+
+	content, err := json.Marshal(data)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(content, &object); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var list interface{}
+	if err := json.Unmarshal(object[field], &list); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	trimmed, err := view.trim(list)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	result := map[string]interface{}{}
+	for key, value := range object {
+		result[key] = value
+	}
+	result[field] = trimmed
+
+	sendJSON(c, result)
+}
+
+// sendList 回應列表JSON(依 fields 過濾欄位)
+func sendList(c *fiber.Ctx, view listView, data interface{}) {
+
+	trimmed, err := view.trim(data)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	sendJSON(c, trimmed)
+}
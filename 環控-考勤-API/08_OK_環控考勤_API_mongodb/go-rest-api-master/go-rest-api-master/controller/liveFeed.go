@@ -0,0 +1,414 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Live feed(Server-Sent Events 即時推播打卡與統計) 相關 functions */
+
+const (
+	liveEventCheckIn    = "check_in"   // 打卡紀錄新增、修改、刪除
+	liveEventStatistics = "statistics" // 統計變動
+	liveEventHello      = "hello"      // 連線成功
+	liveEventHeartbeat  = "heartbeat"  // 心跳
+)
+
+// liveEvent 推播事件
+type liveEvent struct {
+	name       string
+	department string // 所屬部門(統計的全公司合計為空字串)
+	data       []byte
+}
+
+// liveClient 一個連線中的用戶端
+type liveClient struct {
+	departments map[string]bool // 訂閱的部門(空的代表全部)
+	events      chan liveEvent
+}
+
+// wants 是否訂閱此事件
+func (client *liveClient) wants(event liveEvent) bool {
+	return len(client.departments) == 0 || client.departments[event.department]
+}
+
+// liveHub 管理所有連線並分送事件
+type liveHub struct {
+	sync.Mutex
+	clients map[*liveClient]bool
+}
+
+// hub :全域的推播中心
+var hub = &liveHub{clients: map[*liveClient]bool{}}
+
+// subscribe 加入連線
+func (h *liveHub) subscribe(departments []string) *liveClient {
+
+	client := &liveClient{
+		departments: map[string]bool{},
+		events:      make(chan liveEvent, settings.LiveFeedBufferSize),
+	}
+
+	for _, department := range departments {
+		client.departments[department] = true
+	}
+
+	h.Lock()
+	h.clients[client] = true
+	h.Unlock()
+
+	return client
+}
+
+// unsubscribe 移除連線
+func (h *liveHub) unsubscribe(client *liveClient) {
+	h.Lock()
+	delete(h.clients, client)
+	h.Unlock()
+}
+
+// count 目前連線數
+func (h *liveHub) count() int {
+	h.Lock()
+	defer h.Unlock()
+	return len(h.clients)
+}
+
+// broadcast 分送事件(用戶端來不及接收時丟棄,不阻塞寫入流程)
+func (h *liveHub) broadcast(name string, department string, data interface{}) {
+
+	content, err := json.Marshal(data)
+	if err != nil {
+		fmt.Println("即時推播失敗:", err)
+		return
+	}
+
+	event := liveEvent{name: name, department: department, data: content}
+
+	h.Lock()
+	defer h.Unlock()
+
+	for client := range h.clients {
+
+		if !client.wants(event) {
+			continue
+		}
+
+		select {
+		case client.events <- event:
+		default:
+		}
+	}
+}
+
+// writeLiveEvent 寫出一個 SSE 事件
+func writeLiveEvent(w *bufio.Writer, event liveEvent) error {
+
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, event.data); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// 即時推播(/live?department=A,B 只訂閱指定部門)
+// 事件: check_in(打卡新增、修改、刪除)、statistics(統計與變動量)、heartbeat(心跳)
+func getLiveFeed(c *fiber.Ctx) {
+
+	departments := splitQueryList(c.Query("department"))
+
+	c.Set(fiber.HeaderContentType, "text/event-stream; charset=utf-8")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // 經過 nginx 時不要緩衝
+
+	c.Fasthttp.SetBodyStreamWriter(func(w *bufio.Writer) {
+
+		client := hub.subscribe(departments)
+		defer hub.unsubscribe(client)
+
+		fmt.Println("即時推播連線 部門=", departments, "連線數=", hub.count())
+
+		hello, _ := json.Marshal(fiber.Map{"departments": departments})
+		if err := writeLiveEvent(w, liveEvent{name: liveEventHello, data: hello}); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(time.Duration(settings.LiveFeedHeartbeatSeconds) * time.Second)
+		defer heartbeat.Stop()
+
+		for {
+
+			var event liveEvent
+
+			select {
+			case event = <-client.events:
+			case now := <-heartbeat.C:
+				event = liveEvent{name: liveEventHeartbeat, data: []byte(`"` + now.Format(model.DateTimeLayout) + `"`)}
+			}
+
+			// 用戶端斷線時寫入失敗,結束連線
+			if err := writeLiveEvent(w, event); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// liveCheckInDocument 推播用的打卡紀錄(不含照片,_id 轉為 id)
+func liveCheckInDocument(record bson.M) bson.M {
+
+	document := bson.M{}
+	for key, value := range record {
+		switch key {
+		case "pic":
+		case "_id":
+			if objID, ok := value.(primitive.ObjectID); ok {
+				document["id"] = objID.Hex()
+			}
+		default:
+			document[key] = value
+		}
+	}
+
+	return document
+}
+
+// publishCheckIn 推播打卡紀錄異動,並重新計算該營業日的統計
+// action: create、update、delete
+func publishCheckIn(action string, record bson.M) {
+
+	department, _ := record["department"].(string)
+
+	hub.broadcast(liveEventCheckIn, department, fiber.Map{
+		"action": action,
+		"record": liveCheckInDocument(record),
+	})
+
+	businessDate, _ := record["business_date"].(string)
+	if businessDate == "" {
+		businessDate, _ = record["date"].(string)
+	}
+
+	if date, err := model.ParseDate(businessDate); err == nil {
+		liveStatistics.touch(date)
+	}
+}
+
+// liveStatisticsTracker 記錄上次推播的統計,計算變動量
+type liveStatisticsTracker struct {
+	sync.Mutex
+	dirty chan struct{}
+	dates map[string]bool                             // 待重新計算的營業日
+	last  map[string]map[string]model.GroupStatistics // key: 營業日 -> 部門
+}
+
+// liveStatistics :全域的統計變動追蹤
+var liveStatistics = &liveStatisticsTracker{
+	dirty: make(chan struct{}, 1),
+	dates: map[string]bool{},
+	last:  map[string]map[string]model.GroupStatistics{},
+}
+
+// touch 標記營業日需要重新計算統計
+func (tracker *liveStatisticsTracker) touch(date time.Time) {
+
+	tracker.Lock()
+	tracker.dates[date.Format(model.DateLayout)] = true
+	tracker.Unlock()
+
+	select {
+	case tracker.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// flush 重新計算被標記的營業日,推播有變動的部門統計與全公司合計
+func (tracker *liveStatisticsTracker) flush() {
+
+	tracker.Lock()
+	dates := tracker.dates
+	tracker.dates = map[string]bool{}
+	tracker.Unlock()
+
+	for myDate := range dates {
+
+		date, _ := model.ParseDate(myDate)
+
+		statistics, err := groupStatisticsBetween(date, date, groupByDepartment, "")
+		if err != nil {
+			fmt.Println("即時統計失敗:", err)
+			continue
+		}
+
+		total := model.GroupStatistics{Group: "", From: myDate, To: myDate}
+		current := map[string]model.GroupStatistics{}
+
+		for _, statistic := range statistics {
+			current[statistic.Group] = statistic
+			total.Expected += statistic.Expected
+			total.Attended += statistic.Attended
+			total.On_leave += statistic.On_leave
+			total.Absent += statistic.Absent
+		}
+
+		total.Attendance_rate = ratio(total.Attended, total.Expected)
+		current[""] = total
+
+		tracker.Lock()
+		previous := tracker.last[myDate]
+		tracker.last[myDate] = current
+
+		// 只保留最近幾天,避免佔用記憶體
+		for key := range tracker.last {
+			if key < date.AddDate(0, 0, -settings.LiveFeedStatisticsDays).Format(model.DateLayout) {
+				delete(tracker.last, key)
+			}
+		}
+		tracker.Unlock()
+
+		for department, statistic := range current {
+
+			before := previous[department]
+			if previous != nil && before == statistic {
+				continue
+			}
+
+			hub.broadcast(liveEventStatistics, department, fiber.Map{
+				"date":       myDate,
+				"department": department,
+				"statistics": statistic,
+				"delta": fiber.Map{
+					"expected": statistic.Expected - before.Expected,
+					"attended": statistic.Attended - before.Attended,
+					"on_leave": statistic.On_leave - before.On_leave,
+					"absent":   statistic.Absent - before.Absent,
+				},
+			})
+		}
+	}
+}
+
+// liveIngestedField 即時推播第一次讀到打卡紀錄的時間
+// 外部匯入的紀錄 _id 不一定是依時間產生的 ObjectID(或匯入端時鐘不準),不能用 _id 判斷是否為新資料
+const liveIngestedField = "ingested_at"
+
+// markIngested 標記打卡紀錄已讀取(只標記還沒標記過的,回傳實際標記的筆數)
+func markIngested(collection *mongo.Collection, filter bson.M) (int64, error) {
+
+	marked := bson.M{liveIngestedField: nil}
+	for key, value := range filter {
+		marked[key] = value
+	}
+
+	result, err := collection.UpdateMany(context.Background(), marked, bson.M{"$set": bson.M{liveIngestedField: time.Now().Format(model.DateTimeLayout)}})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+// watchNewCheckIns 找出還沒讀取過的打卡紀錄(含外部匯入),標記讀取時間後推播
+func watchNewCheckIns() error {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
+	if err != nil {
+		return err
+	}
+
+	cur, err := collection.Find(
+		context.Background(),
+		bson.M{liveIngestedField: nil},
+		options.Find().SetSort(bson.M{"_id": 1}).SetProjection(bson.M{"pic": 0}).SetLimit(settings.LiveFeedBatchSize),
+	)
+	if err != nil {
+		return err
+	}
+
+	var records []bson.M
+	if err := cur.All(context.Background(), &records); err != nil {
+		return err
+	}
+
+	ids := bson.A{}
+
+	for _, record := range records {
+
+		// 先標記,標記失敗的下次再推播,不會重複推播
+		marked, err := markIngested(collection, bson.M{"_id": record["_id"]})
+		if err != nil {
+			return err
+		}
+
+		if marked == 0 {
+			continue
+		}
+
+		ids = append(ids, record["_id"])
+		publishCheckIn(model.AuditActionCreate, record)
+	}
+
+	// 新紀錄內嵌的照片搬到照片儲存區
+	if len(ids) > 0 {
+		if _, _, err := migrateEmbeddedPhotos(bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+			fmt.Println("新打卡照片搬移失敗:", err)
+		}
+	}
+
+	return nil
+}
+
+// startLiveFeed 啟動即時推播: 定期檢查新增的打卡紀錄(匯入程式直接寫入資料庫),並計算統計變動
+// 透過 API 修改、刪除的紀錄由寫入流程直接推播
+func startLiveFeed() {
+
+	if err := db.EnsureMongoDbIndex(settings.DbName, settings.CollectionNameOfCheckInRecord, bson.D{{Key: liveIngestedField, Value: 1}}); err != nil {
+		fmt.Println("即時推播建立索引失敗:", err)
+	}
+
+	// 啟動前已存在的紀錄只標記,不推播舊資料(停機期間匯入紀錄的照片以 migrate-photos 指令搬移)
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
+	if err == nil {
+		_, err = markIngested(collection, bson.M{})
+	}
+
+	if err != nil {
+		fmt.Println("即時推播標記既有打卡紀錄失敗:", err)
+	}
+
+	go func() {
+
+		ticker := time.NewTicker(time.Duration(settings.LiveFeedPollSeconds) * time.Second)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := watchNewCheckIns(); err != nil {
+				fmt.Println("即時推播檢查新打卡失敗:", err)
+			}
+		}
+	}()
+
+	go func() {
+		for range liveStatistics.dirty {
+			if hub.count() > 0 {
+				liveStatistics.flush()
+			}
+		}
+	}()
+}
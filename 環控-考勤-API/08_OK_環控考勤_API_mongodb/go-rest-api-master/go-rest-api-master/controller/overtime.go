@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber"
+
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Overtime(加班) 相關 functions */
+
+// calculateOvertime 計算員工單日加班,沒有加班時回傳 false
+// 工作日: 最後一筆打卡超過班別下班時間的部分
+// 休息日、例假日、國定假日: 第一筆到最後一筆打卡的全部時間(超過4小時扣除休息時間)
+func calculateOvertime(attendance *dailyAttendance, shift model.Shift, dayType string) (model.OvertimeRecord, bool) {
+
+	firstIn, ok := attendance.firstIn()
+	if !ok {
+		return model.OvertimeRecord{}, false
+	}
+
+	lastOut, ok := attendance.lastOut()
+	if !ok {
+		return model.OvertimeRecord{}, false
+	}
+
+	var rawMinutes int
+
+	if dayType == model.DayTypeWorkday {
+		rawMinutes = int(lastOut.Sub(shift.EndAt(attendance.Date)) / time.Minute)
+	} else {
+		rawMinutes = workedMinutes(firstIn, lastOut)
+	}
+
+	minutes := model.RoundOvertime(rawMinutes, settings.OvertimeRoundingMinutes)
+	if minutes <= 0 {
+		return model.OvertimeRecord{}, false
+	}
+
+	tiers := model.SplitOvertime(dayType, minutes)
+
+	return model.OvertimeRecord{
+		Name:             attendance.Name,
+		Department:       attendance.Department,
+		Date:             attendance.Date.Format(model.DateLayout),
+		Day_type:         dayType,
+		Shift_code:       shift.Code,
+		First_in:         firstIn.Format(model.DateTimeLayout),
+		Last_out:         lastOut.Format(model.DateTimeLayout),
+		Raw_minutes:      rawMinutes,
+		Overtime_minutes: minutes,
+		Tiers:            tiers,
+		Weighted_hours:   model.WeightedHours(tiers),
+	}, true
+}
+
+// overtimeRecordsBetween 計算期間內所有員工每日加班
+func overtimeRecordsBetween(from time.Time, to time.Time) ([]model.OvertimeRecord, error) {
+
+	attendances, err := loadDailyAttendance(from, to, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := loadShiftTable()
+	if err != nil {
+		return nil, err
+	}
+
+	holidays, err := loadHolidays(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []model.OvertimeRecord
+
+	for _, attendance := range attendances {
+
+		shift, assignment := table.lookup(attendance.Name)
+		dayType := model.DayType(attendance.Date, holidays, assignment)
+
+		if record, ok := calculateOvertime(attendance, shift, dayType); ok {
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
+
+// summarizeOvertime 將每日加班彙總為每位員工的月加班
+func summarizeOvertime(month string, records []model.OvertimeRecord) []model.OvertimeSummary {
+
+	summaries := map[string]*model.OvertimeSummary{}
+
+	for _, record := range records {
+
+		summary, ok := summaries[record.Name]
+		if !ok {
+			summary = &model.OvertimeSummary{
+				Name:                record.Name,
+				Department:          record.Department,
+				Month:               month,
+				Hours_by_multiplier: map[string]float64{},
+			}
+			summaries[record.Name] = summary
+		}
+
+		summary.Days++
+		summary.Weighted_hours += record.Weighted_hours
+
+		switch record.Day_type {
+		case model.DayTypeWorkday:
+			summary.Workday_minutes += record.Overtime_minutes
+		case model.DayTypeRestDay:
+			summary.Rest_day_minutes += record.Overtime_minutes
+		default:
+			summary.Holiday_minutes += record.Overtime_minutes
+		}
+
+		for _, tier := range record.Tiers {
+			key := strconv.FormatFloat(tier.Multiplier, 'f', 2, 64)
+			summary.Hours_by_multiplier[key] += float64(tier.Minutes) / 60
+		}
+	}
+
+	results := make([]model.OvertimeSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		results = append(results, *summary)
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+
+	return results
+}
+
+// 取得指定日期所有員工的加班
+func getOvertime(c *fiber.Ctx) {
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	date, err := model.ParseDate(c.Params("date"))
+	if err != nil {
+		sendError(c, 400, "日期格式錯誤(應為YYYY-MM-DD)")
+		return
+	}
+
+	fmt.Println("查詢日期=", date.Format(model.DateLayout))
+
+	records, err := overtimeRecordsBetween(date, date)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 若查無資料
+	if records == nil {
+		c.SendStatus(404)
+		return
+	}
+
+	sendList(c, view, records)
+}
+
+// 取得指定月份每位員工的加班彙總(供薪資計算)
+func getMonthlyOvertime(c *fiber.Ctx) {
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	month := c.Params("month")
+
+	from, to, err := parseMonth(month)
+	if err != nil {
+		sendError(c, 400, "月份格式錯誤(應為YYYY-MM)")
+		return
+	}
+
+	fmt.Println("查詢月份=", month)
+
+	records, err := overtimeRecordsBetween(from, to)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 若查無資料
+	if records == nil {
+		c.SendStatus(404)
+		return
+	}
+
+	sendList(c, view, summarizeOvertime(month, records))
+}
@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/gofiber/fiber"
+
+	"my-rest-api/model"
+	"my-rest-api/payroll"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Payroll(薪資檔匯出) 相關 functions */
+
+// layoutNamePattern :版面名稱只允許英數字、底線、減號(避免讀取版面目錄以外的檔案)
+var layoutNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// loadPayrollLayout 讀取版面定義檔(settings.PayrollLayoutDirectory/<name>.json)
+func loadPayrollLayout(name string) (payroll.Layout, error) {
+
+	if !layoutNamePattern.MatchString(name) {
+		return payroll.Layout{}, fmt.Errorf("版面名稱格式錯誤: %s", name)
+	}
+
+	return payroll.LoadLayout(filepath.Join(settings.PayrollLayoutDirectory, name+".json"))
+}
+
+// buildPayrollRows 產生每位員工的月薪資資料(出勤、請假、加班)
+// 可用欄位:
+// employee_id、name、department、month、period_start、period_end、
+// worked_days、late_days、late_minutes、absent_days、worked_hours、
+// leave_days、leave_hours、leave_days.<假別>、leave_hours.<假別>、
+// overtime_hours、overtime_hours.<倍率>、overtime_workday_hours、overtime_rest_day_hours、
+// overtime_holiday_hours、overtime_weighted_hours
+func buildPayrollRows(month string, from time.Time, to time.Time) ([]payroll.Row, error) {
+
+	employees, err := loadEmployeesBetween(from, to, "", true)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := overtimeRecordsBetween(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	overtimeOfName := map[string]model.OvertimeSummary{}
+	for _, summary := range summarizeOvertime(month, records) {
+		overtimeOfName[summary.Name] = summary
+	}
+
+	rows := make([]payroll.Row, 0, len(employees))
+
+	for _, employee := range employees {
+
+		timesheet, err := buildTimesheet(employee, month, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		totals := timesheet.Totals
+
+		row := payroll.Row{
+			"employee_id":  employee.Employee_id,
+			"name":         employee.Name,
+			"department":   employee.Department,
+			"month":        from,
+			"period_start": from,
+			"period_end":   to,
+			"worked_days":  totals.Present_days,
+			"late_days":    totals.Late_days,
+			"late_minutes": totals.Late_minutes,
+			"absent_days":  totals.Absent_days,
+			"worked_hours": float64(totals.Worked_minutes) / 60,
+			"leave_days":   totals.Leave_days,
+			"leave_hours":  totals.Leave_days * settings.LeaveHoursPerDay,
+		}
+
+		for leaveType, days := range totals.Leave_by_type {
+			row["leave_days."+leaveType] = days
+			row["leave_hours."+leaveType] = days * settings.LeaveHoursPerDay
+		}
+
+		overtime := overtimeOfName[employee.Name]
+
+		var overtimeHours float64
+		for multiplier, hours := range overtime.Hours_by_multiplier {
+			row["overtime_hours."+multiplier] = hours
+			overtimeHours += hours
+		}
+
+		row["overtime_hours"] = overtimeHours
+		row["overtime_workday_hours"] = float64(overtime.Workday_minutes) / 60
+		row["overtime_rest_day_hours"] = float64(overtime.Rest_day_minutes) / 60
+		row["overtime_holiday_hours"] = float64(overtime.Holiday_minutes) / 60
+		row["overtime_weighted_hours"] = overtime.Weighted_hours
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// 匯出指定月份的薪資檔(/payroll/export/:month?layout=default)
+// 版面定義檔放在 settings.PayrollLayoutDirectory,更換薪資廠商只需新增版面定義檔
+func exportPayroll(c *fiber.Ctx) {
+
+	month := c.Params("month")
+
+	from, to, err := parseMonth(month)
+	if err != nil {
+		sendError(c, 400, "月份格式錯誤(應為YYYY-MM)")
+		return
+	}
+
+	layoutName := c.Query("layout", settings.DefaultPayrollLayout)
+
+	layout, err := loadPayrollLayout(layoutName)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	fmt.Println("匯出薪資檔=", month, "版面=", layoutName)
+
+	rows, err := buildPayrollRows(month, from, to)
+	if err != nil {
+		sendError(c, aggregateErrorStatus(err), err.Error())
+		return
+	}
+
+	// 先產生完整檔案,數字超過欄寬時回傳錯誤,不輸出不完整的薪資檔
+	var file bytes.Buffer
+	if err := payroll.Write(&file, layout, rows); err != nil {
+		sendError(c, 422, err.Error())
+		return
+	}
+
+	contentType := "text/plain"
+	if layout.Format == payroll.FormatCSV {
+		contentType = "text/csv"
+	}
+
+	c.Attachment(fmt.Sprintf("payroll_%s_%s.%s", layoutName, month, layout.Extension))
+	c.Set(fiber.HeaderContentType, contentType+"; charset="+layout.Encoding)
+	c.SendBytes(file.Bytes())
+}
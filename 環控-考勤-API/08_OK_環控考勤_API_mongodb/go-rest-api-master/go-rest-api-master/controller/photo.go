@@ -0,0 +1,462 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/photo"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Photo(打卡照片存放在 GridFS 或本機磁碟,打卡紀錄只保留參照) 相關 functions */
+
+// openPhotoStore 開啟照片儲存區
+func openPhotoStore(name string) (photo.Store, error) {
+
+	switch name {
+
+	case photo.StoreGridFS:
+
+		database, err := db.GetMongoDbDatabase(settings.DbName)
+		if err != nil {
+			return nil, err
+		}
+
+		return photo.NewGridFSStore(database, settings.PhotoBucketName)
+
+	case photo.StoreDisk:
+		return photo.NewDiskStore(settings.PhotoDirectory)
+	}
+
+	return nil, errors.New("不支援的照片儲存區: " + name)
+}
+
+// photoRecord 打卡紀錄的照片欄位
+type photoRecord struct {
+	ID         primitive.ObjectID              `bson:"_id"`
+	Pic        string                          `bson:"pic"`
+	Pic_ref    string                          `bson:"pic_ref"`
+	Pic_type   string                          `bson:"pic_type"`
+	Pic_thumbs map[string]model.PhotoThumbnail `bson:"pic_thumbs"`
+}
+
+// photoRecordProjection 只讀取照片欄位
+var photoRecordProjection = bson.M{"pic": 1, "pic_ref": 1, "pic_type": 1, "pic_thumbs": 1}
+
+// readStoredPhoto 從照片儲存區讀取參照的照片
+func readStoredPhoto(ref string) ([]byte, error) {
+
+	name, key, err := photo.ParseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := openPhotoStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.Get(key)
+}
+
+// readPhoto 讀取打卡紀錄的照片,回傳內容類型與內容(搬移前的舊資料直接解開內嵌照片)
+func readPhoto(record photoRecord) (string, []byte, error) {
+
+	if record.Pic_ref == "" {
+
+		if !photo.IsDataURL(record.Pic) {
+			return "", nil, photo.ErrNotFound
+		}
+
+		return photo.DecodeDataURL(record.Pic)
+	}
+
+	data, err := readStoredPhoto(record.Pic_ref)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return record.Pic_type, data, nil
+}
+
+// isThumbnailSize 是否為設定的縮圖尺寸
+func isThumbnailSize(size int) bool {
+
+	for _, allowed := range settings.PhotoThumbnailSizes {
+		if allowed == size {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readThumbnail 讀取縮圖,還沒有產生過的先產生並存到照片儲存區(與原圖放在一起)
+func readThumbnail(collection *mongo.Collection, record photoRecord, size int) (string, []byte, error) {
+
+	if thumbnail, ok := record.Pic_thumbs[strconv.Itoa(size)]; ok {
+
+		data, err := readStoredPhoto(thumbnail.Ref)
+		if err == nil {
+			return thumbnail.Type, data, nil
+		}
+
+		// 縮圖檔遺失時重新產生
+		if err != photo.ErrNotFound {
+			return "", nil, err
+		}
+	}
+
+	thumbnail, data, err := createThumbnail(collection, record, size)
+	return thumbnail.Type, data, err
+}
+
+// createThumbnail 由原圖產生縮圖,存到照片儲存區並記錄在打卡紀錄的 pic_thumbs
+func createThumbnail(collection *mongo.Collection, record photoRecord, size int) (model.PhotoThumbnail, []byte, error) {
+
+	var thumbnail model.PhotoThumbnail
+
+	_, original, err := readPhoto(record)
+	if err != nil {
+		return thumbnail, nil, err
+	}
+
+	contentType, data, err := photo.Thumbnail(original, size, settings.PhotoThumbnailMaxPixels)
+	if err != nil {
+		return thumbnail, nil, err
+	}
+
+	store, err := openPhotoStore(settings.PhotoStore)
+	if err != nil {
+		return thumbnail, nil, err
+	}
+
+	key, err := store.Put(fmt.Sprintf("%s_%d%s", record.ID.Hex(), size, photo.Extension(contentType)), data)
+	if err != nil {
+		return thumbnail, nil, err
+	}
+
+	thumbnail = model.PhotoThumbnail{Ref: photo.Reference(store, key), Type: contentType}
+
+	field := "pic_thumbs." + strconv.Itoa(size)
+	if _, err := collection.UpdateOne(context.Background(), bson.M{"_id": record.ID}, bson.M{"$set": bson.M{field: thumbnail}, "$currentDate": bson.M{updatedAtField: true}}); err != nil {
+		store.Delete(key)
+		return thumbnail, nil, err
+	}
+
+	// 換掉的舊縮圖(檔案遺失或重新產生)不再使用
+	if previous, ok := record.Pic_thumbs[strconv.Itoa(size)]; ok && previous.Ref != thumbnail.Ref {
+		if name, oldKey, err := photo.ParseReference(previous.Ref); err == nil && name == store.Name() && oldKey != key {
+			store.Delete(oldKey)
+		}
+	}
+
+	return thumbnail, data, nil
+}
+
+// 取得打卡照片(?size=64 取得縮圖,尺寸需為設定的縮圖尺寸)
+func getCheckInRecordPhoto(c *fiber.Ctx) {
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		sendError(c, 400, "id格式錯誤")
+		return
+	}
+
+	size := 0
+	if c.Query("size") != "" {
+
+		size, err = strconv.Atoi(c.Query("size"))
+		if err != nil || !isThumbnailSize(size) {
+			sendError(c, 400, fmt.Sprint("size 必須為 ", settings.PhotoThumbnailSizes, " 其中之一"))
+			return
+		}
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var record photoRecord
+	err = collection.FindOne(
+		context.Background(),
+		bson.M{"_id": objID},
+		options.FindOne().SetProjection(photoRecordProjection),
+	).Decode(&record)
+
+	if err == mongo.ErrNoDocuments {
+		c.SendStatus(404)
+		return
+	}
+
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var contentType string
+	var data []byte
+
+	if size > 0 {
+		contentType, data, err = readThumbnail(collection, record, size)
+	} else {
+		contentType, data, err = readPhoto(record)
+	}
+
+	if err == photo.ErrNotFound {
+		sendError(c, 404, "此打卡紀錄沒有照片")
+		return
+	}
+
+	if err == photo.ErrUnsupportedType {
+		sendError(c, 415, err.Error())
+		return
+	}
+
+	if err == photo.ErrImageTooLarge {
+		sendError(c, 422, err.Error())
+		return
+	}
+
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 只回應允許的圖片格式,並禁止瀏覽器自行判斷內容類型
+	contentType, err = photo.ServeContentType(contentType, data)
+	if err != nil {
+		sendError(c, 415, err.Error())
+		return
+	}
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	c.Set(fiber.HeaderCacheControl, "private, max-age=86400")
+	c.SendBytes(data)
+}
+
+// BackfillPhotoThumbnails 為已有照片、但還沒有縮圖的打卡紀錄產生所有設定尺寸的縮圖(可重複執行)
+// 回傳產生的縮圖數與失敗數
+func BackfillPhotoThumbnails() (int, int, error) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	missing := bson.A{}
+	for _, size := range settings.PhotoThumbnailSizes {
+		missing = append(missing, bson.M{"pic_thumbs." + strconv.Itoa(size): bson.M{"$exists": false}})
+	}
+
+	created, failed := 0, 0
+	lastID := primitive.NilObjectID
+
+	for {
+
+		// 依 _id 分批,失敗的紀錄不會被重複讀取
+		filter := bson.M{
+			"_id": bson.M{"$gt": lastID},
+			"$and": bson.A{
+				bson.M{"$or": bson.A{
+					bson.M{"pic_ref": bson.M{"$nin": bson.A{"", nil}}},
+					bson.M{"pic": bson.M{"$regex": "^data:"}},
+				}},
+				bson.M{"$or": missing},
+			},
+		}
+
+		cur, err := collection.Find(
+			context.Background(),
+			filter,
+			options.Find().SetSort(bson.M{"_id": 1}).SetLimit(settings.PhotoMigrationBatchSize).SetProjection(photoRecordProjection),
+		)
+		if err != nil {
+			return created, failed, err
+		}
+
+		var records []photoRecord
+		if err := cur.All(context.Background(), &records); err != nil {
+			return created, failed, err
+		}
+
+		if len(records) == 0 {
+			return created, failed, nil
+		}
+
+		for _, record := range records {
+
+			lastID = record.ID
+
+			for _, size := range settings.PhotoThumbnailSizes {
+
+				if _, ok := record.Pic_thumbs[strconv.Itoa(size)]; ok {
+					continue
+				}
+
+				if _, _, err := createThumbnail(collection, record, size); err != nil {
+					fmt.Println("縮圖產生失敗 id=", record.ID.Hex(), "size=", size, err)
+					failed++
+					continue
+				}
+
+				created++
+			}
+		}
+
+		fmt.Println("縮圖產生中 已產生=", created, "失敗=", failed)
+	}
+}
+
+// embeddedPhotoFilter 照片仍內嵌在打卡紀錄中(尚未搬移)
+var embeddedPhotoFilter = bson.M{"pic": bson.M{"$regex": "^data:"}}
+
+// MigrateEmbeddedPhotos 把打卡紀錄內嵌的照片搬到照片儲存區,紀錄改為只保留參照(可重複執行,只處理尚未搬移的紀錄)
+// dryRun 為 true 時只計算筆數,回傳搬移筆數與失敗筆數
+func MigrateEmbeddedPhotos(dryRun bool) (int, int, error) {
+
+	if !dryRun {
+		return migrateEmbeddedPhotos(bson.M{})
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	count, err := collection.CountDocuments(context.Background(), embeddedPhotoFilter)
+	return int(count), 0, err
+}
+
+// migrateEmbeddedPhotos 搬移符合條件且照片仍內嵌的打卡紀錄,並寫入摘要異動紀錄,回傳搬移筆數與失敗筆數
+// 即時推播讀到新紀錄時只搬移新紀錄(filter 為 _id 清單),啟動時搬移全部
+func migrateEmbeddedPhotos(filter bson.M) (int, int, error) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	store, err := openPhotoStore(settings.PhotoStore)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// 中途失敗時已搬移的照片也要記錄
+	migrated, failed, err := migratePhotoBatches(collection, store, filter)
+	if auditErr := auditPhotoMigration(migrated, failed); err == nil {
+		err = auditErr
+	}
+
+	return migrated, failed, err
+}
+
+// migratePhotoBatches 依 _id 分批搬移內嵌照片,回傳搬移筆數與失敗筆數
+func migratePhotoBatches(collection *mongo.Collection, store photo.Store, filter bson.M) (int, int, error) {
+
+	migrated, failed := 0, 0
+	lastID := primitive.NilObjectID
+
+	for {
+
+		// 依 _id 分批,失敗的紀錄不會被重複讀取
+		batchFilter := bson.M{"$and": bson.A{filter, embeddedPhotoFilter, bson.M{"_id": bson.M{"$gt": lastID}}}}
+		cur, err := collection.Find(
+			context.Background(),
+			batchFilter,
+			options.Find().SetSort(bson.M{"_id": 1}).SetLimit(settings.PhotoMigrationBatchSize).SetProjection(bson.M{"pic": 1}),
+		)
+		if err != nil {
+			return migrated, failed, err
+		}
+
+		var records []struct {
+			ID  primitive.ObjectID `bson:"_id"`
+			Pic string             `bson:"pic"`
+		}
+
+		if err := cur.All(context.Background(), &records); err != nil {
+			return migrated, failed, err
+		}
+
+		if len(records) == 0 {
+			return migrated, failed, nil
+		}
+
+		for _, record := range records {
+
+			lastID = record.ID
+
+			if err := migratePhoto(collection, store, record.ID, record.Pic); err != nil {
+				fmt.Println("照片搬移失敗 id=", record.ID.Hex(), err)
+				failed++
+				continue
+			}
+
+			migrated++
+		}
+
+		fmt.Println("照片搬移中 已搬移=", migrated, "失敗=", failed)
+	}
+}
+
+// auditPhotoMigration 照片搬移後寫入摘要異動紀錄(沒有搬移任何照片時不記錄)
+func auditPhotoMigration(migrated int, failed int) error {
+
+	if migrated == 0 {
+		return nil
+	}
+
+	summary := bson.M{"migrated": migrated, "failed": failed, "store": settings.PhotoStore}
+
+	return writeAuditLog(model.AuditEntityCheckInRecord, "pic", model.AuditActionBatchUpdate, model.AuditActorSystem, "內嵌照片搬移至照片儲存區", nil, summary)
+}
+
+// migratePhoto 搬移一筆打卡紀錄的內嵌照片
+func migratePhoto(collection *mongo.Collection, store photo.Store, objID primitive.ObjectID, pic string) error {
+
+	contentType, data, err := photo.DecodeDataURL(pic)
+	if err != nil {
+		return err
+	}
+
+	key, err := store.Put(objID.Hex()+photo.Extension(contentType), data)
+	if err != nil {
+		return err
+	}
+
+	// 照片在搬移期間被改過就不更新,留給下次搬移
+	result, err := collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": objID, "pic": pic},
+		bson.M{"$set": bson.M{"pic": "", "pic_ref": photo.Reference(store, key), "pic_type": contentType}, "$currentDate": bson.M{updatedAtField: true}},
+	)
+
+	if err == nil && result.MatchedCount == 0 {
+		err = errors.New("紀錄已變動")
+	}
+
+	if err != nil {
+		store.Delete(key)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber"
+
+	"my-rest-api/model"
+)
+
+/* 以下為 Report(列印用 HTML 報表) 相關 functions */
+
+// weekdayNames 星期中文名稱
+var weekdayNames = []string{"日", "一", "二", "三", "四", "五", "六"}
+
+// dayTypeNames 日別中文名稱
+var dayTypeNames = map[string]string{
+	model.DayTypeWorkday:      "工作日",
+	model.DayTypeRestDay:      "休息日",
+	model.DayTypeRegularLeave: "例假日",
+	model.DayTypeHoliday:      "國定假日",
+}
+
+// reportEntry 報表中的一位員工
+type reportEntry struct {
+	Name       string
+	Department string
+	Position   string
+	First_in   string
+	Last_out   string
+	Leave_type string
+}
+
+// dailyReport 每日出勤報表
+type dailyReport struct {
+	Date        string
+	Weekday     string
+	Day_type    string
+	Printed_at  string
+	Attended    []reportEntry   // 實到
+	Not_arrived []reportEntry   // 未到(工作日沒有打卡也沒有請假)
+	Leave       []reportEntry   // 請假
+	Guests      []model.Visitor // 訪客
+}
+
+// monthlyReport 部門月出勤報表
+type monthlyReport struct {
+	Month       string
+	Department  string
+	Printed_at  string
+	Departments []model.GroupStatistics
+	Total       model.GroupStatistics
+}
+
+// buildDailyReport 產生每日出勤報表
+func buildDailyReport(date time.Time) (dailyReport, error) {
+
+	report := dailyReport{
+		Date:       date.Format(model.DateLayout),
+		Weekday:    weekdayNames[date.Weekday()],
+		Printed_at: time.Now().Format(model.DateTimeLayout),
+	}
+
+	attendances, err := loadDailyAttendance(date, date, nil)
+	if err != nil {
+		return report, err
+	}
+
+	employees, err := loadEmployees("")
+	if err != nil {
+		return report, err
+	}
+
+	table, err := loadShiftTable()
+	if err != nil {
+		return report, err
+	}
+
+	holidays, err := loadHolidays(date, date)
+	if err != nil {
+		return report, err
+	}
+
+	report.Day_type = dayTypeNames[model.DayType(date, holidays, nil)]
+
+	report.Guests, err = loadVisitors(date)
+	if err != nil {
+		return report, err
+	}
+
+	attendanceOfName := map[string]*dailyAttendance{}
+	for _, attendance := range attendances {
+		attendanceOfName[attendance.Name] = attendance
+	}
+
+	// 有打卡紀錄的人
+	for _, attendance := range attendances {
+
+		entry := reportEntry{
+			Name:       attendance.Name,
+			Department: attendance.Department,
+			Position:   attendance.Position,
+			Leave_type: attendance.Leave_type,
+		}
+
+		if firstIn, ok := attendance.firstIn(); ok {
+			entry.First_in = firstIn.Format("15:04")
+		}
+
+		if lastOut, ok := attendance.lastOut(); ok {
+			entry.Last_out = lastOut.Format("15:04")
+		}
+
+		_, assignment := table.lookup(attendance.Name)
+
+		switch {
+		case attendance.Leave_type != "":
+			report.Leave = append(report.Leave, entry)
+		case len(attendance.Punches) > 0:
+			report.Attended = append(report.Attended, entry)
+		case model.DayType(date, holidays, assignment) == model.DayTypeWorkday:
+			report.Not_arrived = append(report.Not_arrived, entry)
+		}
+	}
+
+	// 員工名冊中當天應上班卻沒有任何紀錄的人
+	for _, employee := range employees {
+
+		if _, ok := attendanceOfName[employee.Name]; ok {
+			continue
+		}
+
+		_, assignment := table.lookup(employee.Name)
+		if model.DayType(date, holidays, assignment) != model.DayTypeWorkday {
+			continue
+		}
+
+		report.Not_arrived = append(report.Not_arrived, reportEntry{
+			Name:       employee.Name,
+			Department: employee.Department,
+			Position:   employee.Position,
+		})
+	}
+
+	for _, entries := range [][]reportEntry{report.Attended, report.Not_arrived, report.Leave} {
+		sortReportEntries(entries)
+	}
+
+	return report, nil
+}
+
+// sortReportEntries 依部門、姓名排序
+func sortReportEntries(entries []reportEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Department != entries[j].Department {
+			return entries[i].Department < entries[j].Department
+		}
+		return entries[i].Name < entries[j].Name
+	})
+}
+
+// 每日出勤報表頁面(未指定日期為今天)
+func getDailyReport(c *fiber.Ctx) {
+
+	date := time.Now()
+
+	if c.Params("date") != "" {
+
+		var err error
+		date, err = model.ParseDate(c.Params("date"))
+		if err != nil {
+			sendError(c, 400, "日期格式錯誤(應為YYYY-MM-DD)")
+			return
+		}
+	}
+
+	date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+	fmt.Println("每日出勤報表=", date.Format(model.DateLayout))
+
+	report, err := buildDailyReport(date)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if err := c.Render("daily_report", report); err != nil {
+		sendError(c, 500, err.Error())
+	}
+}
+
+// 部門月出勤報表頁面(可加 ?department= 只看自己部門)
+func getMonthlyReport(c *fiber.Ctx) {
+
+	month := c.Params("month")
+
+	from, to, err := parseMonth(month)
+	if err != nil {
+		sendError(c, 400, "月份格式錯誤(應為YYYY-MM)")
+		return
+	}
+
+	department := c.Query("department")
+	fmt.Println("部門月出勤報表=", month, "部門=", department)
+
+	statistics, err := groupStatisticsBetween(from, to, groupByDepartment, department)
+	if err != nil {
+		sendError(c, aggregateErrorStatus(err), err.Error())
+		return
+	}
+
+	report := monthlyReport{
+		Month:       month,
+		Department:  department,
+		Printed_at:  time.Now().Format(model.DateTimeLayout),
+		Departments: statistics,
+		Total: model.GroupStatistics{
+			Group: "合計",
+			From:  from.Format(model.DateLayout),
+			To:    to.Format(model.DateLayout),
+		},
+	}
+
+	for _, statistic := range statistics {
+		report.Total.Expected += statistic.Expected
+		report.Total.Attended += statistic.Attended
+		report.Total.On_leave += statistic.On_leave
+		report.Total.Absent += statistic.Absent
+	}
+
+	if report.Total.Expected > 0 {
+		report.Total.Attendance_rate = float64(report.Total.Attended) / float64(report.Total.Expected)
+	}
+
+	if err := c.Render("monthly_report", report); err != nil {
+		sendError(c, 500, err.Error())
+	}
+}
@@ -0,0 +1,17 @@
+package controller
+
+import (
+	"github.com/gofiber/fiber"
+)
+
+// sendError 回應錯誤,格式統一為 {"status":400,"error":"錯誤訊息"}
+func sendError(c *fiber.Ctx, status int, message string) {
+	c.Status(status).JSON(fiber.Map{"status": status, "error": message})
+}
+
+// sendJSON 回應JSON
+func sendJSON(c *fiber.Ctx, data interface{}) {
+	if err := c.JSON(data); err != nil {
+		sendError(c, 500, err.Error())
+	}
+}
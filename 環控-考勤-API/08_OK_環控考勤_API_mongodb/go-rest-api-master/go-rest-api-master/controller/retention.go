@@ -0,0 +1,578 @@
+package controller
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/photo"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Retention(照片與個人資料保存期限,排程清理) 相關 functions */
+
+const (
+	retentionTriggerSchedule = "schedule" // 排程執行
+	retentionTriggerCommand  = "command"  // 指令執行
+)
+
+// errRetentionRunning 清理作業執行中
+var errRetentionRunning = errors.New("保存期限清理正在執行中")
+
+// retentionRunning 同時只執行一個清理作業
+var retentionRunning = make(chan struct{}, 1)
+
+// errAnonymizedRange 期間內的打卡紀錄已匿名化,姓名無法再對應員工名冊與班別
+var errAnonymizedRange = errors.New("期間內的打卡紀錄已匿名化,無法依員工重新計算,請改查已結算的每日統計(/checkInStatistics)")
+
+// retentionRules 目前的資料保存規則(期限見 settings)
+// 打卡統計(check_in_statistics)為彙總資料,不在清理範圍
+func retentionRules() []model.RetentionRule {
+
+	return []model.RetentionRule{
+		{
+			Name:        "check_in_photo",
+			Description: "打卡照片保存期限過後刪除",
+			Collection:  settings.CollectionNameOfCheckInRecord,
+			Date_field:  "date",
+			Action:      model.RetentionActionPurgePhoto,
+			Photo_field: "pic",
+			After_days:  settings.PhotoRetentionDays,
+		},
+		{
+			Name:        "visitor_photo",
+			Description: "訪客照片保存期限過後刪除",
+			Collection:  settings.CollectionNameOfVisitor,
+			Date_field:  "visit_date",
+			Action:      model.RetentionActionPurgePhoto,
+			Photo_field: "photo",
+			After_days:  settings.PhotoRetentionDays,
+		},
+		{
+			Name:        "check_in_name",
+			Description: "打卡紀錄姓名匿名化",
+			Collection:  settings.CollectionNameOfCheckInRecord,
+			Date_field:  "date",
+			Action:      model.RetentionActionAnonymize,
+			Fields:      []string{"name"},
+			After_years: settings.PersonalDataRetentionYears,
+		},
+		{
+			Name:         "visitor_personal_data",
+			Description:  "訪客姓名匿名化、清除電話",
+			Collection:   settings.CollectionNameOfVisitor,
+			Date_field:   "visit_date",
+			Action:       model.RetentionActionAnonymize,
+			Fields:       []string{"name"},
+			Clear_fields: []string{"phone"},
+			After_years:  settings.PersonalDataRetentionYears,
+		},
+		{
+			Name:        "exception_name",
+			Description: "出勤異常姓名匿名化",
+			Collection:  settings.CollectionNameOfAttendanceException,
+			Date_field:  "date",
+			Action:      model.RetentionActionAnonymize,
+			Fields:      []string{"name"},
+			After_years: settings.PersonalDataRetentionYears,
+		},
+		{
+			Name:         "correction_personal_data",
+			Description:  "補登申請姓名、員工編號匿名化,清除申請原因",
+			Collection:   settings.CollectionNameOfCorrectionRequest,
+			Date_field:   "date",
+			Action:       model.RetentionActionAnonymize,
+			Fields:       []string{"name", "employee_id"},
+			Clear_fields: []string{"reason"},
+			After_years:  settings.PersonalDataRetentionYears,
+		},
+		{
+			Name:         "audit_personal_data",
+			Description:  "資料異動紀錄清除異動前後資料與原因(保留誰在何時異動了哪筆資料)",
+			Collection:   settings.CollectionNameOfAuditLog,
+			Date_field:   "timestamp",
+			Action:       model.RetentionActionAnonymize,
+			Clear_fields: []string{"before", "after", "reason"},
+			After_years:  settings.PersonalDataRetentionYears,
+		},
+		{
+			Name:         "webhook_payload",
+			Description:  "webhook 傳送紀錄清除傳送內容(含未到人員姓名)",
+			Collection:   settings.CollectionNameOfWebhookDelivery,
+			Date_field:   "created_at",
+			Action:       model.RetentionActionAnonymize,
+			Clear_fields: []string{"payload"},
+			After_years:  settings.PersonalDataRetentionYears,
+		},
+	}
+}
+
+// retentionDayExpression 把 YYYY-MM-DD 或 YYYY-MM-DD HH:MM:SS 字串欄位(可未補零)轉為日期,格式錯誤時為 null
+func retentionDayExpression(field string) bson.M {
+	return dateTimeFromStringExpression("$" + field)
+}
+
+// retentionFilter 超過保存期限且尚未處理的資料
+func retentionFilter(rule model.RetentionRule, cutoff time.Time) bson.M {
+
+	// 日期以 UTC 午夜比較(與 $dateFromParts 相同)
+	cutoffDay := time.Date(cutoff.Year(), cutoff.Month(), cutoff.Day(), 0, 0, 0, 0, time.UTC)
+
+	filter := bson.M{
+		"$expr": bson.M{"$let": bson.M{
+			"vars": bson.M{"day": retentionDayExpression(rule.Date_field)},
+			"in": bson.M{"$and": bson.A{
+				bson.M{"$ne": bson.A{"$$day", nil}},
+				bson.M{"$lt": bson.A{"$$day", cutoffDay}},
+			}},
+		}},
+	}
+
+	switch rule.Action {
+
+	case model.RetentionActionPurgePhoto:
+
+		// 內嵌照片,或照片儲存區的原圖、縮圖參照
+		filter["$or"] = bson.A{
+			bson.M{rule.Photo_field: bson.M{"$nin": bson.A{"", nil}}},
+			bson.M{"pic_ref": bson.M{"$nin": bson.A{"", nil}}},
+			bson.M{"pic_thumbs": bson.M{"$exists": true}},
+		}
+
+	case model.RetentionActionAnonymize:
+		filter["anonymized_at"] = bson.M{"$exists": false}
+	}
+
+	return filter
+}
+
+// retentionProjection 處理時需要讀取的欄位
+func retentionProjection(rule model.RetentionRule) bson.M {
+
+	projection := bson.M{rule.Date_field: 1}
+
+	if rule.Action == model.RetentionActionPurgePhoto {
+		projection["pic_ref"] = 1
+		projection["pic_thumbs"] = 1
+	}
+
+	for _, field := range rule.Fields {
+		projection[field] = 1
+	}
+
+	for _, field := range rule.Clear_fields {
+		projection[field] = 1
+	}
+
+	return projection
+}
+
+// checkNotAnonymized 期間內有已匿名化的打卡紀錄時回傳 errAnonymizedRange
+// 依員工名冊、班別即時計算的統計(部門統計、月報表、出勤趨勢、每日統計重新結算)不能用匿名代號計算
+func checkNotAnonymized(from time.Time, to time.Time) error {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
+	if err != nil {
+		return err
+	}
+
+	filter := businessDateRangeFilter(from, to)
+	filter["anonymized_at"] = bson.M{"$exists": true}
+
+	count, err := collection.CountDocuments(context.Background(), filter, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return errAnonymizedRange
+	}
+
+	return nil
+}
+
+// aggregateErrorStatus 統計失敗時的狀態碼(期間內的紀錄已匿名化為 409)
+func aggregateErrorStatus(err error) int {
+
+	if err == errAnonymizedRange {
+		return 409
+	}
+
+	return 500
+}
+
+// pseudonym 匿名代號: 同一次清理中,同一天的同一個值代號相同(保留當天人數等彙總),不同天無法對應
+func pseudonym(key []byte, value string, date string) string {
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value + "|" + date))
+
+	return "匿名-" + hex.EncodeToString(mac.Sum(nil))[:8]
+}
+
+// purgeDocumentPhoto 刪除一筆資料的照片: 先刪照片儲存區的檔案,再清除資料上的照片與參照,回傳刪除的檔案數
+func purgeDocumentPhoto(collection *mongo.Collection, rule model.RetentionRule, document bson.M) (int, error) {
+
+	var refs []string
+
+	if ref, ok := document["pic_ref"].(string); ok && ref != "" {
+		refs = append(refs, ref)
+	}
+
+	if thumbs, ok := document["pic_thumbs"].(bson.M); ok {
+		for _, value := range thumbs {
+			if thumbnail, ok := value.(bson.M); ok {
+				if ref, ok := thumbnail["ref"].(string); ok && ref != "" {
+					refs = append(refs, ref)
+				}
+			}
+		}
+	}
+
+	deleted := 0
+
+	for _, ref := range refs {
+
+		name, key, err := photo.ParseReference(ref)
+		if err != nil {
+			continue
+		}
+
+		store, err := openPhotoStore(name)
+		if err != nil {
+			return deleted, err
+		}
+
+		if err := store.Delete(key); err != nil && err != photo.ErrNotFound {
+			return deleted, err
+		}
+
+		deleted++
+	}
+
+	_, err := collection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": document["_id"]},
+		bson.M{
+			"$set":         bson.M{rule.Photo_field: ""},
+			"$unset":       bson.M{"pic_ref": "", "pic_type": "", "pic_thumbs": ""},
+			"$currentDate": bson.M{updatedAtField: true},
+		},
+	)
+
+	return deleted, err
+}
+
+// anonymizeDocument 個人資料匿名化
+func anonymizeDocument(collection *mongo.Collection, rule model.RetentionRule, document bson.M, key []byte, now string) error {
+
+	date := fmt.Sprint(document[rule.Date_field])
+	if parsed, err := model.ParseDate(date); err == nil {
+		date = parsed.Format(model.DateLayout)
+	} else if parsed, err := model.ParseCheckInTime(date); err == nil {
+		date = parsed.Format(model.DateLayout)
+	}
+
+	set := bson.M{"anonymized_at": now}
+
+	for _, field := range rule.Fields {
+		if value, ok := document[field].(string); ok && value != "" {
+			set[field] = pseudonym(key, value, date)
+		}
+	}
+
+	// 字串欄位清為空字串,其他(ex: 異動前後的資料)清為 null
+	for _, field := range rule.Clear_fields {
+		if _, ok := document[field].(string); ok {
+			set[field] = ""
+		} else {
+			set[field] = nil
+		}
+	}
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"_id": document["_id"]}, bson.M{"$set": set, "$currentDate": bson.M{updatedAtField: true}})
+
+	return err
+}
+
+// applyRetentionRule 執行一條規則(試算時只計算筆數),實際清理後寫入摘要異動紀錄
+func applyRetentionRule(rule model.RetentionRule, today time.Time, dryRun bool, key []byte, actor string) model.RetentionResult {
+
+	cutoff := rule.Cutoff(today)
+	result := model.RetentionResult{Rule: rule.Name, Cutoff: cutoff.Format(model.DateLayout)}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, rule.Collection)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	filter := retentionFilter(rule, cutoff)
+
+	if dryRun {
+		count, err := collection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			result.Error = err.Error()
+		}
+		result.Matched = int(count)
+		return result
+	}
+
+	processRetentionRule(collection, rule, filter, key, &result)
+
+	// 中途失敗時已處理的資料也要記錄
+	if result.Affected > 0 {
+		summary := bson.M{"cutoff": result.Cutoff, "affected": result.Affected, "photos_deleted": result.Photos_deleted, "failed": result.Failed}
+		if err := writeAuditLog(rule.Collection, rule.Name, model.AuditActionBatchUpdate, actor, rule.Description, nil, summary); err != nil && result.Error == "" {
+			result.Error = "異動紀錄寫入失敗: " + err.Error()
+		}
+	}
+
+	return result
+}
+
+// processRetentionRule 依 _id 分批處理符合規則的資料,結果寫入 result
+func processRetentionRule(collection *mongo.Collection, rule model.RetentionRule, filter bson.M, key []byte, result *model.RetentionResult) {
+
+	now := time.Now().Format(model.DateTimeLayout)
+	lastID := primitive.NilObjectID
+
+	for {
+
+		// 依 _id 分批,失敗的資料不會被重複讀取
+		batchFilter := bson.M{"_id": bson.M{"$gt": lastID}}
+		for k, v := range filter {
+			batchFilter[k] = v
+		}
+
+		cur, err := collection.Find(
+			context.Background(),
+			batchFilter,
+			options.Find().SetSort(bson.M{"_id": 1}).SetLimit(settings.RetentionBatchSize).SetProjection(retentionProjection(rule)),
+		)
+		if err != nil {
+			result.Error = err.Error()
+			return
+		}
+
+		var documents []bson.M
+		if err := cur.All(context.Background(), &documents); err != nil {
+			result.Error = err.Error()
+			return
+		}
+
+		if len(documents) == 0 {
+			return
+		}
+
+		for _, document := range documents {
+
+			if objID, ok := document["_id"].(primitive.ObjectID); ok {
+				lastID = objID
+			}
+
+			result.Matched++
+
+			var err error
+			if rule.Action == model.RetentionActionPurgePhoto {
+				var deleted int
+				deleted, err = purgeDocumentPhoto(collection, rule, document)
+				result.Photos_deleted += deleted
+			} else {
+				err = anonymizeDocument(collection, rule, document, key, now)
+			}
+
+			if err != nil {
+				fmt.Println("保存期限清理失敗 規則=", rule.Name, "id=", lastID.Hex(), err)
+				result.Failed++
+				continue
+			}
+
+			result.Affected++
+		}
+	}
+}
+
+// runRetention 依保存規則清理資料,並寫入執行報告
+func runRetention(trigger string, dryRun bool) (model.RetentionRun, error) {
+
+	select {
+	case retentionRunning <- struct{}{}:
+		defer func() { <-retentionRunning }()
+	default:
+		return model.RetentionRun{}, errRetentionRunning
+	}
+
+	run := model.RetentionRun{
+		ID:         primitive.NewObjectID(),
+		Trigger:    trigger,
+		Dry_run:    dryRun,
+		Started_at: time.Now().Format(model.DateTimeLayout),
+		Results:    []model.RetentionResult{},
+	}
+
+	// 每次清理使用新的匿名代號金鑰,不同次清理的代號無法對應
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return run, err
+	}
+
+	// 排程與指令執行的異動以系統名義記錄
+	actor := trigger
+	if trigger == retentionTriggerSchedule || trigger == retentionTriggerCommand {
+		actor = model.AuditActorSystem
+	}
+
+	today := time.Now()
+	for _, rule := range retentionRules() {
+
+		result := applyRetentionRule(rule, today, dryRun, key, actor)
+		run.Results = append(run.Results, result)
+
+		fmt.Println("保存期限清理 規則=", result.Rule, "期限=", result.Cutoff, "符合=", result.Matched, "已處理=", result.Affected, "刪除照片檔=", result.Photos_deleted, "失敗=", result.Failed, result.Error)
+	}
+
+	run.Finished_at = time.Now().Format(model.DateTimeLayout)
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfRetentionRun)
+	if err != nil {
+		return run, err
+	}
+
+	_, err = collection.InsertOne(context.Background(), run)
+
+	return run, err
+}
+
+// RunRetention 依保存規則清理資料(main 的 retention 指令使用)
+func RunRetention(dryRun bool) (model.RetentionRun, error) {
+	return runRetention(retentionTriggerCommand, dryRun)
+}
+
+// nextRetentionRun 下次排程清理時間
+func nextRetentionRun(now time.Time, minutes int) time.Time {
+
+	next := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Add(time.Duration(minutes) * time.Minute)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+
+	return next
+}
+
+// startRetentionJob 每天在 settings.RetentionRunTime 依保存規則清理資料
+func startRetentionJob() {
+
+	minutes, err := model.ParseClock(settings.RetentionRunTime)
+	if err != nil {
+		fmt.Println("保存期限清理時間格式錯誤(應為HH:MM):", settings.RetentionRunTime)
+		return
+	}
+
+	go func() {
+		for {
+
+			time.Sleep(time.Until(nextRetentionRun(time.Now(), minutes)))
+
+			if _, err := runRetention(retentionTriggerSchedule, settings.RetentionScheduleDryRun); err != nil {
+				fmt.Println("保存期限清理失敗:", err)
+			}
+		}
+	}()
+}
+
+// 取得目前的資料保存規則(含今天的保存期限)與排程設定
+func getRetentionPolicy(c *fiber.Ctx) {
+
+	type ruleWithCutoff struct {
+		model.RetentionRule
+		Cutoff string `json:"cutoff"` // 今天執行時,處理早於此日的資料
+	}
+
+	rules := []ruleWithCutoff{}
+	for _, rule := range retentionRules() {
+		rules = append(rules, ruleWithCutoff{RetentionRule: rule, Cutoff: rule.Cutoff(time.Now()).Format(model.DateLayout)})
+	}
+
+	sendJSON(c, fiber.Map{
+		"run_time": settings.RetentionRunTime,
+		"dry_run":  settings.RetentionScheduleDryRun,
+		"rules":    rules,
+	})
+}
+
+// 取得最近一次清理的報告(?dry_run=true|false 只看試算或實際清理)
+func getLastRetentionRun(c *fiber.Ctx) {
+
+	filter := bson.M{}
+
+	switch c.Query("dry_run") {
+	case "":
+	case "true":
+		filter["dry_run"] = true
+	case "false":
+		filter["dry_run"] = false
+	default:
+		sendError(c, 400, "dry_run 必須為 true 或 false")
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfRetentionRun)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var run model.RetentionRun
+	err = collection.FindOne(context.Background(), filter, options.FindOne().SetSort(bson.D{{Key: "started_at", Value: -1}, {Key: "_id", Value: -1}})).Decode(&run)
+	if err == mongo.ErrNoDocuments {
+		sendError(c, 404, "尚未執行過保存期限清理")
+		return
+	}
+
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	sendJSON(c, run)
+}
+
+// 立即執行保存期限清理(header X-Actor: 執行人員,?dry_run=true 只試算)
+func runRetentionNow(c *fiber.Ctx) {
+
+	actor, _, ok := auditContext(c, false)
+	if !ok {
+		return
+	}
+
+	run, err := runRetention(actor, c.Query("dry_run") == "true")
+	if err == errRetentionRunning {
+		sendError(c, 409, err.Error())
+		return
+	}
+
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	sendJSON(c, run)
+}
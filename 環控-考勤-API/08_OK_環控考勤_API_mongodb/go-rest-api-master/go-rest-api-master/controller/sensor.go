@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Sensor(環控感測器) 相關 functions */
+
+// findSensors 查詢感測器
+func findSensors(filter bson.M) ([]model.Sensor, error) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvSensor)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := collection.Find(context.Background(), filter, options.Find().SetSort(bson.M{"sensor_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	results := []model.Sensor{}
+	err = cur.All(context.Background(), &results)
+
+	return results, err
+}
+
+// 查詢感測器(/env/sensors/:id? ,?location=A,B&metric=co2,pm25)
+func getSensors(c *fiber.Ctx) {
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	filter := bson.M{}
+
+	// 若有給id
+	if c.Params("id") != "" {
+		filter["sensor_id"] = c.Params("id")
+	}
+
+	if locations := splitQueryList(c.Query("location")); len(locations) > 0 {
+		filter["location"] = bson.M{"$in": locations}
+	}
+
+	if metrics := splitQueryList(c.Query("metric")); len(metrics) > 0 {
+		filter["metric"] = bson.M{"$in": metrics}
+	}
+
+	results, err := findSensors(filter)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 若查無指定的感測器
+	if c.Params("id") != "" && len(results) == 0 {
+		c.SendStatus(404)
+		return
+	}
+
+	sendList(c, view, results)
+}
+
+// 新增或更新感測器(依 sensor_id)
+func upsertSensor(c *fiber.Ctx) {
+
+	var sensor model.Sensor
+	if err := json.Unmarshal([]byte(c.Body()), &sensor); err != nil {
+		sendError(c, 400, "無法解析感測器資料: "+err.Error())
+		return
+	}
+
+	if err := sensor.Validate(); err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvSensor)
+
+	// 若連線有誤
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	_, err = collection.ReplaceOne(context.Background(), bson.M{"sensor_id": sensor.Sensor_id}, sensor, options.Replace().SetUpsert(true))
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 停用的感測器未結束的警報一併結束
+	if !sensor.Active {
+		if err := resolveEnvAlerts(bson.M{"sensor_id": sensor.Sensor_id}, "感測器已停用", time.Now()); err != nil {
+			sendError(c, 500, err.Error())
+			return
+		}
+	}
+
+	sendJSON(c, sensor)
+}
+
+// 刪除感測器(已寫入的環控紀錄保留,未結束的警報一併結束)
+func deleteSensor(c *fiber.Ctx) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.EnvDbName, settings.CollectionNameOfEnvSensor)
+
+	// 若連線有誤
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	err = collection.FindOneAndDelete(context.Background(), bson.M{"sensor_id": c.Params("id")}).Err()
+	if err == mongo.ErrNoDocuments {
+		c.SendStatus(404)
+		return
+	}
+
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if err := resolveEnvAlerts(bson.M{"sensor_id": c.Params("id")}, "感測器已刪除", time.Now()); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	c.SendStatus(204)
+}
@@ -0,0 +1,461 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Shift(班別、排班、跨夜班彙整) 相關 functions */
+
+// shiftTable 班別與排班對照表(彙整時一次載入,避免每筆打卡都查資料庫)
+type shiftTable struct {
+	shifts      map[string]model.Shift           // key: 班別代碼
+	assignments map[string]model.ShiftAssignment // key: 員工姓名
+}
+
+// defaultShift 未排班員工使用的預設班別
+func defaultShift() model.Shift {
+	return model.Shift{
+		Code:       "default",
+		Name:       "預設班別",
+		Start_time: settings.DefaultShiftStartTime,
+		End_time:   settings.DefaultShiftEndTime,
+	}
+}
+
+// loadShiftTable 載入所有班別與排班
+func loadShiftTable() (shiftTable, error) {
+
+	table := shiftTable{
+		shifts:      map[string]model.Shift{},
+		assignments: map[string]model.ShiftAssignment{},
+	}
+
+	shiftCollection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfShift)
+	if err != nil {
+		return table, err
+	}
+
+	var shifts []model.Shift
+	cur, err := shiftCollection.Find(context.Background(), bson.M{})
+	if err != nil {
+		return table, err
+	}
+
+	if err = cur.All(context.Background(), &shifts); err != nil {
+		return table, err
+	}
+
+	for _, shift := range shifts {
+		table.shifts[shift.Code] = shift
+	}
+
+	assignmentCollection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfShiftAssignment)
+	if err != nil {
+		return table, err
+	}
+
+	var assignments []model.ShiftAssignment
+	cur, err = assignmentCollection.Find(context.Background(), bson.M{})
+	if err != nil {
+		return table, err
+	}
+
+	if err = cur.All(context.Background(), &assignments); err != nil {
+		return table, err
+	}
+
+	for _, assignment := range assignments {
+		table.assignments[assignment.Name] = assignment
+	}
+
+	return table, nil
+}
+
+// shiftTableCache 班別與排班的快取(每個請求都要判斷營業日是否已結算,不能每次都查資料庫)
+type shiftTableCache struct {
+	sync.Mutex
+	table    shiftTable
+	loadedAt time.Time
+}
+
+// shiftTables :全域的班別與排班快取
+var shiftTables = &shiftTableCache{}
+
+// invalidate 班別或排班異動後清除快取
+func (cache *shiftTableCache) invalidate() {
+	cache.Lock()
+	cache.loadedAt = time.Time{}
+	cache.Unlock()
+}
+
+// loadCachedShiftTable 載入班別與排班,settings.ShiftTableCacheSeconds 秒內重複使用
+func loadCachedShiftTable() (shiftTable, error) {
+
+	shiftTables.Lock()
+	defer shiftTables.Unlock()
+
+	if !shiftTables.loadedAt.IsZero() && time.Since(shiftTables.loadedAt) < time.Duration(settings.ShiftTableCacheSeconds)*time.Second {
+		return shiftTables.table, nil
+	}
+
+	table, err := loadShiftTable()
+	if err != nil {
+		return table, err
+	}
+
+	shiftTables.table = table
+	shiftTables.loadedAt = time.Now()
+
+	return table, nil
+}
+
+// lookup 取得員工的班別與排班(未排班或班別不存在時回傳預設班別)
+func (table shiftTable) lookup(name string) (model.Shift, *model.ShiftAssignment) {
+
+	assignment, ok := table.assignments[name]
+	if !ok {
+		return defaultShift(), nil
+	}
+
+	shift, ok := table.shifts[assignment.Shift_code]
+	if !ok {
+		return defaultShift(), &assignment
+	}
+
+	return shift, &assignment
+}
+
+// shiftNotStarted 該營業日的班別是否尚未開始(上班時間加遲到寬限尚未到),此時未打卡不算缺勤
+func shiftNotStarted(shift model.Shift, date time.Time, now time.Time) bool {
+	return now.Before(shift.StartAt(date).Add(time.Duration(settings.LateGraceMinutes) * time.Minute))
+}
+
+// businessDateFilter 依營業日查詢打卡紀錄的 filter
+// 已彙整的資料以 business_date 為準,尚未彙整的資料以 date 為準
+func businessDateFilter(myDate string) bson.M {
+
+	date, err := model.ParseDate(myDate)
+
+	// 無法解析的日期維持原本的查詢方式
+	if err != nil {
+		return bson.M{"date": myDate}
+	}
+
+	return bson.M{"$or": bson.A{
+		bson.M{"business_date": date.Format(model.DateLayout)},
+		bson.M{"business_date": bson.M{"$in": bson.A{nil, ""}}, "date": bson.M{"$in": model.DateVariants(date)}},
+	}}
+}
+
+// 取得班別資料
+func getShift(c *fiber.Ctx) {
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfShift)
+
+	// 若連線有誤
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var results []model.Shift
+	cur, err := collection.Find(context.Background(), bson.M{}, view.findOptions())
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if err = cur.All(context.Background(), &results); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 若查無資料
+	if results == nil {
+		c.SendStatus(404)
+		return
+	}
+
+	sendList(c, view, results)
+}
+
+// 新增或更新班別(以班別代碼為key)
+func upsertShift(c *fiber.Ctx) {
+
+	var shift model.Shift
+	if err := json.Unmarshal([]byte(c.Body()), &shift); err != nil {
+		sendError(c, 400, "無法解析班別資料: "+err.Error())
+		return
+	}
+
+	if err := shift.Validate(); err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfShift)
+
+	// 若連線有誤
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	_, err = collection.ReplaceOne(context.Background(), bson.M{"code": shift.Code}, shift, options.Replace().SetUpsert(true))
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	shiftTables.invalidate()
+
+	sendJSON(c, shift)
+}
+
+// 取得員工排班資料(可指定員工姓名)
+func getShiftAssignment(c *fiber.Ctx) {
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfShiftAssignment)
+
+	// 若連線有誤
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var filter bson.M = bson.M{}
+
+	// 若有給name
+	if c.Params("name") != "" {
+		filter = bson.M{"name": c.Params("name")}
+	}
+
+	var results []model.ShiftAssignment
+	cur, err := collection.Find(context.Background(), filter, view.findOptions())
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if err = cur.All(context.Background(), &results); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 若查無資料
+	if results == nil {
+		c.SendStatus(404)
+		return
+	}
+
+	sendList(c, view, results)
+}
+
+// 新增或更新員工排班(以員工姓名為key)
+func upsertShiftAssignment(c *fiber.Ctx) {
+
+	var assignment model.ShiftAssignment
+	if err := json.Unmarshal([]byte(c.Body()), &assignment); err != nil {
+		sendError(c, 400, "無法解析排班資料: "+err.Error())
+		return
+	}
+
+	if err := assignment.Validate(); err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfShiftAssignment)
+
+	// 若連線有誤
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	_, err = collection.ReplaceOne(context.Background(), bson.M{"name": assignment.Name}, assignment, options.Replace().SetUpsert(true))
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	shiftTables.invalidate()
+
+	sendJSON(c, assignment)
+}
+
+// 彙整指定日期的打卡紀錄:依員工班別計算每筆打卡的營業日並寫入 business_date
+func consolidateCheckInRecord(c *fiber.Ctx) {
+
+	date, err := model.ParseDate(c.Params("date"))
+	if err != nil {
+		sendError(c, 400, "日期格式錯誤(應為YYYY-MM-DD)")
+		return
+	}
+
+	consolidated, moved, err := consolidateCheckInRecordOfDate(date.Format(model.DateLayout))
+	if err != nil {
+		sendError(c, aggregateErrorStatus(err), err.Error())
+		return
+	}
+
+	// 彙整後重新掃描出勤異常(跨夜班的打卡會歸屬前一天,兩天都要掃描)
+	exceptions := 0
+	for _, businessDate := range []time.Time{date.AddDate(0, 0, -1), date} {
+
+		open, err := scanExceptionsOfDate(businessDate)
+		if err != nil {
+			sendError(c, aggregateErrorStatus(err), err.Error())
+			return
+		}
+
+		exceptions += open
+	}
+
+	sendJSON(c, fiber.Map{
+		"date":         date.Format(model.DateLayout),
+		"consolidated": consolidated, // 彙整筆數
+		"moved":        moved,        // 歸屬到前一天(跨夜班)的筆數
+		"exceptions":   exceptions,   // 待處理的出勤異常筆數
+	})
+}
+
+// consolidateBusinessDate 彙整營業日可能包含的打卡紀錄(當天,以及跨夜班落在隔天凌晨的下班打卡)
+// 統計、出勤異常掃描前都要先彙整,跨夜班才不會被拆成兩天
+func consolidateBusinessDate(date time.Time) error {
+
+	for _, day := range []time.Time{date, date.AddDate(0, 0, 1)} {
+		if _, _, err := consolidateCheckInRecordOfDate(day.Format(model.DateLayout)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// consolidateCheckInRecordOfDate 彙整指定日期(日曆日)的打卡紀錄,回傳營業日有變動的筆數與其中歸屬前一天的筆數
+// 補登的打卡紀錄營業日由申請指定,不重新計算;營業日沒有變動的紀錄不寫入,可重複執行
+func consolidateCheckInRecordOfDate(myDate string) (int, int, error) {
+
+	date, err := model.ParseDate(myDate)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// 已匿名化的姓名對不到班別,營業日維持匿名化前的結果
+	if err := checkNotAnonymized(date, date); err != nil {
+		return 0, 0, err
+	}
+
+	table, err := loadShiftTable()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInRecord)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	cur, err := collection.Find(
+		context.Background(),
+		bson.M{"date": bson.M{"$in": model.DateVariants(date)}, "correction_id": bson.M{"$in": bson.A{nil, ""}}},
+		options.Find().SetProjection(bson.M{"pic": 0}),
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cur.Close(context.Background())
+
+	models := []mongo.WriteModel{}
+	changes := bson.M{}
+	moved := 0
+
+	for cur.Next(context.Background()) {
+
+		var record struct {
+			ID                  primitive.ObjectID `bson:"_id"`
+			model.CheckInRecord `bson:",inline"`
+		}
+
+		if err := cur.Decode(&record); err != nil {
+			return 0, 0, err
+		}
+
+		businessDate := date
+
+		// 請假等沒有打卡時間的紀錄,營業日即為當天
+		if punch, err := model.ParseCheckInTime(record.Check_in_time); err == nil {
+			shift, assignment := table.lookup(record.Name)
+			businessDate = model.BusinessDate(punch, shift, assignment)
+		}
+
+		if record.Business_date == businessDate.Format(model.DateLayout) {
+			continue
+		}
+
+		if !businessDate.Equal(date) {
+			moved++
+		}
+
+		changes[record.ID.Hex()] = businessDate.Format(model.DateLayout)
+
+		update := bson.M{"$set": bson.M{"business_date": businessDate.Format(model.DateLayout)}, "$currentDate": bson.M{updatedAtField: true}}
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": record.ID}).SetUpdate(update))
+	}
+
+	if err := cur.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	if len(models) == 0 {
+		return 0, 0, nil
+	}
+
+	// 先寫入異動紀錄(只記錄各筆紀錄新的營業日),寫不進去就不彙整
+	summary := bson.M{"date": myDate, "count": len(models), "moved": moved, "business_date": changes}
+	if err := writeAuditLog(model.AuditEntityCheckInRecord, myDate, model.AuditActionBatchUpdate, model.AuditActorSystem, "跨夜班營業日彙整", nil, summary); err != nil {
+		return 0, 0, err
+	}
+
+	if _, err := collection.BulkWrite(context.Background(), models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return 0, 0, err
+	}
+
+	fmt.Println("彙整日期=", myDate, "筆數=", len(models), "跨夜歸屬前一天=", moved)
+
+	return len(models), moved, nil
+}
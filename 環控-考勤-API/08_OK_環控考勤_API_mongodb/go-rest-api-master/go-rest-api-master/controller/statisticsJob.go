@@ -0,0 +1,323 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為每日打卡統計(check_in_statistics) 產生相關 functions */
+
+// statisticsDateFilter 查詢指定日期統計的 filter(舊資料的日期可能沒有補零)
+func statisticsDateFilter(myDate string) bson.M {
+
+	date, err := model.ParseDate(myDate)
+	if err != nil {
+		return bson.M{"date": myDate}
+	}
+
+	return bson.M{"date": bson.M{"$in": model.DateVariants(date)}}
+}
+
+// computeCheckInStatistics 計算指定營業日的打卡統計
+// 應到: 當天為工作日的員工;實到: 有打卡;未到: 應到但沒有打卡也沒有請假
+func computeCheckInStatistics(date time.Time) (model.CheckInStatistics, error) {
+
+	statistics := model.CheckInStatistics{Date: date.Format(model.DateLayout)}
+
+	groups, err := groupStatisticsBetween(date, date, groupByDepartment, "")
+	if err != nil {
+		return statistics, err
+	}
+
+	var expected, attended, absent int
+	for _, group := range groups {
+		expected += group.Expected
+		attended += group.Attended
+		absent += group.Absent
+	}
+
+	guests, err := countGuests(statistics.Date)
+	if err != nil {
+		return statistics, err
+	}
+
+	// 沿用既有資料格式,數字以字串儲存
+	statistics.Expected = strconv.Itoa(expected)
+	statistics.Attendance = strconv.Itoa(attended)
+	statistics.Not_arrived = strconv.Itoa(absent)
+	statistics.Guests = strconv.Itoa(guests)
+
+	return statistics, nil
+}
+
+// materializeCheckInStatistics 彙整並計算、寫入指定營業日的打卡統計(已存在則更新,可重複執行)
+func materializeCheckInStatistics(date time.Time) (model.CheckInStatistics, error) {
+
+	// 已匿名化的日期保留匿名化前結算的統計,不重新計算
+	if err := checkNotAnonymized(date, date); err != nil {
+		return model.CheckInStatistics{Date: date.Format(model.DateLayout)}, err
+	}
+
+	// 先彙整,跨夜班隔天凌晨的下班打卡才會算在這一天
+	if err := consolidateBusinessDate(date); err != nil {
+		return model.CheckInStatistics{Date: date.Format(model.DateLayout)}, err
+	}
+
+	statistics, err := computeCheckInStatistics(date)
+	if err != nil {
+		return statistics, err
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInStatistics)
+	if err != nil {
+		return statistics, err
+	}
+
+	// 舊資料的日期可能沒有補零(ex: 2020-1-1),更新時保留原本的日期
+	filter := statisticsDateFilter(statistics.Date)
+	update := bson.M{
+		"$set": bson.M{
+			"expected":    statistics.Expected,
+			"attendance":  statistics.Attendance,
+			"not_arrived": statistics.Not_arrived,
+			"guests":      statistics.Guests,
+		},
+		"$currentDate": bson.M{updatedAtField: true},
+		"$setOnInsert": bson.M{"date": statistics.Date},
+	}
+
+	var before bson.M
+	err = collection.FindOneAndUpdate(context.Background(), filter, update, options.FindOneAndUpdate().SetUpsert(true)).Decode(&before)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return statistics, err
+	}
+
+	// 數字有變動才寫入異動紀錄
+	var after bson.M
+	err = collection.FindOne(context.Background(), filter).Decode(&after)
+	if err != nil {
+		return statistics, err
+	}
+
+	action := model.AuditActionUpdate
+	if before == nil {
+		action = model.AuditActionCreate
+	} else if fmt.Sprint(before["expected"], before["attendance"], before["not_arrived"], before["guests"]) ==
+		fmt.Sprint(after["expected"], after["attendance"], after["not_arrived"], after["guests"]) {
+		return statistics, nil
+	}
+
+	entityID := ""
+	if objID, ok := after["_id"].(primitive.ObjectID); ok {
+		entityID = objID.Hex()
+	}
+
+	return statistics, writeAuditLog(model.AuditEntityCheckInStatistics, entityID, action, model.AuditActorSystem, "每日統計結算", before, after)
+}
+
+// BackfillCheckInStatistics 重新計算期間內每一天的打卡統計(匯入或更正資料後使用)
+func BackfillCheckInStatistics(from time.Time, to time.Time) error {
+
+	for _, date := range datesBetween(from, to) {
+
+		statistics, err := materializeCheckInStatistics(date)
+		if err == errAnonymizedRange {
+			fmt.Println("統計", date.Format(model.DateLayout), "打卡紀錄已匿名化,保留原本的統計")
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s 統計失敗: %v", date.Format(model.DateLayout), err)
+		}
+
+		fmt.Println("統計", statistics.Date, "應到=", statistics.Expected, "實到=", statistics.Attendance, "未到=", statistics.Not_arrived, "訪客=", statistics.Guests)
+	}
+
+	return nil
+}
+
+// statisticsSettleAt 營業日可以結算的時間: 當天 settings.StatisticsCutoffTime,
+// 且所有班別(跨夜班為隔天早上)都已下班 settings.StatisticsSettleGraceMinutes 分鐘,取較晚者
+func statisticsSettleAt(date time.Time, table shiftTable) time.Time {
+
+	cutoffMinutes, _ := model.ParseClock(settings.StatisticsCutoffTime)
+	grace := time.Duration(settings.StatisticsSettleGraceMinutes) * time.Minute
+
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+	settleAt := day.Add(time.Duration(cutoffMinutes) * time.Minute)
+
+	shifts := []model.Shift{defaultShift()}
+	for _, shift := range table.shifts {
+		shifts = append(shifts, shift)
+	}
+
+	for _, shift := range shifts {
+		if end := shift.EndAt(day).Add(grace); end.After(settleAt) {
+			settleAt = end
+		}
+	}
+
+	return settleAt
+}
+
+// lastSettledDate 最後結算的營業日(沒有結算紀錄的舊資料以最後一筆統計的日期為準)
+func lastSettledDate() (time.Time, bool, error) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInStatistics)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	// 舊資料的日期可能沒有補零,無法以字串排序,逐筆解析
+	var results []bson.M
+	cur, err := collection.Find(context.Background(), bson.M{}, options.Find().SetProjection(bson.M{"date": 1, "settled_at": 1}))
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	if err = cur.All(context.Background(), &results); err != nil {
+		return time.Time{}, false, err
+	}
+
+	var lastSettled, lastMaterialized time.Time
+	for _, result := range results {
+
+		myDate, _ := result["date"].(string)
+		date, err := model.ParseDate(myDate)
+		if err != nil {
+			continue
+		}
+
+		if date.After(lastMaterialized) {
+			lastMaterialized = date
+		}
+
+		if _, ok := result["settled_at"]; ok && date.After(lastSettled) {
+			lastSettled = date
+		}
+	}
+
+	if !lastSettled.IsZero() {
+		return lastSettled, true, nil
+	}
+
+	return lastMaterialized, !lastMaterialized.IsZero(), nil
+}
+
+// markSettled 記錄營業日已結算(啟動時從最後結算的營業日往後補結算)
+func markSettled(date time.Time) error {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInStatistics)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.UpdateOne(context.Background(), statisticsDateFilter(date.Format(model.DateLayout)), bson.M{"$set": bson.M{"settled_at": time.Now().Format(model.DateTimeLayout)}, "$currentDate": bson.M{updatedAtField: true}})
+
+	return err
+}
+
+// settleBusinessDate 結算營業日: 彙整並產生打卡統計、發布未到名單、掃描出勤異常
+func settleBusinessDate(date time.Time) {
+
+	if err := BackfillCheckInStatistics(date, date); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	// 結算後通知其他系統當天的未到名單
+	if report, err := buildDailyReport(date); err != nil {
+		fmt.Println(date.Format(model.DateLayout), "未到名單產生失敗:", err)
+	} else {
+		notArrived := []fiber.Map{}
+		for _, entry := range report.Not_arrived {
+			notArrived = append(notArrived, fiber.Map{"name": entry.Name, "department": entry.Department, "position": entry.Position})
+		}
+
+		publishWebhookEvent(model.WebhookEventNotArrivedFinal, fiber.Map{
+			"date":        report.Date,
+			"not_arrived": notArrived,
+		})
+	}
+
+	// 結算時一併掃描出勤異常
+	if open, err := scanExceptionsOfDate(date); err != nil {
+		fmt.Println(date.Format(model.DateLayout), "出勤異常掃描失敗:", err)
+	} else {
+		fmt.Println(date.Format(model.DateLayout), "待處理出勤異常=", open)
+	}
+
+	if err := markSettled(date); err != nil {
+		fmt.Println(date.Format(model.DateLayout), "結算紀錄寫入失敗:", err)
+	}
+}
+
+// startCheckInStatisticsJob 每個營業日在可以結算時(見 statisticsSettleAt)產生打卡統計、發布未到名單並掃描出勤異常
+// 跨夜班的營業日要等隔天早上下班後才結算;啟動時從最後結算的營業日的隔天開始,已過結算時間的營業日依序補結算,避免服務停機而漏算
+func startCheckInStatisticsJob() {
+
+	if _, err := model.ParseClock(settings.StatisticsCutoffTime); err != nil {
+		fmt.Println("統計結算時間格式錯誤(應為HH:MM):", settings.StatisticsCutoffTime)
+		return
+	}
+
+	go func() {
+
+		now := time.Now()
+		yesterday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, -1)
+
+		// 沒有統計資料時從昨天開始;補結算最多 settings.StatisticsCatchUpMaxDays 天
+		date := yesterday
+		if last, ok, err := lastSettledDate(); err != nil {
+			fmt.Println("統計結算讀取最後結算日失敗:", err)
+		} else if ok {
+			date = last.AddDate(0, 0, 1)
+		}
+
+		if earliest := yesterday.AddDate(0, 0, 1-settings.StatisticsCatchUpMaxDays); date.Before(earliest) {
+			date = earliest
+		}
+
+		// 以下迴圈會依序結算已過結算時間的營業日,再等待下一個營業日
+		recheck := time.Duration(settings.StatisticsJobRecheckMinutes) * time.Minute
+
+		for {
+
+			// 班別可能在等待期間異動,每次醒來都重新計算結算時間
+			table, err := loadShiftTable()
+			if err != nil {
+				fmt.Println("統計結算載入班別失敗:", err)
+				time.Sleep(recheck)
+				continue
+			}
+
+			if wait := time.Until(statisticsSettleAt(date, table)); wait > 0 {
+
+				if wait > recheck {
+					wait = recheck
+				}
+
+				time.Sleep(wait)
+				continue
+			}
+
+			settleBusinessDate(date)
+			date = date.AddDate(0, 0, 1)
+		}
+	}()
+}
@@ -0,0 +1,276 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Visitor(訪客登記) 相關 functions */
+
+// countGuests 計算指定日期實際到訪的訪客人數
+func countGuests(myDate string) (int, error) {
+
+	date, err := model.ParseDate(myDate)
+	if err != nil {
+		return 0, err
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfVisitor)
+	if err != nil {
+		return 0, err
+	}
+
+	filter := bson.M{
+		"visit_date": date.Format(model.DateLayout),
+		"status":     bson.M{"$in": bson.A{model.VisitorStatusCheckedIn, model.VisitorStatusCheckedOut}},
+	}
+
+	count, err := collection.CountDocuments(context.Background(), filter)
+
+	return int(count), err
+}
+
+// loadVisitors 載入指定日期的訪客(依到訪時間排序)
+func loadVisitors(date time.Time) ([]model.Visitor, error) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfVisitor)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []model.Visitor
+	cur, err := collection.Find(context.Background(), bson.M{"visit_date": date.Format(model.DateLayout)}, options.Find().SetSort(bson.M{"arrival_time": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cur.All(context.Background(), &results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// refreshGuestsOfStatistics 訪客報到後更新已結算統計中的訪客人數(尚未結算的日期於結算時一併計算)
+func refreshGuestsOfStatistics(myDate string) error {
+
+	guests, err := countGuests(myDate)
+	if err != nil {
+		return err
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfCheckInStatistics)
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.UpdateOne(context.Background(), statisticsDateFilter(myDate), bson.M{"$set": bson.M{"guests": strconv.Itoa(guests)}, "$currentDate": bson.M{updatedAtField: true}})
+
+	return err
+}
+
+// 取得指定日期的訪客
+func getVisitor(c *fiber.Ctx) {
+
+	// 列表欄位(?fields= 只回傳指定欄位,預設不回傳照片,?include=photo 才回傳)
+	view, err := parseListView(c, "photo")
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfVisitor)
+
+	// 若連線有誤
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var filter bson.M = bson.M{}
+
+	// 若有給date
+	if c.Params("date") != "" {
+
+		date, err := model.ParseDate(c.Params("date"))
+		if err != nil {
+			sendError(c, 400, "日期格式錯誤(應為YYYY-MM-DD)")
+			return
+		}
+
+		filter = bson.M{"visit_date": date.Format(model.DateLayout)}
+		fmt.Println("filter=", filter)
+	}
+
+	var results []model.Visitor
+	cur, err := collection.Find(context.Background(), filter, view.findOptions().SetSort(bson.D{{Key: "visit_date", Value: 1}, {Key: "arrival_time", Value: 1}}))
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if err = cur.All(context.Background(), &results); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 若查無資料
+	if results == nil {
+		c.SendStatus(404)
+		return
+	}
+
+	sendList(c, view, results)
+}
+
+// 訪客預約登記
+func createVisitor(c *fiber.Ctx) {
+
+	var visitor model.Visitor
+	if err := json.Unmarshal([]byte(c.Body()), &visitor); err != nil {
+		sendError(c, 400, "無法解析訪客資料: "+err.Error())
+		return
+	}
+
+	if err := visitor.Validate(); err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	date, _ := model.ParseDate(visitor.Visit_date)
+	visitor.ID = primitive.NewObjectID()
+	visitor.Visit_date = date.Format(model.DateLayout)
+	visitor.Arrival_time = ""
+	visitor.Departure_time = ""
+	visitor.Status = model.VisitorStatusRegistered
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfVisitor)
+
+	// 若連線有誤
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if _, err = collection.InsertOne(context.Background(), visitor); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	c.Status(201)
+	sendJSON(c, visitor)
+}
+
+// 訪客到訪報到(可同時登記訪客證號碼與照片)
+func checkInVisitor(c *fiber.Ctx) {
+
+	var body struct {
+		Badge_number string `json:"badge_number"`
+		Photo        string `json:"photo"`
+	}
+
+	if len(c.Body()) > 0 {
+		if err := json.Unmarshal([]byte(c.Body()), &body); err != nil {
+			sendError(c, 400, "無法解析報到資料: "+err.Error())
+			return
+		}
+	}
+
+	set := bson.M{
+		"status":       model.VisitorStatusCheckedIn,
+		"arrival_time": time.Now().Format(model.DateTimeLayout),
+	}
+
+	if body.Badge_number != "" {
+		set["badge_number"] = body.Badge_number
+	}
+
+	if body.Photo != "" {
+		set["photo"] = body.Photo
+	}
+
+	updateVisitorStatus(c, model.VisitorStatusRegistered, set)
+}
+
+// 訪客離開
+func checkOutVisitor(c *fiber.Ctx) {
+
+	set := bson.M{
+		"status":         model.VisitorStatusCheckedOut,
+		"departure_time": time.Now().Format(model.DateTimeLayout),
+	}
+
+	updateVisitorStatus(c, model.VisitorStatusCheckedIn, set)
+}
+
+// updateVisitorStatus 更新訪客狀態(訪客目前必須是 fromStatus 才能更新)
+func updateVisitorStatus(c *fiber.Ctx, fromStatus string, set bson.M) {
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		sendError(c, 400, "訪客id格式錯誤")
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfVisitor)
+
+	// 若連線有誤
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	var visitor model.Visitor
+	err = collection.FindOneAndUpdate(
+		context.Background(),
+		bson.M{"_id": objID, "status": fromStatus},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&visitor)
+
+	if err == mongo.ErrNoDocuments {
+
+		// 區分查無訪客與狀態不符
+		count, _ := collection.CountDocuments(context.Background(), bson.M{"_id": objID})
+		if count == 0 {
+			c.SendStatus(404)
+			return
+		}
+
+		sendError(c, 409, "訪客目前狀態不是 "+fromStatus)
+		return
+	}
+
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	// 報到後訪客人數改變,更新已結算的統計
+	if visitor.Status == model.VisitorStatusCheckedIn {
+		if err := refreshGuestsOfStatistics(visitor.Visit_date); err != nil {
+			fmt.Println(visitor.Visit_date, "更新統計訪客人數失敗:", err)
+		}
+	}
+
+	sendJSON(c, visitor)
+}
@@ -0,0 +1,465 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"my-rest-api/db"
+	"my-rest-api/model"
+	"my-rest-api/settings"
+)
+
+/* 以下為 Webhook(事件通知) 相關 functions */
+
+// webhookWakeUp 有新的傳送紀錄時喚醒傳送程序,不必等到下次輪詢
+var webhookWakeUp = make(chan struct{}, 1)
+
+// webhookClient 傳送用的 HTTP client
+var webhookClient = &http.Client{Timeout: time.Duration(settings.WebhookTimeoutSeconds) * time.Second}
+
+// signWebhookPayload 以 HMAC-SHA256 簽章,接收端以相同金鑰計算後比對 X-Webhook-Signature
+func signWebhookPayload(secret string, payload []byte) string {
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postWebhook 傳送一次,回傳 HTTP 狀態碼(2xx 視為成功)
+func postWebhook(webhook model.Webhook, delivery model.WebhookDelivery) (int, error) {
+
+	payload := []byte(delivery.Payload)
+
+	request, err := http.NewRequest("POST", webhook.Url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Leapsy-Attendance-Webhook")
+	request.Header.Set("X-Webhook-Event", delivery.Event)
+	request.Header.Set("X-Webhook-Delivery", delivery.ID.Hex())
+	request.Header.Set("X-Webhook-Signature", signWebhookPayload(webhook.Secret, payload))
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	// 讀完回應內容才能重複使用連線
+	io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("接收端回應 %d", response.StatusCode)
+	}
+
+	return response.StatusCode, nil
+}
+
+// webhookRetryDelay 第 attempts 次失敗後的等待時間(指數退避: base、2×base、4×base...)
+func webhookRetryDelay(attempts int) time.Duration {
+	return time.Duration(settings.WebhookRetryBaseSeconds) * time.Second << uint(attempts-1)
+}
+
+// publishWebhookEvent 發布事件: 為每個訂閱的 webhook 建立傳送紀錄,由傳送程序送出與重試
+func publishWebhookEvent(event string, data interface{}) {
+
+	if err := enqueueWebhookEvent(event, data, bson.M{"active": true}); err != nil {
+		fmt.Println("webhook 事件發布失敗:", event, err)
+	}
+}
+
+// enqueueWebhookEvent 為符合 filter 且訂閱此事件的 webhook 建立傳送紀錄
+func enqueueWebhookEvent(event string, data interface{}, filter bson.M) error {
+
+	webhooks, err := findWebhooks(filter)
+	if err != nil {
+		return err
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfWebhookDelivery)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Format(model.DateTimeLayout)
+
+	for _, webhook := range webhooks {
+
+		if !webhook.Subscribes(event) {
+			continue
+		}
+
+		delivery := model.WebhookDelivery{
+			ID:              primitive.NewObjectID(),
+			Webhook_id:      webhook.ID.Hex(),
+			Event:           event,
+			Status:          model.DeliveryStatusPending,
+			Created_at:      now,
+			Next_attempt_at: now,
+		}
+
+		payload, err := json.Marshal(fiber.Map{
+			"id":         delivery.ID.Hex(),
+			"event":      event,
+			"created_at": now,
+			"data":       data,
+		})
+		if err != nil {
+			return err
+		}
+
+		delivery.Payload = string(payload)
+
+		if _, err := collection.InsertOne(context.Background(), delivery); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case webhookWakeUp <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// findWebhooks 查詢 webhook
+func findWebhooks(filter bson.M) ([]model.Webhook, error) {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfWebhook)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := collection.Find(context.Background(), filter, options.Find().SetSort(bson.M{"created_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks := []model.Webhook{}
+	err = cur.All(context.Background(), &webhooks)
+
+	return webhooks, err
+}
+
+// deliverPendingWebhooks 送出所有到期的傳送紀錄
+func deliverPendingWebhooks() error {
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfWebhookDelivery)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	cur, err := collection.Find(
+		context.Background(),
+		bson.M{"status": model.DeliveryStatusPending, "next_attempt_at": bson.M{"$lte": now.Format(model.DateTimeLayout)}},
+		options.Find().SetSort(bson.M{"next_attempt_at": 1}),
+	)
+	if err != nil {
+		return err
+	}
+
+	var deliveries []model.WebhookDelivery
+	if err := cur.All(context.Background(), &deliveries); err != nil {
+		return err
+	}
+
+	webhookOfID := map[string]*model.Webhook{}
+
+	for _, delivery := range deliveries {
+
+		webhook, ok := webhookOfID[delivery.Webhook_id]
+		if !ok {
+			webhook, err = findWebhookByID(delivery.Webhook_id)
+			if err != nil {
+				return err
+			}
+			webhookOfID[delivery.Webhook_id] = webhook
+		}
+
+		set := bson.M{"attempts": delivery.Attempts + 1}
+
+		if webhook == nil {
+
+			// webhook 已刪除
+			set["status"] = model.DeliveryStatusFailed
+			set["last_error"] = "webhook 已刪除"
+
+		} else {
+
+			status, err := postWebhook(*webhook, delivery)
+			set["response_status"] = status
+
+			switch {
+			case err == nil:
+				set["status"] = model.DeliveryStatusSucceeded
+				set["last_error"] = ""
+				set["delivered_at"] = time.Now().Format(model.DateTimeLayout)
+			case delivery.Attempts+1 >= settings.WebhookMaxAttempts:
+				set["status"] = model.DeliveryStatusFailed
+				set["last_error"] = err.Error()
+			default:
+				set["last_error"] = err.Error()
+				set["next_attempt_at"] = time.Now().Add(webhookRetryDelay(delivery.Attempts + 1)).Format(model.DateTimeLayout)
+			}
+		}
+
+		if _, err := collection.UpdateOne(context.Background(), bson.M{"_id": delivery.ID}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findWebhookByID 以id查詢 webhook,查無時回傳 nil
+func findWebhookByID(id string) (*model.Webhook, error) {
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfWebhook)
+	if err != nil {
+		return nil, err
+	}
+
+	var webhook model.Webhook
+	err = collection.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&webhook)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &webhook, nil
+}
+
+// startWebhookWorker 傳送程序: 定期(或有新事件時)送出到期的傳送紀錄
+// 傳送紀錄存在資料庫,服務重新啟動後會繼續重試
+func startWebhookWorker() {
+
+	go func() {
+
+		ticker := time.NewTicker(time.Duration(settings.WebhookPollSeconds) * time.Second)
+		defer ticker.Stop()
+
+		for {
+
+			if err := deliverPendingWebhooks(); err != nil {
+				fmt.Println("webhook 傳送失敗:", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-webhookWakeUp:
+			}
+		}
+	}()
+}
+
+// newWebhookSecret 產生簽章金鑰
+func newWebhookSecret() (string, error) {
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// 取得已登記的 webhook(不顯示金鑰)
+func getWebhooks(c *fiber.Ctx) {
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	webhooks, err := findWebhooks(bson.M{})
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	sendList(c, view, webhooks)
+}
+
+// 登記 webhook(body: {"url": "", "events": [], "secret": "", "description": ""})
+// 沒有給金鑰時自動產生,金鑰只在登記時回傳一次
+func registerWebhook(c *fiber.Ctx) {
+
+	var webhook model.Webhook
+	if err := json.Unmarshal([]byte(c.Body()), &webhook); err != nil {
+		sendError(c, 400, "無法解析 webhook 資料: "+err.Error())
+		return
+	}
+
+	if err := webhook.Validate(); err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	if webhook.Secret == "" {
+
+		secret, err := newWebhookSecret()
+		if err != nil {
+			sendError(c, 500, err.Error())
+			return
+		}
+
+		webhook.Secret = secret
+	}
+
+	webhook.ID = primitive.NewObjectID()
+	webhook.Active = true
+	webhook.Created_at = time.Now().Format(model.DateTimeLayout)
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfWebhook)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if _, err := collection.InsertOne(context.Background(), webhook); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	c.Status(201)
+	sendJSON(c, webhook)
+}
+
+// 刪除 webhook(尚未送出的傳送紀錄會標記為失敗)
+func deleteWebhook(c *fiber.Ctx) {
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		sendError(c, 400, "webhook id格式錯誤")
+		return
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfWebhook)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	result, err := collection.DeleteOne(context.Background(), bson.M{"_id": objID})
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if result.DeletedCount == 0 {
+		c.SendStatus(404)
+		return
+	}
+
+	c.SendStatus(204)
+}
+
+// 傳送測試事件給指定 webhook(可搭配本機 HTTP 接收端測試)
+func pingWebhook(c *fiber.Ctx) {
+
+	objID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		sendError(c, 400, "webhook id格式錯誤")
+		return
+	}
+
+	webhook, err := findWebhookByID(objID.Hex())
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	if webhook == nil {
+		c.SendStatus(404)
+		return
+	}
+
+	if err := enqueueWebhookEvent(model.WebhookEventPing, fiber.Map{"message": "pong"}, bson.M{"_id": objID}); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	c.Status(202)
+	sendJSON(c, fiber.Map{"webhook_id": objID.Hex(), "event": model.WebhookEventPing})
+}
+
+// 查詢傳送紀錄(?webhook_id=&event=&status=,依建立時間新到舊)
+func getWebhookDeliveries(c *fiber.Ctx) {
+
+	// 列表欄位(?fields= 只回傳指定欄位)
+	view, err := parseListView(c)
+	if err != nil {
+		sendError(c, 400, err.Error())
+		return
+	}
+
+	filter := bson.M{}
+	for _, key := range []string{"webhook_id", "event", "status"} {
+		if value := c.Query(key); value != "" {
+			filter[key] = value
+		}
+	}
+
+	// 取得 collection
+	collection, err := db.GetMongoDbCollection(settings.DbName, settings.CollectionNameOfWebhookDelivery)
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	cur, err := collection.Find(context.Background(), filter, view.findOptions().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(settings.WebhookDeliveryQueryLimit))
+	if err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	deliveries := []model.WebhookDelivery{}
+	if err := cur.All(context.Background(), &deliveries); err != nil {
+		sendError(c, 500, err.Error())
+		return
+	}
+
+	sendList(c, view, deliveries)
+}
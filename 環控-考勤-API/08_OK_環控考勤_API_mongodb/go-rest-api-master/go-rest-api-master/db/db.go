@@ -6,27 +6,48 @@ import (
 	"context"
 	"log"
 	"my-rest-api/settings"
+	"sync"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
+// sharedClient :整個程式共用的 mongodb client(內含連線池),第一次使用時建立
+var (
+	sharedClient *mongo.Client
+	clientLock   sync.Mutex
+)
+
 //GetMongoDbConnection 取得 mongodb連線
+// 共用同一個 client,不會每次請求都重新連線;連線失敗時回傳錯誤,下次呼叫再重試
 func GetMongoDbConnection() (*mongo.Client, error) {
 
+	clientLock.Lock()
+	defer clientLock.Unlock()
+
+	if sharedClient != nil {
+		return sharedClient, nil
+	}
+
 	//連線mongodb
 	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI("mongodb://localhost:"+settings.PortOfMongoDB))
 
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
+		return nil, err
 	}
 
 	err = client.Ping(context.Background(), readpref.Primary())
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
+		client.Disconnect(context.Background())
+		return nil, err
 	}
 
+	sharedClient = client
+
 	return client, nil
 }
 
@@ -42,3 +63,27 @@ func GetMongoDbCollection(DbName string, CollectionName string) (*mongo.Collecti
 
 	return collection, nil
 }
+
+// 取得 Database(ex: GridFS 照片儲存區)
+func GetMongoDbDatabase(DbName string) (*mongo.Database, error) {
+	client, err := GetMongoDbConnection()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Database(DbName), nil
+}
+
+// 建立索引(已存在時不會重建),查詢、排序需要索引的 collection 在啟動時呼叫
+func EnsureMongoDbIndex(DbName string, CollectionName string, keys bson.D) error {
+	collection, err := GetMongoDbCollection(DbName, CollectionName)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{Keys: keys})
+
+	return err
+}
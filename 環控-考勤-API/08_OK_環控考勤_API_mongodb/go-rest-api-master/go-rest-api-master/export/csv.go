@@ -0,0 +1,94 @@
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// utf8BOM :UTF-8 BOM,讓 Excel 以 UTF-8 開啟中文 CSV
+const utf8BOM = "\xEF\xBB\xBF"
+
+// CSVWriter CSV 輸出
+type CSVWriter struct {
+	writer        *csv.Writer
+	out           io.Writer
+	started       bool
+	headerWritten bool
+	headers       []string // 第一張表的表頭
+}
+
+// NewCSVWriter 建立 CSV 輸出
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{writer: csv.NewWriter(w), out: w}
+}
+
+// StartSheet CSV 只有一張表,只輸出第一次的表頭
+// 之後的表頭必須相同(各表的列接在一起輸出),不同時回傳錯誤,避免輸出無法解析的檔案
+func (w *CSVWriter) StartSheet(name string, headers []string) error {
+
+	if err := w.writeBOM(); err != nil {
+		return err
+	}
+
+	if w.headerWritten {
+
+		if strings.Join(headers, "\x00") != strings.Join(w.headers, "\x00") {
+			return errors.New("CSV 各表的表頭必須相同: " + name)
+		}
+
+		return nil
+	}
+
+	w.headerWritten = true
+	w.headers = headers
+
+	return w.writer.Write(headers)
+}
+
+// WriteRow 寫入一列
+func (w *CSVWriter) WriteRow(cells []Cell) error {
+
+	if err := w.writeBOM(); err != nil {
+		return err
+	}
+
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		record[i] = cell.csvText()
+	}
+
+	return w.writer.Write(record)
+}
+
+// Close 結束輸出
+func (w *CSVWriter) Close() error {
+
+	if err := w.writeBOM(); err != nil {
+		return err
+	}
+
+	w.writer.Flush()
+
+	return w.writer.Error()
+}
+
+// writeBOM 第一次輸出前寫入 BOM
+func (w *CSVWriter) writeBOM() error {
+
+	if w.started {
+		return nil
+	}
+
+	w.started = true
+	_, err := io.WriteString(w.out, utf8BOM)
+
+	return err
+}
+
+// formatNumber 數字轉文字(不使用科學記號)
+func formatNumber(number float64) string {
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
@@ -0,0 +1,119 @@
+// Package export 以串流方式輸出表格資料(xlsx、csv),資料量大時也不會整份放進記憶體
+package export
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// FormatXLSX :Excel 格式
+	FormatXLSX = "xlsx"
+
+	// FormatCSV :CSV 格式(UTF-8 BOM,繁體中文 Excel 可直接開啟)
+	FormatCSV = "csv"
+)
+
+// cellKind 儲存格型別
+type cellKind int
+
+const (
+	kindString cellKind = iota
+	kindNumber
+	kindDate
+	kindDateTime
+	kindTime
+	kindEmpty
+)
+
+// Cell 儲存格
+type Cell struct {
+	kind   cellKind
+	text   string
+	number float64
+	time   time.Time
+}
+
+// String 文字儲存格
+func String(text string) Cell {
+	return Cell{kind: kindString, text: text}
+}
+
+// Number 數字儲存格
+func Number(number float64) Cell {
+	return Cell{kind: kindNumber, number: number}
+}
+
+// Date 日期儲存格(Excel 中為日期型別)
+func Date(t time.Time) Cell {
+	return Cell{kind: kindDate, time: t}
+}
+
+// DateTime 日期時間儲存格(Excel 中為日期時間型別)
+func DateTime(t time.Time) Cell {
+	return Cell{kind: kindDateTime, time: t}
+}
+
+// Time 時間儲存格(Excel 中為時間型別)
+func Time(t time.Time) Cell {
+	return Cell{kind: kindTime, time: t}
+}
+
+// Empty 空白儲存格
+func Empty() Cell {
+	return Cell{kind: kindEmpty}
+}
+
+// csvText 儲存格在 CSV 中的文字
+func (cell Cell) csvText() string {
+
+	switch cell.kind {
+	case kindString:
+		return cell.text
+	case kindNumber:
+		return formatNumber(cell.number)
+	case kindDate:
+		return cell.time.Format("2006-01-02")
+	case kindDateTime:
+		return cell.time.Format("2006-01-02 15:04:05")
+	case kindTime:
+		return cell.time.Format("15:04:05")
+	}
+
+	return ""
+}
+
+// Writer 表格輸出
+// 依序呼叫 StartSheet、WriteRow,最後呼叫 Close
+type Writer interface {
+
+	// StartSheet 開始新的工作表(CSV 只輸出第一次的表頭,各表的表頭必須相同)
+	StartSheet(name string, headers []string) error
+
+	// WriteRow 寫入一列
+	WriteRow(cells []Cell) error
+
+	// Close 結束輸出
+	Close() error
+}
+
+// NewWriter 依格式建立表格輸出
+func NewWriter(format string, w io.Writer) Writer {
+
+	if strings.ToLower(format) == FormatCSV {
+		return NewCSVWriter(w)
+	}
+
+	return NewXLSXWriter(w)
+}
+
+// ContentType 取得格式對應的 Content-Type
+func ContentType(format string) string {
+
+	if strings.ToLower(format) == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
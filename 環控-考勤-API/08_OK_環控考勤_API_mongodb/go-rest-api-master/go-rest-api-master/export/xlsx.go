@@ -0,0 +1,328 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 儲存格樣式編號(對應 xlsxStyles 的 cellXfs 順序)
+const (
+	styleDefault  = 0
+	styleDate     = 1
+	styleDateTime = 2
+	styleTime     = 3
+	styleHeader   = 4
+)
+
+// excelEpoch :Excel 日期序號的起點(1900 日期系統)
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// XLSXWriter Excel(xlsx) 串流輸出
+// 每張工作表直接寫入 zip,字串以 inlineStr 儲存,不需要把整份資料留在記憶體
+type XLSXWriter struct {
+	zip        *zip.Writer
+	sheet      *bufio.Writer
+	sheetNames []string
+	rowIndex   int
+}
+
+// NewXLSXWriter 建立 Excel 輸出
+func NewXLSXWriter(w io.Writer) *XLSXWriter {
+	return &XLSXWriter{zip: zip.NewWriter(w)}
+}
+
+// StartSheet 開始新的工作表
+func (w *XLSXWriter) StartSheet(name string, headers []string) error {
+
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+
+	w.sheetNames = append(w.sheetNames, w.uniqueSheetName(name))
+
+	entry, err := w.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(w.sheetNames)))
+	if err != nil {
+		return err
+	}
+
+	w.sheet = bufio.NewWriter(entry)
+	w.rowIndex = 0
+
+	w.sheet.WriteString(xml.Header)
+	w.sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	w.sheet.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	w.sheet.WriteString(`<sheetData>`)
+
+	cells := make([]Cell, len(headers))
+	for i, header := range headers {
+		cells[i] = String(header)
+	}
+
+	return w.writeRow(cells, styleHeader)
+}
+
+// WriteRow 寫入一列
+func (w *XLSXWriter) WriteRow(cells []Cell) error {
+
+	if w.sheet == nil {
+		if err := w.StartSheet("Sheet1", nil); err != nil {
+			return err
+		}
+	}
+
+	return w.writeRow(cells, styleDefault)
+}
+
+// Close 結束輸出,寫入活頁簿結構
+func (w *XLSXWriter) Close() error {
+
+	if len(w.sheetNames) == 0 {
+		if err := w.StartSheet("Sheet1", nil); err != nil {
+			return err
+		}
+	}
+
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", w.contentTypes()},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", w.workbook()},
+		{"xl/_rels/workbook.xml.rels", w.workbookRels()},
+		{"xl/styles.xml", xlsxStyles},
+	}
+
+	for _, file := range files {
+
+		entry, err := w.zip.Create(file.name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(entry, file.content); err != nil {
+			return err
+		}
+	}
+
+	return w.zip.Close()
+}
+
+// writeRow 寫入一列(header 列使用粗體樣式)
+func (w *XLSXWriter) writeRow(cells []Cell, rowStyle int) error {
+
+	w.rowIndex++
+	fmt.Fprintf(w.sheet, `<row r="%d">`, w.rowIndex)
+
+	for i, cell := range cells {
+
+		ref := columnName(i) + strconv.Itoa(w.rowIndex)
+		style := rowStyle
+
+		switch cell.kind {
+		case kindEmpty:
+			continue
+		case kindNumber:
+			fmt.Fprintf(w.sheet, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, formatNumber(cell.number))
+			continue
+		case kindDate:
+			style = styleDate
+		case kindDateTime:
+			style = styleDateTime
+		case kindTime:
+			style = styleTime
+		}
+
+		if cell.kind == kindString {
+			fmt.Fprintf(w.sheet, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">`, ref, style)
+			xml.EscapeText(w.sheet, []byte(cell.text))
+			w.sheet.WriteString(`</t></is></c>`)
+			continue
+		}
+
+		fmt.Fprintf(w.sheet, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, formatNumber(excelSerial(cell.time, cell.kind)))
+	}
+
+	_, err := w.sheet.WriteString(`</row>`)
+
+	return err
+}
+
+// endSheet 結束目前的工作表
+func (w *XLSXWriter) endSheet() error {
+
+	if w.sheet == nil {
+		return nil
+	}
+
+	w.sheet.WriteString(`</sheetData></worksheet>`)
+	err := w.sheet.Flush()
+	w.sheet = nil
+
+	return err
+}
+
+// uniqueSheetName 工作表名稱(最多31字、不可含 []:*?/\ 、不可重複)
+func (w *XLSXWriter) uniqueSheetName(name string) string {
+
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+
+	if name == "" {
+		name = "Sheet"
+	}
+
+	base := truncateRunes(name, 31)
+	candidate := base
+
+	for i := 2; w.hasSheet(candidate); i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		candidate = truncateRunes(base, 31-len(suffix)) + suffix
+	}
+
+	return candidate
+}
+
+// hasSheet 工作表名稱是否已存在(Excel 不分大小寫)
+func (w *XLSXWriter) hasSheet(name string) bool {
+
+	for _, existing := range w.sheetNames {
+		if strings.EqualFold(existing, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contentTypes [Content_Types].xml
+func (w *XLSXWriter) contentTypes() string {
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+
+	for i := range w.sheetNames {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+
+	b.WriteString(`</Types>`)
+
+	return b.String()
+}
+
+// workbook xl/workbook.xml
+func (w *XLSXWriter) workbook() string {
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+
+	for i, name := range w.sheetNames {
+		b.WriteString(`<sheet name="`)
+		xml.EscapeText(&b, []byte(name))
+		fmt.Fprintf(&b, `" sheetId="%d" r:id="rId%d"/>`, i+1, i+1)
+	}
+
+	b.WriteString(`</sheets></workbook>`)
+
+	return b.String()
+}
+
+// workbookRels xl/_rels/workbook.xml.rels
+func (w *XLSXWriter) workbookRels() string {
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+
+	for i := range w.sheetNames {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(w.sheetNames)+1)
+	b.WriteString(`</Relationships>`)
+
+	return b.String()
+}
+
+// columnName 欄位編號轉欄名(0 -> A, 26 -> AA)
+func columnName(index int) string {
+
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+
+	return name
+}
+
+// excelSerial 時間轉 Excel 日期序號(以牆上時間計算,不做時區換算)
+func excelSerial(t time.Time, kind cellKind) float64 {
+
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+
+	switch kind {
+	case kindDate:
+		wall = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case kindTime:
+		return float64(t.Hour()*3600+t.Minute()*60+t.Second()) / 86400
+	}
+
+	return wall.Sub(excelEpoch).Hours() / 24
+}
+
+// truncateRunes 截斷字串為最多 n 個字
+func truncateRunes(s string, n int) string {
+
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+
+	return string(runes[:n])
+}
+
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+// xlsxStyles 樣式: 0 一般、1 日期、2 日期時間、3 時間、4 表頭(粗體)
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="3">` +
+	`<numFmt numFmtId="164" formatCode="yyyy-mm-dd"/>` +
+	`<numFmt numFmtId="165" formatCode="yyyy-mm-dd hh:mm:ss"/>` +
+	`<numFmt numFmtId="166" formatCode="hh:mm:ss"/>` +
+	`</numFmts>` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="5">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="166" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
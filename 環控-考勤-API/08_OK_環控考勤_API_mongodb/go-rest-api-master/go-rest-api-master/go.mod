@@ -6,11 +6,12 @@ require (
 	github.com/fasthttp/websocket v1.4.2 // indirect
 	github.com/globalsign/mgo v0.0.0-20181015135952-eeefdecb41b8 // indirect
 	github.com/gofiber/fiber v1.14.6
-	github.com/gofiber/template v1.0.0 // indirect
+	github.com/gofiber/template v1.0.0
 	github.com/google/uuid v1.1.1 // indirect
 	github.com/json-iterator/go v1.1.9 // indirect
 	github.com/kisielk/errcheck v1.2.0 // indirect
 	github.com/valyala/fasttemplate v1.1.0 // indirect
 	go.mongodb.org/mongo-driver v1.4.1
+	golang.org/x/text v0.3.3
 	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22 // indirect
 )
@@ -1,9 +1,130 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
+
 	"my-rest-api/controller"
+	"my-rest-api/model"
 )
 
 func main() {
+
+	// 重新計算打卡統計: backfill --from 2020-01-01 --to 2020-01-31
+	if len(os.Args) > 1 && os.Args[1] == "backfill" {
+		backfill(os.Args[2:])
+		return
+	}
+
+	// 搬移內嵌的打卡照片到照片儲存區: migrate-photos [--dry-run]
+	if len(os.Args) > 1 && os.Args[1] == "migrate-photos" {
+		migratePhotos(os.Args[2:])
+		return
+	}
+
+	// 為既有照片產生縮圖: thumbnails
+	if len(os.Args) > 1 && os.Args[1] == "thumbnails" {
+		backfillThumbnails()
+		return
+	}
+
+	// 依保存規則清理過期照片與個人資料: retention [--dry-run]
+	if len(os.Args) > 1 && os.Args[1] == "retention" {
+		retention(os.Args[2:])
+		return
+	}
+
 	controller.NewPersonController()
 }
+
+// backfill 重新計算期間內每天的打卡統計(可重複執行,已存在的統計會被更新)
+func backfill(args []string) {
+
+	flags := flag.NewFlagSet("backfill", flag.ExitOnError)
+	fromText := flags.String("from", "", "起日 YYYY-MM-DD")
+	toText := flags.String("to", "", "迄日 YYYY-MM-DD(預設同起日)")
+	flags.Parse(args)
+
+	if *toText == "" {
+		*toText = *fromText
+	}
+
+	from, err := model.ParseDate(*fromText)
+	if err != nil {
+		fmt.Println("起日格式錯誤(應為YYYY-MM-DD)")
+		os.Exit(2)
+	}
+
+	to, err := model.ParseDate(*toText)
+	if err != nil || to.Before(from) {
+		fmt.Println("迄日格式錯誤(應為YYYY-MM-DD,且不可早於起日)")
+		os.Exit(2)
+	}
+
+	if err := controller.BackfillCheckInStatistics(from, to); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// migratePhotos 把打卡紀錄內嵌的照片搬到照片儲存區(可重複執行,只處理尚未搬移的紀錄)
+func migratePhotos(args []string) {
+
+	flags := flag.NewFlagSet("migrate-photos", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "只計算需要搬移的筆數")
+	flags.Parse(args)
+
+	migrated, failed, err := controller.MigrateEmbeddedPhotos(*dryRun)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if *dryRun {
+		fmt.Println("需要搬移的照片=", migrated)
+		return
+	}
+
+	fmt.Println("照片搬移完成 已搬移=", migrated, "失敗=", failed)
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// backfillThumbnails 為既有照片產生所有設定尺寸的縮圖(可重複執行,已有縮圖的略過)
+func backfillThumbnails() {
+
+	created, failed, err := controller.BackfillPhotoThumbnails()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Println("縮圖產生完成 已產生=", created, "失敗=", failed)
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// retention 依保存規則清理過期照片與個人資料,報告寫入 retention_run
+func retention(args []string) {
+
+	flags := flag.NewFlagSet("retention", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "只計算筆數,不異動資料")
+	flags.Parse(args)
+
+	run, err := controller.RunRetention(*dryRun)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	for _, result := range run.Results {
+		if result.Failed > 0 || result.Error != "" {
+			os.Exit(1)
+		}
+	}
+}
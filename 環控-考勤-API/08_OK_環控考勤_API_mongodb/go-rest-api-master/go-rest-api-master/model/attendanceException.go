@@ -0,0 +1,45 @@
+package model
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	// ExceptionMissingCheckOut :缺少下班打卡(打卡都在班別前半段)
+	ExceptionMissingCheckOut = "missing_check_out"
+
+	// ExceptionSinglePunch :當天只有一筆打卡
+	ExceptionSinglePunch = "single_punch"
+
+	// ExceptionDuplicatePunch :短時間內重複打卡
+	ExceptionDuplicatePunch = "duplicate_punch"
+
+	// ExceptionOddHourPunch :打卡時間離班別上下班時間太遠(ex: 03:00 上班打卡)
+	ExceptionOddHourPunch = "odd_hour_punch"
+
+	// ExceptionPunchOnLeave :請假當天有打卡
+	ExceptionPunchOnLeave = "punch_on_leave"
+
+	// ExceptionStatusOpen :待處理
+	ExceptionStatusOpen = "open"
+
+	// ExceptionStatusResolved :已處理(之後的掃描不會再產生或更新)
+	ExceptionStatusResolved = "resolved"
+
+	// ExceptionStatusCleared :更正後不再成立(之後的掃描再次發現時重新開啟)
+	ExceptionStatusCleared = "cleared"
+)
+
+// AttendanceException 出勤異常
+type AttendanceException struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Date        string             `json:"date"`        // 營業日 YYYY-MM-DD
+	Name        string             `json:"name"`        // 員工姓名
+	Department  string             `json:"department"`  // 部門
+	Type        string             `json:"type"`        // 異常類型
+	Evidence    []string           `json:"evidence"`    // 佐證(相關的打卡時間、假別、班別)
+	Status      string             `json:"status"`      // open、resolved、cleared
+	Detected_at string             `json:"detected_at"` // 最近一次偵測時間
+	Resolved_by string             `json:"resolved_by"` // 處理人
+	Resolution  string             `json:"resolution"`  // 處理說明
+	Resolved_at string             `json:"resolved_at"` // 處理時間
+	Cleared_at  string             `json:"cleared_at"`  // 不再成立的時間
+}
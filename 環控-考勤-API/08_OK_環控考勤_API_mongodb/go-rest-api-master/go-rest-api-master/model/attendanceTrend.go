@@ -0,0 +1,30 @@
+package model
+
+// AttendanceTrendPoint 出勤趨勢的一個期間(日、週或月)
+type AttendanceTrendPoint struct {
+	Period                         string             `json:"period"`                         // 期間 ex: 2020-01-06、2020-W02、2020-01
+	From                           string             `json:"from"`                           // 期間起日
+	To                             string             `json:"to"`                             // 期間迄日
+	Expected                       int                `json:"expected"`                       // 應到人次(員工名冊與有打卡紀錄的人,工作日的人次)
+	Attended                       int                `json:"attended"`                       // 實到人次
+	Late                           int                `json:"late"`                           // 遲到人次
+	On_leave                       int                `json:"on_leave"`                       // 請假人次
+	Leave_by_type                  map[string]int     `json:"leave_by_type"`                  // 各假別人次
+	Attendance_rate                float64            `json:"attendance_rate"`                // 出勤率(實到/應到)
+	Late_rate                      float64            `json:"late_rate"`                      // 遲到率(遲到/實到)
+	Leave_rate                     float64            `json:"leave_rate"`                     // 請假率(請假/應到)
+	Leave_rate_by_type             map[string]float64 `json:"leave_rate_by_type"`             // 各假別請假率
+	Attendance_rate_moving_average float64            `json:"attendance_rate_moving_average"` // 出勤率移動平均
+	Late_rate_moving_average       float64            `json:"late_rate_moving_average"`       // 遲到率移動平均
+	Leave_rate_moving_average      float64            `json:"leave_rate_moving_average"`      // 請假率移動平均
+}
+
+// AttendanceTrend 出勤趨勢
+type AttendanceTrend struct {
+	Group_by   string                 `json:"group_by"`   // day、week、month
+	Department string                 `json:"department"` // 部門(空字串為全公司)
+	From       string                 `json:"from"`
+	To         string                 `json:"to"`
+	Window     int                    `json:"window"` // 移動平均的期間數
+	Points     []AttendanceTrendPoint `json:"points"`
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// AuditEntityCheckInRecord :打卡紀錄
+	AuditEntityCheckInRecord = "check_in_record"
+
+	// AuditEntityCheckInStatistics :打卡統計
+	AuditEntityCheckInStatistics = "check_in_statistics"
+
+	// AuditEntityLeave :請假(有假別的打卡紀錄)
+	AuditEntityLeave = "leave"
+
+	// AuditEntityEmployee :員工
+	AuditEntityEmployee = "employee"
+
+	// AuditActionCreate :新增
+	AuditActionCreate = "create"
+
+	// AuditActionUpdate :修改
+	AuditActionUpdate = "update"
+
+	// AuditActionDelete :刪除
+	AuditActionDelete = "delete"
+
+	// AuditActionBatchUpdate :系統批次異動(只記錄摘要,ex: 跨夜班彙整、照片搬移、保存期限清理)
+	AuditActionBatchUpdate = "batch_update"
+
+	// AuditActorSystem :系統排程產生的異動
+	AuditActorSystem = "system"
+)
+
+// AuditLog 資料異動紀錄(只新增,不修改也不刪除;超過個人資料保存期限後清除異動前後資料與原因)
+type AuditLog struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Entity    string             `json:"entity"`    // 資料類別
+	Entity_id string             `json:"entity_id"` // 資料id(員工為員工編號)
+	Action    string             `json:"action"`    // create、update、delete
+	Actor     string             `json:"actor"`     // 異動者
+	Reason    string             `json:"reason"`    // 異動原因
+	Timestamp string             `json:"timestamp"` // 異動時間
+	Before    bson.M             `json:"before"`    // 異動前資料(新增時為空)
+	After     bson.M             `json:"after"`     // 異動後資料(刪除時為空)
+}
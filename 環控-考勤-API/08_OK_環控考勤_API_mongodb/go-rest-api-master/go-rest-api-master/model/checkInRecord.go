@@ -4,9 +4,20 @@ type CheckInRecord struct {
 	id            int    //`json:"_id"`
 	Name          string //注意:struct名稱開頭必須要大寫...否則無法寫入mongoDB!!!不知道為什麼...
 	Check_in_time string
-	Pic           string
+	Pic           string                    //舊資料內嵌的照片(data:image/png;base64,...),搬移後為空
+	Pic_ref       string                    //照片參照(儲存區:key ex: gridfs:5f8d0d55b54764421b7156c9)
+	Pic_type      string                    //照片內容類型(ex: image/png)
+	Pic_thumbs    map[string]PhotoThumbnail //縮圖(key 為尺寸 ex: "64"),第一次取用或執行 thumbnails 指令時產生
 	Leave_type    string
 	Date          string
 	Department    string
 	Position      string
+	Business_date string //營業日(YYYY-MM-DD):跨夜班的打卡歸屬上班那一天,由彙整(consolidate)時寫入
+	Correction_id string //補登打卡的申請id(原始打卡為空)
+}
+
+// PhotoThumbnail 照片縮圖
+type PhotoThumbnail struct {
+	Ref  string `json:"ref"`  // 照片參照(儲存區:key)
+	Type string `json:"type"` // 內容類型
 }
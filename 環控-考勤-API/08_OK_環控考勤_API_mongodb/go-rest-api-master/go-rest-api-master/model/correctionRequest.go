@@ -0,0 +1,59 @@
+package model
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// CorrectionStatusPending :待主管審核
+	CorrectionStatusPending = "pending"
+
+	// CorrectionStatusApproved :已核准(已補登打卡)
+	CorrectionStatusApproved = "approved"
+
+	// CorrectionStatusRejected :已駁回
+	CorrectionStatusRejected = "rejected"
+)
+
+// CorrectionRequest 忘打卡補登申請
+type CorrectionRequest struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Employee_id   string             `json:"employee_id"`   // 申請人員工編號
+	Name          string             `json:"name"`          // 申請人姓名
+	Department    string             `json:"department"`    // 部門
+	Position      string             `json:"position"`      // 職稱
+	Date          string             `json:"date"`          // 營業日 YYYY-MM-DD
+	Claimed_time  string             `json:"claimed_time"`  // 申請補登的打卡時間 YYYY-MM-DD HH:MM:SS
+	Reason        string             `json:"reason"`        // 申請原因
+	Approver_id   string             `json:"approver_id"`   // 審核主管員工編號(申請時的直屬主管)
+	Status        string             `json:"status"`        // pending、approved、rejected
+	Submitted_at  string             `json:"submitted_at"`  // 申請時間
+	Decided_by    string             `json:"decided_by"`    // 審核人
+	Decided_at    string             `json:"decided_at"`    // 審核時間
+	Decision_note string             `json:"decision_note"` // 審核說明
+	Record_id     string             `json:"record_id"`     // 核准後新增的打卡紀錄id
+}
+
+// Validate 檢查補登申請
+func (request CorrectionRequest) Validate() error {
+
+	if request.Employee_id == "" {
+		return errors.New("員工編號不可為空")
+	}
+
+	if _, err := ParseDate(request.Date); err != nil {
+		return errors.New("日期格式錯誤(應為YYYY-MM-DD)")
+	}
+
+	if _, err := ParseCheckInTime(request.Claimed_time); err != nil {
+		return errors.New("補登時間格式錯誤(應為YYYY-MM-DD HH:MM:SS 或 HH:MM)")
+	}
+
+	if request.Reason == "" {
+		return errors.New("申請原因不可為空")
+	}
+
+	return nil
+}
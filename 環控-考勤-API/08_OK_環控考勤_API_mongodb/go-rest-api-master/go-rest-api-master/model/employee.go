@@ -0,0 +1,26 @@
+package model
+
+import "errors"
+
+// Employee 員工基本資料
+type Employee struct {
+	Employee_id string `json:"employee_id"` // 員工編號
+	Name        string `json:"name"`        // 姓名(對應 check_in_record 的 name)
+	Department  string `json:"department"`  // 部門
+	Position    string `json:"position"`    // 職稱
+	Manager_id  string `json:"manager_id"`  // 直屬主管員工編號
+}
+
+// Validate 檢查員工資料
+func (employee Employee) Validate() error {
+
+	if employee.Employee_id == "" {
+		return errors.New("員工編號不可為空")
+	}
+
+	if employee.Name == "" {
+		return errors.New("員工姓名不可為空")
+	}
+
+	return nil
+}
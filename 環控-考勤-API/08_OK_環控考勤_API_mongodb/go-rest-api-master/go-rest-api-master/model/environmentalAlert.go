@@ -0,0 +1,117 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// AlertOperatorAbove :高於門檻(ex: 溫度高於 28°C)
+	AlertOperatorAbove = "above"
+
+	// AlertOperatorBelow :低於門檻(ex: 濕度低於 30%)
+	AlertOperatorBelow = "below"
+
+	// AlertStatusOpen :發生中,尚未確認
+	AlertStatusOpen = "open"
+
+	// AlertStatusAcknowledged :發生中,已確認(恢復正常後自動結束)
+	AlertStatusAcknowledged = "acknowledged"
+
+	// AlertStatusResolved :已恢復正常
+	AlertStatusResolved = "resolved"
+)
+
+// EnvironmentalAlertRule 環控警報規則
+// 數值持續超過門檻 Duration_seconds 秒後發出警報,回到門檻內 Hysteresis 以上才結束(避免在門檻附近反覆發出)
+type EnvironmentalAlertRule struct {
+	Rule_id          string  `json:"rule_id"`          // 規則編號
+	Name             string  `json:"name"`             // 名稱(ex: 會議室過熱)
+	Sensor_id        string  `json:"sensor_id"`        // 指定感測器(空的代表此量測項目的所有感測器)
+	Metric           string  `json:"metric"`           // 量測項目
+	Operator         string  `json:"operator"`         // above、below
+	Threshold        float64 `json:"threshold"`        // 門檻
+	Duration_seconds int     `json:"duration_seconds"` // 持續秒數(0 代表超過門檻就發出)
+	Hysteresis       float64 `json:"hysteresis"`       // 結束警報的緩衝(above: 低於 門檻-緩衝 才結束)
+	Enabled          bool    `json:"enabled"`          // 是否啟用
+}
+
+// Validate 檢查警報規則
+func (rule EnvironmentalAlertRule) Validate() error {
+
+	if !sensorIDPattern.MatchString(rule.Rule_id) {
+		return errors.New("規則編號只能包含英數字、底線、點與減號")
+	}
+
+	if !IsMetric(rule.Metric) {
+		return errors.New("不支援的量測項目: " + rule.Metric)
+	}
+
+	if rule.Operator != AlertOperatorAbove && rule.Operator != AlertOperatorBelow {
+		return errors.New("operator 必須為 above 或 below")
+	}
+
+	if rule.Duration_seconds < 0 {
+		return errors.New("持續秒數不可小於 0")
+	}
+
+	if rule.Hysteresis < 0 {
+		return errors.New("緩衝不可小於 0")
+	}
+
+	return nil
+}
+
+// Breached 數值是否超過門檻
+func (rule EnvironmentalAlertRule) Breached(value float64) bool {
+
+	if rule.Operator == AlertOperatorBelow {
+		return value < rule.Threshold
+	}
+
+	return value > rule.Threshold
+}
+
+// Cleared 數值是否已回到門檻內(含緩衝),可結束警報
+func (rule EnvironmentalAlertRule) Cleared(value float64) bool {
+
+	if rule.Operator == AlertOperatorBelow {
+		return value >= rule.Threshold+rule.Hysteresis
+	}
+
+	return value <= rule.Threshold-rule.Hysteresis
+}
+
+// EnvironmentalAlertEvent 警報狀態異動
+type EnvironmentalAlertEvent struct {
+	Time   time.Time `json:"time"`   // 異動時間
+	Status string    `json:"status"` // 異動後的狀態
+	Value  float64   `json:"value"`  // 當時的數值
+	Actor  string    `json:"actor"`  // 操作人(系統自動判斷為空字串)
+	Note   string    `json:"note"`   // 說明
+}
+
+// EnvironmentalAlert 環控警報(每個規則、感測器同時只有一筆未結束的警報)
+type EnvironmentalAlert struct {
+	ID               primitive.ObjectID        `bson:"_id,omitempty" json:"id"`
+	Rule_id          string                    `json:"rule_id"`                   // 規則編號
+	Rule_name        string                    `json:"rule_name"`                 // 規則名稱
+	Sensor_id        string                    `json:"sensor_id"`                 // 感測器編號
+	Location         string                    `json:"location"`                  // 感測器位置
+	Metric           string                    `json:"metric"`                    // 量測項目
+	Operator         string                    `json:"operator"`                  // above、below
+	Threshold        float64                   `json:"threshold"`                 // 發出時的門檻
+	Duration_seconds int                       `json:"duration_seconds"`          // 發出時的持續秒數
+	Status           string                    `json:"status"`                    // open、acknowledged、resolved
+	Started_at       time.Time                 `json:"started_at"`                // 開始超過門檻的紀錄時間
+	Opened_at        time.Time                 `json:"opened_at"`                 // 發出時間
+	Peak_value       float64                   `json:"peak_value"`                // 期間最嚴重的數值(above 為最大值,below 為最小值)
+	Last_value       float64                   `json:"last_value"`                // 最近一次判斷時的數值
+	Last_time        time.Time                 `json:"last_time"`                 // 最近一次判斷時的紀錄時間
+	Acknowledged_by  string                    `json:"acknowledged_by,omitempty"` // 確認人
+	Acknowledged_at  *time.Time                `json:"acknowledged_at,omitempty"` // 確認時間
+	Resolved_at      *time.Time                `json:"resolved_at,omitempty"`     // 結束時間
+	History          []EnvironmentalAlertEvent `json:"history"`                   // 狀態異動紀錄
+}
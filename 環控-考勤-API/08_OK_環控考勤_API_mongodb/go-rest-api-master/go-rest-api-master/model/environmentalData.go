@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// EnvironmentalData 環控每秒紀錄(Leapsy-Environmental-Control-Database.second-records)
+// 舊資料沒有 Sensor_id、Metric,查詢時視為量測項目 score
+type EnvironmentalData struct {
+	Time      time.Time `json:"time"`      // 紀錄時間(輸出為 RFC 3339)
+	Sensor_id string    `json:"sensor_id"` // 感測器編號
+	Metric    string    `json:"metric"`    // 量測項目
+	Score     float64   `json:"score"`     // 數值(單位見感測器)
+}
+
+// EnvironmentalBucket 環控紀錄的時間區間彙總(每個感測器、量測項目分開彙總)
+type EnvironmentalBucket struct {
+	Sensor_id string    `json:"sensor_id"` // 感測器編號
+	Metric    string    `json:"metric"`    // 量測項目
+	Time      time.Time `json:"time"`      // 區間開始時間
+	Min       float64   `json:"min"`       // 最小值
+	Max       float64   `json:"max"`       // 最大值
+	Avg       float64   `json:"avg"`       // 平均值
+	Count     int       `json:"count"`     // 筆數
+	Last      float64   `json:"last"`      // 區間內最後一筆的值
+	Last_time time.Time `json:"last_time"` // 區間內最後一筆的時間
+}
+
+// EnvironmentalIngestError 寫入失敗的一筆環控紀錄
+type EnvironmentalIngestError struct {
+	Index     int    `json:"index"`               // JSON 陣列的序號(從 0 開始),line protocol 為行號(從 1 開始)
+	Sensor_id string `json:"sensor_id,omitempty"` // 感測器編號
+	Error     string `json:"error"`               // 原因
+}
+
+// EnvironmentalIngestResult 批次寫入環控紀錄的結果
+type EnvironmentalIngestResult struct {
+	Received int                        `json:"received"` // 收到筆數
+	Inserted int                        `json:"inserted"` // 寫入筆數
+	Rejected int                        `json:"rejected"` // 驗證或寫入失敗筆數
+	Errors   []EnvironmentalIngestError `json:"errors"`   // 失敗明細(依序號排序)
+}
@@ -0,0 +1,20 @@
+package model
+
+import "fmt"
+
+// GroupStatistics 部門或職稱的出勤統計
+type GroupStatistics struct {
+	Group           string  `json:"group"`           // 部門或職稱
+	From            string  `json:"from"`            // 統計起日
+	To              string  `json:"to"`              // 統計迄日
+	Expected        int     `json:"expected"`        // 應到人次(工作日)
+	Attended        int     `json:"attended"`        // 實到人次
+	On_leave        int     `json:"on_leave"`        // 請假人次
+	Absent          int     `json:"absent"`          // 缺勤人次
+	Attendance_rate float64 `json:"attendance_rate"` // 出勤率(實到/應到)
+}
+
+// AttendancePercent 出勤率百分比文字(報表顯示用) ex: 93.3%
+func (statistics GroupStatistics) AttendancePercent() string {
+	return fmt.Sprintf("%.1f%%", statistics.Attendance_rate*100)
+}
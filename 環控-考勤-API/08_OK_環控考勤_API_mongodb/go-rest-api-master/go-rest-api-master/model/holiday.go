@@ -0,0 +1,69 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// DayTypeWorkday :工作日
+	DayTypeWorkday = "workday"
+
+	// DayTypeRestDay :休息日(勞基法第24條第2項,週休二日的週六)
+	DayTypeRestDay = "rest_day"
+
+	// DayTypeRegularLeave :例假日(勞基法第36條,週休二日的週日)
+	DayTypeRegularLeave = "regular_leave"
+
+	// DayTypeHoliday :國定假日(勞基法第37條)
+	DayTypeHoliday = "holiday"
+)
+
+// Holiday 行事曆例外日(國定假日、補假、補班)
+type Holiday struct {
+	Date string `json:"date"` // 日期 YYYY-MM-DD
+	Name string `json:"name"` // 名稱 ex: 國慶日、補班
+	Type string `json:"type"` // 日別: holiday、rest_day、regular_leave、workday(補班)
+}
+
+// Validate 檢查行事曆設定
+func (holiday Holiday) Validate() error {
+
+	if _, err := ParseDate(holiday.Date); err != nil {
+		return errors.New("日期格式錯誤(應為YYYY-MM-DD)")
+	}
+
+	switch holiday.Type {
+	case DayTypeWorkday, DayTypeRestDay, DayTypeRegularLeave, DayTypeHoliday:
+		return nil
+	}
+
+	return errors.New("日別必須為 workday、rest_day、regular_leave 或 holiday")
+}
+
+// DayType 取得員工指定日期的日別
+// 優先順序: 行事曆例外日 > 輪班休息日(視為休息日) > 週六休息日、週日例假日 > 工作日
+func DayType(date time.Time, holidays map[string]Holiday, assignment *ShiftAssignment) string {
+
+	if holiday, ok := holidays[date.Format(DateLayout)]; ok {
+		return holiday.Type
+	}
+
+	if assignment != nil && assignment.IsRotating() {
+
+		if assignment.IsWorkDay(date) {
+			return DayTypeWorkday
+		}
+
+		return DayTypeRestDay
+	}
+
+	switch date.Weekday() {
+	case time.Saturday:
+		return DayTypeRestDay
+	case time.Sunday:
+		return DayTypeRegularLeave
+	}
+
+	return DayTypeWorkday
+}
@@ -0,0 +1,121 @@
+package model
+
+// OvertimeTier 加班時數級距(倍率為平日每小時工資的倍數)
+type OvertimeTier struct {
+	Minutes    int     `json:"minutes"`    // 此級距的分鐘數
+	Multiplier float64 `json:"multiplier"` // 倍率
+}
+
+// overtimeTiersOfDayType 各日別的加班費級距(依勞基法第24條、第39條)
+// 最後一個級距承接超出的時數
+var overtimeTiersOfDayType = map[string][]OvertimeTier{
+
+	// 平日延長工時: 前2小時 1.34 倍,再2小時 1.67 倍
+	DayTypeWorkday: {
+		{Minutes: 120, Multiplier: 1.34},
+		{Minutes: 120, Multiplier: 1.67},
+	},
+
+	// 休息日出勤: 前2小時 1.34 倍,第3~8小時 1.67 倍,第9~12小時 2.67 倍
+	DayTypeRestDay: {
+		{Minutes: 120, Multiplier: 1.34},
+		{Minutes: 360, Multiplier: 1.67},
+		{Minutes: 240, Multiplier: 2.67},
+	},
+
+	// 例假日出勤(限天災事變): 8小時內加倍發給,超過部分比照平日延長工時
+	DayTypeRegularLeave: {
+		{Minutes: 480, Multiplier: 2},
+		{Minutes: 120, Multiplier: 1.34},
+		{Minutes: 120, Multiplier: 1.67},
+	},
+
+	// 國定假日出勤: 8小時內加倍發給,超過部分比照平日延長工時
+	DayTypeHoliday: {
+		{Minutes: 480, Multiplier: 2},
+		{Minutes: 120, Multiplier: 1.34},
+		{Minutes: 120, Multiplier: 1.67},
+	},
+}
+
+// SplitOvertime 依日別將加班分鐘數拆成各倍率級距
+func SplitOvertime(dayType string, minutes int) []OvertimeTier {
+
+	tiers, ok := overtimeTiersOfDayType[dayType]
+	if !ok {
+		tiers = overtimeTiersOfDayType[DayTypeWorkday]
+	}
+
+	var result []OvertimeTier
+	remaining := minutes
+
+	for i, tier := range tiers {
+
+		if remaining <= 0 {
+			break
+		}
+
+		used := tier.Minutes
+		if used > remaining || i == len(tiers)-1 {
+			used = remaining
+		}
+
+		result = append(result, OvertimeTier{Minutes: used, Multiplier: tier.Multiplier})
+		remaining -= used
+	}
+
+	return result
+}
+
+// RoundOvertime 將加班分鐘數無條件捨去至 block 分鐘的倍數(ex: 每15分鐘計一單位)
+func RoundOvertime(minutes int, block int) int {
+
+	if minutes <= 0 {
+		return 0
+	}
+
+	if block <= 1 {
+		return minutes
+	}
+
+	return minutes / block * block
+}
+
+// WeightedHours 加權時數(Σ 時數 × 倍率),乘上時薪即為加班費
+func WeightedHours(tiers []OvertimeTier) float64 {
+
+	var hours float64
+	for _, tier := range tiers {
+		hours += float64(tier.Minutes) / 60 * tier.Multiplier
+	}
+
+	return hours
+}
+
+// OvertimeRecord 員工單日加班紀錄
+type OvertimeRecord struct {
+	Name             string         `json:"name"`
+	Department       string         `json:"department"`
+	Date             string         `json:"date"`             // 營業日
+	Day_type         string         `json:"day_type"`         // 日別
+	Shift_code       string         `json:"shift_code"`       // 班別代碼
+	First_in         string         `json:"first_in"`         // 第一筆打卡
+	Last_out         string         `json:"last_out"`         // 最後一筆打卡
+	Raw_minutes      int            `json:"raw_minutes"`      // 捨入前加班分鐘數
+	Overtime_minutes int            `json:"overtime_minutes"` // 捨入後加班分鐘數
+	Tiers            []OvertimeTier `json:"tiers"`            // 各倍率級距
+	Weighted_hours   float64        `json:"weighted_hours"`   // 加權時數
+}
+
+// OvertimeSummary 員工月加班彙總(供薪資計算使用)
+type OvertimeSummary struct {
+	Name                string             `json:"name"`
+	Department          string             `json:"department"`
+	Month               string             `json:"month"`               // YYYY-MM
+	Days                int                `json:"days"`                // 有加班的天數
+	Workday_minutes     int                `json:"workday_minutes"`     // 平日加班分鐘數
+	Rest_day_minutes    int                `json:"rest_day_minutes"`    // 休息日加班分鐘數
+	Holiday_minutes     int                `json:"holiday_minutes"`     // 國定假日、例假日加班分鐘數
+	Hours_by_multiplier map[string]float64 `json:"hours_by_multiplier"` // 各倍率時數 ex: {"1.34": 6.5}
+	Weighted_hours      float64            `json:"weighted_hours"`      // 加權時數
+}
@@ -0,0 +1,64 @@
+package model
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSplitOvertime(t *testing.T) {
+
+	cases := []struct {
+		name    string
+		dayType string
+		minutes int
+		want    []OvertimeTier
+	}{
+		{"無加班", DayTypeWorkday, 0, nil},
+		{"平日1小時", DayTypeWorkday, 60, []OvertimeTier{{60, 1.34}}},
+		{"平日剛好2小時", DayTypeWorkday, 120, []OvertimeTier{{120, 1.34}}},
+		{"平日5小時", DayTypeWorkday, 300, []OvertimeTier{{120, 1.34}, {180, 1.67}}},
+		{"休息日9小時", DayTypeRestDay, 540, []OvertimeTier{{120, 1.34}, {360, 1.67}, {60, 2.67}}},
+		{"國定假日10小時", DayTypeHoliday, 600, []OvertimeTier{{480, 2}, {120, 1.34}}},
+		{"未知日別比照平日", "unknown", 150, []OvertimeTier{{120, 1.34}, {30, 1.67}}},
+	}
+
+	for _, c := range cases {
+		if got := SplitOvertime(c.dayType, c.minutes); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: SplitOvertime(%s, %d) = %v, want %v", c.name, c.dayType, c.minutes, got, c.want)
+		}
+	}
+}
+
+func TestRoundOvertime(t *testing.T) {
+
+	cases := []struct {
+		minutes int
+		block   int
+		want    int
+	}{
+		{-10, 15, 0},
+		{0, 15, 0},
+		{14, 15, 0},
+		{15, 15, 15},
+		{44, 15, 30},
+		{44, 30, 30},
+		{44, 1, 44},
+		{44, 0, 44},
+	}
+
+	for _, c := range cases {
+		if got := RoundOvertime(c.minutes, c.block); got != c.want {
+			t.Errorf("RoundOvertime(%d, %d) = %d, want %d", c.minutes, c.block, got, c.want)
+		}
+	}
+}
+
+func TestWeightedHours(t *testing.T) {
+
+	// 平日捨入後 150 分鐘: 2 × 1.34 + 0.5 × 1.67
+	got := WeightedHours(SplitOvertime(DayTypeWorkday, RoundOvertime(155, 15)))
+	if want := 2*1.34 + 0.5*1.67; math.Abs(got-want) > 1e-9 {
+		t.Errorf("WeightedHours = %v, want %v", got, want)
+	}
+}
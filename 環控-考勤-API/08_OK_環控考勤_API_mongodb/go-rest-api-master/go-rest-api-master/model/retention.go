@@ -0,0 +1,56 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// RetentionActionPurgePhoto :刪除照片(含照片儲存區的原圖與縮圖)
+	RetentionActionPurgePhoto = "purge_photo"
+
+	// RetentionActionAnonymize :個人資料匿名化(彙總統計保留)
+	RetentionActionAnonymize = "anonymize"
+)
+
+// RetentionRule 資料保存規則: 超過保存期限的資料刪除照片或匿名化
+type RetentionRule struct {
+	Name         string   `json:"name"`         // 規則名稱
+	Description  string   `json:"description"`  // 說明
+	Collection   string   `json:"collection"`   // Collection名
+	Date_field   string   `json:"date_field"`   // 判斷期限的日期欄位(YYYY-MM-DD,可未補零)
+	Action       string   `json:"action"`       // purge_photo、anonymize
+	Photo_field  string   `json:"photo_field"`  // 照片欄位(purge_photo)
+	Fields       []string `json:"fields"`       // 改為匿名代號的欄位(anonymize,同一天同一人代號相同)
+	Clear_fields []string `json:"clear_fields"` // 清空的欄位(anonymize)
+	After_days   int      `json:"after_days"`   // 保存天數
+	After_years  int      `json:"after_years"`  // 保存年數
+}
+
+// Cutoff 保存期限: 日期早於此日的資料需要處理
+func (rule RetentionRule) Cutoff(today time.Time) time.Time {
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.Local)
+	return today.AddDate(-rule.After_years, 0, -rule.After_days)
+}
+
+// RetentionResult 一條規則的執行結果
+type RetentionResult struct {
+	Rule           string `json:"rule"`           // 規則名稱
+	Cutoff         string `json:"cutoff"`         // 處理早於此日的資料
+	Matched        int    `json:"matched"`        // 符合條件的筆數
+	Affected       int    `json:"affected"`       // 已處理筆數(試算時為 0)
+	Photos_deleted int    `json:"photos_deleted"` // 從照片儲存區刪除的檔案數
+	Failed         int    `json:"failed"`         // 失敗筆數
+	Error          string `json:"error"`          // 規則無法執行時的錯誤
+}
+
+// RetentionRun 保存期限清理的執行報告
+type RetentionRun struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Trigger     string             `json:"trigger"`     // schedule(排程)、command(指令),或手動執行的人員
+	Dry_run     bool               `json:"dry_run"`     // 試算(只計算筆數,不異動資料)
+	Started_at  string             `json:"started_at"`  // 開始時間
+	Finished_at string             `json:"finished_at"` // 結束時間
+	Results     []RetentionResult  `json:"results"`     // 各規則的結果
+}
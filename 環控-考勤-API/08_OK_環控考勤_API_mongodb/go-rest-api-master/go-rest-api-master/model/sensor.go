@@ -0,0 +1,70 @@
+package model
+
+import (
+	"errors"
+	"regexp"
+)
+
+const (
+	// MetricTemperature :溫度
+	MetricTemperature = "temperature"
+
+	// MetricHumidity :濕度
+	MetricHumidity = "humidity"
+
+	// MetricCO2 :二氧化碳濃度
+	MetricCO2 = "co2"
+
+	// MetricPM25 :PM2.5 濃度
+	MetricPM25 = "pm25"
+
+	// MetricScore :舊資料的量測項目(只有 time、score,沒有 sensor_id、metric),只用於查詢
+	MetricScore = "score"
+)
+
+// Metrics 感測器支援的量測項目
+var Metrics = []string{MetricTemperature, MetricHumidity, MetricCO2, MetricPM25}
+
+// sensorIDPattern 感測器編號格式
+var sensorIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Sensor 環控感測器
+type Sensor struct {
+	Sensor_id        string `json:"sensor_id"`        // 感測器編號(ex: room101-co2)
+	Name             string `json:"name"`             // 名稱
+	Location         string `json:"location"`         // 位置(ex: 101會議室)
+	Metric           string `json:"metric"`           // 量測項目: temperature、humidity、co2、pm25
+	Unit             string `json:"unit"`             // 單位(ex: °C、%、ppm、µg/m³)
+	Sampling_seconds int    `json:"sampling_seconds"` // 取樣間隔(秒)
+	Active           bool   `json:"active"`           // 是否啟用
+}
+
+// Validate 檢查感測器資料
+func (sensor Sensor) Validate() error {
+
+	if !sensorIDPattern.MatchString(sensor.Sensor_id) {
+		return errors.New("感測器編號只能包含英數字、底線、點與減號")
+	}
+
+	if !IsMetric(sensor.Metric) {
+		return errors.New("不支援的量測項目: " + sensor.Metric)
+	}
+
+	if sensor.Sampling_seconds <= 0 {
+		return errors.New("取樣間隔必須大於 0 秒")
+	}
+
+	return nil
+}
+
+// IsMetric 是否為感測器支援的量測項目
+func IsMetric(metric string) bool {
+
+	for _, known := range Metrics {
+		if known == metric {
+			return true
+		}
+	}
+
+	return false
+}
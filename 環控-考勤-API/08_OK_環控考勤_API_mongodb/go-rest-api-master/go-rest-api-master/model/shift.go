@@ -0,0 +1,154 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// Shift 班別
+type Shift struct {
+	Code       string `json:"code"`       // 班別代碼 ex: D、N
+	Name       string `json:"name"`       // 班別名稱 ex: 日班、夜班
+	Start_time string `json:"start_time"` // 上班時間 HH:MM
+	End_time   string `json:"end_time"`   // 下班時間 HH:MM (早於或等於上班時間表示跨夜)
+}
+
+// Validate 檢查班別設定
+func (shift Shift) Validate() error {
+
+	if shift.Code == "" {
+		return errors.New("班別代碼不可為空")
+	}
+
+	if _, err := ParseClock(shift.Start_time); err != nil {
+		return err
+	}
+
+	if _, err := ParseClock(shift.End_time); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CrossesMidnight 是否為跨夜班
+func (shift Shift) CrossesMidnight() bool {
+	start, _ := ParseClock(shift.Start_time)
+	end, _ := ParseClock(shift.End_time)
+	return end <= start
+}
+
+// StartAt 取得指定營業日的上班時間
+func (shift Shift) StartAt(businessDate time.Time) time.Time {
+	start, _ := ParseClock(shift.Start_time)
+	return startOfDay(businessDate).Add(time.Duration(start) * time.Minute)
+}
+
+// EndAt 取得指定營業日的下班時間(跨夜班為隔天)
+func (shift Shift) EndAt(businessDate time.Time) time.Time {
+	end, _ := ParseClock(shift.End_time)
+
+	day := startOfDay(businessDate)
+	if shift.CrossesMidnight() {
+		day = day.AddDate(0, 0, 1)
+	}
+
+	return day.Add(time.Duration(end) * time.Minute)
+}
+
+// ShiftAssignment 員工排班(固定班或輪班)
+type ShiftAssignment struct {
+	Name        string `json:"name"`        // 員工姓名(對應 check_in_record 的 name)
+	Shift_code  string `json:"shift_code"`  // 班別代碼
+	Cycle_start string `json:"cycle_start"` // 輪班週期起始日 YYYY-MM-DD (週期的第一個上班日)
+	On_days     int    `json:"on_days"`     // 連續上班天數 ex: 做四休四 = 4
+	Off_days    int    `json:"off_days"`    // 連續休息天數 ex: 做四休四 = 4 (0 表示不輪休)
+}
+
+// Validate 檢查排班設定
+func (assignment ShiftAssignment) Validate() error {
+
+	if assignment.Name == "" {
+		return errors.New("員工姓名不可為空")
+	}
+
+	if assignment.Shift_code == "" {
+		return errors.New("班別代碼不可為空")
+	}
+
+	if assignment.On_days < 0 || assignment.Off_days < 0 {
+		return errors.New("上班/休息天數不可為負數")
+	}
+
+	if assignment.IsRotating() {
+
+		if assignment.On_days == 0 {
+			return errors.New("輪班必須設定上班天數")
+		}
+
+		if _, err := ParseDate(assignment.Cycle_start); err != nil {
+			return errors.New("輪班必須設定週期起始日(YYYY-MM-DD)")
+		}
+
+	}
+
+	return nil
+}
+
+// IsRotating 是否為輪班(ex: 做四休四)
+func (assignment ShiftAssignment) IsRotating() bool {
+	return assignment.Off_days > 0
+}
+
+// IsWorkDay 指定日期是否為排班上班日(非輪班一律視為上班日,週末假日另外判斷)
+func (assignment ShiftAssignment) IsWorkDay(date time.Time) bool {
+
+	if !assignment.IsRotating() {
+		return true
+	}
+
+	cycleStart, err := ParseDate(assignment.Cycle_start)
+	if err != nil {
+		return true
+	}
+
+	cycle := assignment.On_days + assignment.Off_days
+	position := ((daysBetween(cycleStart, date) % cycle) + cycle) % cycle
+
+	return position < assignment.On_days
+}
+
+// BusinessDate 取得打卡所屬的營業日
+// 跨夜班的下班打卡會落在隔天凌晨,以「下班時間與下一次上班時間的中點」為界:
+// 中點以前的打卡歸屬前一天的班,中點以後的歸屬當天的班。
+// 若前一天依輪班排程是休息日,則仍歸屬當天。
+func BusinessDate(punch time.Time, shift Shift, assignment *ShiftAssignment) time.Time {
+
+	day := startOfDay(punch)
+
+	if !shift.CrossesMidnight() {
+		return day
+	}
+
+	start, _ := ParseClock(shift.Start_time)
+	end, _ := ParseClock(shift.End_time)
+	boundary := end + (start-end)/2
+
+	if minutesOfDay(punch) >= boundary {
+		return day
+	}
+
+	previous := day.AddDate(0, 0, -1)
+	if assignment != nil && !assignment.IsWorkDay(previous) {
+		return day
+	}
+
+	return previous
+}
+
+// daysBetween 兩個日期相差的天數(不受日光節約時間影響)
+func daysBetween(from time.Time, to time.Time) int {
+	fromUTC := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toUTC := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(toUTC.Sub(fromUTC).Hours() / 24)
+}
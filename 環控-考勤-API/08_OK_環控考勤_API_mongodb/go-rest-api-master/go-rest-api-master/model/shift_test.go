@@ -0,0 +1,83 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBusinessDate(t *testing.T) {
+
+	day := Shift{Code: "D", Start_time: "09:00", End_time: "18:00"}
+	night := Shift{Code: "N", Start_time: "22:00", End_time: "06:00"}
+	rotating := &ShiftAssignment{Name: "王小明", Shift_code: "N", Cycle_start: "2020-01-01", On_days: 4, Off_days: 4}
+
+	cases := []struct {
+		name       string
+		punch      string
+		shift      Shift
+		assignment *ShiftAssignment
+		want       string
+	}{
+		{"日班上班", "2020-01-02 08:55:00", day, nil, "2020-01-02"},
+		{"日班凌晨加班", "2020-01-02 01:00:00", day, nil, "2020-01-02"},
+		{"夜班上班", "2020-01-02 21:55:00", night, nil, "2020-01-02"},
+		{"夜班隔天凌晨下班", "2020-01-02 06:05:00", night, nil, "2020-01-01"},
+		{"夜班中點前", "2020-01-02 13:59:00", night, nil, "2020-01-01"},
+		{"夜班中點", "2020-01-02 14:00:00", night, nil, "2020-01-02"},
+		{"輪班前一天上班", "2020-01-04 06:00:00", night, rotating, "2020-01-03"},
+		{"輪班前一天休息", "2020-01-06 06:00:00", night, rotating, "2020-01-06"},
+		{"輪班跨年", "2020-01-01 06:00:00", night, rotating, "2020-01-01"},
+	}
+
+	for _, c := range cases {
+
+		punch, err := ParseCheckInTime(c.punch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := BusinessDate(punch, c.shift, c.assignment).Format(DateLayout); got != c.want {
+			t.Errorf("%s: BusinessDate(%s) = %s, want %s", c.name, c.punch, got, c.want)
+		}
+	}
+}
+
+func TestIsWorkDay(t *testing.T) {
+
+	assignment := ShiftAssignment{Name: "王小明", Shift_code: "N", Cycle_start: "2020-01-01", On_days: 4, Off_days: 4}
+
+	cases := []struct {
+		date string
+		want bool
+	}{
+		{"2020-01-01", true},
+		{"2020-01-04", true},
+		{"2020-01-05", false},
+		{"2020-01-08", false},
+		{"2020-01-09", true},
+		{"2019-12-31", false}, // 週期起始日之前也依週期推算
+		{"2019-12-28", false},
+		{"2019-12-27", true},
+	}
+
+	for _, c := range cases {
+
+		date, _ := ParseDate(c.date)
+		if got := assignment.IsWorkDay(date); got != c.want {
+			t.Errorf("IsWorkDay(%s) = %v, want %v", c.date, got, c.want)
+		}
+	}
+}
+
+func TestShiftEndAt(t *testing.T) {
+
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local)
+
+	if got := (Shift{Start_time: "22:00", End_time: "06:00"}).EndAt(date); !got.Equal(time.Date(2020, 1, 2, 6, 0, 0, 0, time.Local)) {
+		t.Errorf("夜班 EndAt = %v", got)
+	}
+
+	if got := (Shift{Start_time: "09:00", End_time: "18:00"}).EndAt(date); !got.Equal(time.Date(2020, 1, 1, 18, 0, 0, 0, time.Local)) {
+		t.Errorf("日班 EndAt = %v", got)
+	}
+}
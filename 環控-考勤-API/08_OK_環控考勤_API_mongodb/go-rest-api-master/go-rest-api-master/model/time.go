@@ -0,0 +1,75 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DateLayout :日期格式(寫入資料庫的 business_date 一律用此格式)
+	DateLayout = "2006-01-02"
+
+	// DateTimeLayout :日期時間格式(API 回應的打卡時間一律用此格式)
+	DateTimeLayout = "2006-01-02 15:04:05"
+
+	// looseDateLayout :寬鬆日期格式(可解析 2020-01-01 與 2020-1-1)
+	looseDateLayout = "2006-1-2"
+
+	// looseCheckInTimeLayout :寬鬆打卡時間格式(可解析 2020-01-01 09:09:00 與 2020-1-1 9:9:0)
+	looseCheckInTimeLayout = "2006-1-2 15:4:5"
+)
+
+// ParseDate 解析日期字串
+func ParseDate(s string) (time.Time, error) {
+	return time.ParseInLocation(looseDateLayout, strings.TrimSpace(s), time.Local)
+}
+
+// ParseCheckInTime 解析打卡時間字串
+func ParseCheckInTime(s string) (time.Time, error) {
+	return time.ParseInLocation(looseCheckInTimeLayout, strings.TrimSpace(s), time.Local)
+}
+
+// DateVariants 取得日期的各種寫法
+// 資料庫中 date 欄位有 2020-01-01 與 2020-1-1 兩種寫法,查詢時兩種都要找
+func DateVariants(t time.Time) []string {
+	padded := t.Format(DateLayout)
+	short := t.Format(looseDateLayout)
+
+	if padded == short {
+		return []string{padded}
+	}
+
+	return []string{padded, short}
+}
+
+// ParseClock 解析 HH:MM 時間,回傳距離午夜的分鐘數
+func ParseClock(s string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("時間格式錯誤(應為HH:MM): %q", s)
+	}
+
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, fmt.Errorf("時間格式錯誤(小時): %q", s)
+	}
+
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("時間格式錯誤(分鐘): %q", s)
+	}
+
+	return hour*60 + minute, nil
+}
+
+// minutesOfDay 取得時間距離當天午夜的分鐘數
+func minutesOfDay(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
+}
+
+// startOfDay 取得當天午夜
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,56 @@
+package model
+
+const (
+	// TimesheetStatusPresent :出勤
+	TimesheetStatusPresent = "present"
+
+	// TimesheetStatusLate :遲到
+	TimesheetStatusLate = "late"
+
+	// TimesheetStatusLeave :請假(假別見 Leave_type)
+	TimesheetStatusLeave = "leave"
+
+	// TimesheetStatusHoliday :休假日(休息日、例假日、國定假日、輪休)
+	TimesheetStatusHoliday = "holiday"
+
+	// TimesheetStatusAbsent :缺勤
+	TimesheetStatusAbsent = "absent"
+
+	// TimesheetStatusUpcoming :尚未到的日期
+	TimesheetStatusUpcoming = "upcoming"
+)
+
+// TimesheetDay 出勤月報表的單日資料
+type TimesheetDay struct {
+	Date           string `json:"date"`           // 營業日
+	Day_type       string `json:"day_type"`       // 日別
+	Status         string `json:"status"`         // 狀態
+	Leave_type     string `json:"leave_type"`     // 假別
+	Shift_code     string `json:"shift_code"`     // 班別代碼
+	First_in       string `json:"first_in"`       // 第一筆打卡
+	Last_out       string `json:"last_out"`       // 最後一筆打卡
+	Worked_minutes int    `json:"worked_minutes"` // 工作分鐘數(已扣除休息時間)
+	Late_minutes   int    `json:"late_minutes"`   // 遲到分鐘數
+}
+
+// TimesheetTotals 出勤月報表的月合計
+type TimesheetTotals struct {
+	Present_days   int            `json:"present_days"`   // 出勤天數(含遲到)
+	Late_days      int            `json:"late_days"`      // 遲到天數
+	Leave_days     int            `json:"leave_days"`     // 請假天數
+	Leave_by_type  map[string]int `json:"leave_by_type"`  // 各假別天數
+	Holiday_days   int            `json:"holiday_days"`   // 休假天數
+	Absent_days    int            `json:"absent_days"`    // 缺勤天數
+	Worked_minutes int            `json:"worked_minutes"` // 工作分鐘數
+	Late_minutes   int            `json:"late_minutes"`   // 遲到分鐘數
+}
+
+// Timesheet 員工出勤月報表
+type Timesheet struct {
+	Employee_id string          `json:"employee_id"`
+	Name        string          `json:"name"`
+	Department  string          `json:"department"`
+	Month       string          `json:"month"` // YYYY-MM
+	Days        []TimesheetDay  `json:"days"`
+	Totals      TimesheetTotals `json:"totals"`
+}
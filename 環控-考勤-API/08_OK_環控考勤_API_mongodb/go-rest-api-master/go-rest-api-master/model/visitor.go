@@ -0,0 +1,52 @@
+package model
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// VisitorStatusRegistered :已預約,尚未到訪
+	VisitorStatusRegistered = "registered"
+
+	// VisitorStatusCheckedIn :已到訪
+	VisitorStatusCheckedIn = "checked_in"
+
+	// VisitorStatusCheckedOut :已離開
+	VisitorStatusCheckedOut = "checked_out"
+)
+
+// Visitor 訪客登記
+type Visitor struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name           string             `json:"name"`           // 訪客姓名
+	Company        string             `json:"company"`        // 訪客公司
+	Phone          string             `json:"phone"`          // 聯絡電話
+	Purpose        string             `json:"purpose"`        // 來訪事由
+	Host_employee  string             `json:"host_employee"`  // 受訪員工(員工編號或姓名)
+	Visit_date     string             `json:"visit_date"`     // 預約日期 YYYY-MM-DD
+	Arrival_time   string             `json:"arrival_time"`   // 到訪時間
+	Departure_time string             `json:"departure_time"` // 離開時間
+	Photo          string             `json:"photo"`          // 照片(data:image/png;base64,...)
+	Badge_number   string             `json:"badge_number"`   // 訪客證號碼
+	Status         string             `json:"status"`         // 狀態: registered、checked_in、checked_out
+}
+
+// Validate 檢查訪客預約資料
+func (visitor Visitor) Validate() error {
+
+	if visitor.Name == "" {
+		return errors.New("訪客姓名不可為空")
+	}
+
+	if visitor.Host_employee == "" {
+		return errors.New("受訪員工不可為空")
+	}
+
+	if _, err := ParseDate(visitor.Visit_date); err != nil {
+		return errors.New("預約日期格式錯誤(應為YYYY-MM-DD)")
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"errors"
+	"net/url"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// WebhookEventNotArrivedFinal :當天未到名單已結算
+	WebhookEventNotArrivedFinal = "attendance.not_arrived_final"
+
+	// WebhookEventLeaveApproved :請假已核准(登錄)
+	WebhookEventLeaveApproved = "leave.approved"
+
+	// WebhookEventExceptionRaised :發現新的出勤異常
+	WebhookEventExceptionRaised = "exception.raised"
+
+	// WebhookEventExceptionCleared :待處理的出勤異常在更正後不再成立
+	WebhookEventExceptionCleared = "exception.cleared"
+
+	// WebhookEventEnvAlertOpened :發出環控警報
+	WebhookEventEnvAlertOpened = "env.alert.opened"
+
+	// WebhookEventEnvAlertResolved :環控警報已恢復正常
+	WebhookEventEnvAlertResolved = "env.alert.resolved"
+
+	// WebhookEventPing :測試連線
+	WebhookEventPing = "webhook.ping"
+
+	// DeliveryStatusPending :等待傳送(含等待重試)
+	DeliveryStatusPending = "pending"
+
+	// DeliveryStatusSucceeded :傳送成功(對方回應 2xx)
+	DeliveryStatusSucceeded = "succeeded"
+
+	// DeliveryStatusFailed :重試次數用完仍失敗
+	DeliveryStatusFailed = "failed"
+)
+
+// WebhookEvents 可訂閱的事件
+var WebhookEvents = []string{WebhookEventNotArrivedFinal, WebhookEventLeaveApproved, WebhookEventExceptionRaised, WebhookEventExceptionCleared, WebhookEventEnvAlertOpened, WebhookEventEnvAlertResolved}
+
+// Webhook 已登記的 webhook 接收端
+type Webhook struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Url         string             `json:"url"`         // 接收端網址
+	Events      []string           `json:"events"`      // 訂閱的事件(空的代表全部)
+	Secret      string             `json:"secret"`      // HMAC-SHA256 簽章金鑰
+	Description string             `json:"description"` // 說明
+	Active      bool               `json:"active"`      // 是否啟用
+	Created_at  string             `json:"created_at"`
+}
+
+// Validate 檢查 webhook 設定
+func (webhook Webhook) Validate() error {
+
+	target, err := url.Parse(webhook.Url)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return errors.New("url 必須為 http 或 https 網址")
+	}
+
+	for _, event := range webhook.Events {
+		if !isWebhookEvent(event) {
+			return errors.New("不支援的事件: " + event)
+		}
+	}
+
+	return nil
+}
+
+// Subscribes 是否訂閱此事件(測試連線一律傳送)
+func (webhook Webhook) Subscribes(event string) bool {
+
+	if len(webhook.Events) == 0 || event == WebhookEventPing {
+		return true
+	}
+
+	for _, subscribed := range webhook.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isWebhookEvent 是否為可訂閱的事件
+func isWebhookEvent(event string) bool {
+
+	for _, known := range WebhookEvents {
+		if known == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WebhookDelivery webhook 傳送紀錄
+type WebhookDelivery struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Webhook_id      string             `json:"webhook_id"`
+	Event           string             `json:"event"`           // 事件
+	Payload         string             `json:"payload"`         // 傳送的 JSON
+	Status          string             `json:"status"`          // pending、succeeded、failed
+	Attempts        int                `json:"attempts"`        // 已嘗試次數
+	Response_status int                `json:"response_status"` // 最近一次的 HTTP 狀態碼
+	Last_error      string             `json:"last_error"`      // 最近一次的錯誤
+	Created_at      string             `json:"created_at"`
+	Next_attempt_at string             `json:"next_attempt_at"` // 下次傳送時間
+	Delivered_at    string             `json:"delivered_at"`    // 傳送成功時間
+}
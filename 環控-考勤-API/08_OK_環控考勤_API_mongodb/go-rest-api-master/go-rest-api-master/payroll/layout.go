@@ -0,0 +1,148 @@
+// Package payroll 依宣告式版面定義(欄位順序、寬度、補字、編碼、日期格式)產生薪資廠商需要的檔案
+// 更換薪資廠商時只需要新增版面定義檔,不需要改程式
+package payroll
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	// FormatFixed :固定長度格式
+	FormatFixed = "fixed"
+
+	// FormatCSV :分隔字元格式
+	FormatCSV = "csv"
+
+	// EncodingUTF8 :UTF-8 編碼
+	EncodingUTF8 = "utf-8"
+
+	// EncodingBig5 :Big5 編碼
+	EncodingBig5 = "big5"
+
+	// AlignLeft :靠左對齊
+	AlignLeft = "left"
+
+	// AlignRight :靠右對齊
+	AlignRight = "right"
+)
+
+// Column 欄位定義
+type Column struct {
+	Field           string `json:"field"`           // 資料欄位 ex: employee_id、leave_hours.病假、overtime_hours.1.34
+	Title           string `json:"title"`           // 表頭文字(Header 為 true 時輸出)
+	Value           string `json:"value"`           // 固定值(Field 為空時),或資料沒有此欄位時的預設值
+	Width           int    `json:"width"`           // 欄寬(固定長度格式以編碼後的位元組計算)
+	Align           string `json:"align"`           // left、right(預設: 數字靠右、其餘靠左)
+	Pad             string `json:"pad"`             // 補字字元(預設空白)
+	Decimals        int    `json:"decimals"`        // 小數位數
+	Implied_decimal bool   `json:"implied_decimal"` // 不輸出小數點 ex: 12.50 -> 1250
+	Date_format     string `json:"date_format"`     // 日期格式(覆蓋版面預設值)
+}
+
+// Layout 版面定義
+type Layout struct {
+	Name        string   `json:"name"`        // 版面名稱
+	Format      string   `json:"format"`      // fixed、csv
+	Encoding    string   `json:"encoding"`    // utf-8、big5
+	Delimiter   string   `json:"delimiter"`   // CSV 分隔字元(預設逗號)
+	Header      bool     `json:"header"`      // 是否輸出表頭
+	Line_ending string   `json:"line_ending"` // 換行字元(預設 \r\n)
+	Date_format string   `json:"date_format"` // 日期格式: yyyy 西元年、yyy 民國年、MM 月、dd 日 ex: yyyMMdd
+	Extension   string   `json:"extension"`   // 輸出副檔名(預設 fixed 為 txt、csv 為 csv)
+	Columns     []Column `json:"columns"`
+}
+
+// LoadLayout 讀取版面定義檔(JSON)
+func LoadLayout(path string) (Layout, error) {
+
+	var layout Layout
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return layout, err
+	}
+
+	if err := json.Unmarshal(content, &layout); err != nil {
+		return layout, fmt.Errorf("版面定義檔格式錯誤 %s: %v", path, err)
+	}
+
+	layout.applyDefaults()
+
+	return layout, layout.Validate()
+}
+
+// applyDefaults 補上預設值
+func (layout *Layout) applyDefaults() {
+
+	layout.Format = strings.ToLower(layout.Format)
+	layout.Encoding = strings.ToLower(layout.Encoding)
+
+	if layout.Format == "" {
+		layout.Format = FormatCSV
+	}
+
+	if layout.Encoding == "" || layout.Encoding == "utf8" {
+		layout.Encoding = EncodingUTF8
+	}
+
+	if layout.Delimiter == "" {
+		layout.Delimiter = ","
+	}
+
+	if layout.Line_ending == "" {
+		layout.Line_ending = "\r\n"
+	}
+
+	if layout.Date_format == "" {
+		layout.Date_format = "yyyy-MM-dd"
+	}
+
+	if layout.Extension == "" {
+		layout.Extension = "csv"
+		if layout.Format == FormatFixed {
+			layout.Extension = "txt"
+		}
+	}
+}
+
+// Validate 檢查版面定義
+func (layout Layout) Validate() error {
+
+	if layout.Format != FormatFixed && layout.Format != FormatCSV {
+		return errors.New("format 必須為 fixed 或 csv")
+	}
+
+	if layout.Encoding != EncodingUTF8 && layout.Encoding != EncodingBig5 {
+		return errors.New("encoding 必須為 utf-8 或 big5")
+	}
+
+	if len(layout.Columns) == 0 {
+		return errors.New("至少需要一個欄位")
+	}
+
+	for i, column := range layout.Columns {
+
+		if column.Field == "" && column.Value == "" {
+			return fmt.Errorf("第%d欄必須指定 field 或 value", i+1)
+		}
+
+		if layout.Format == FormatFixed && column.Width <= 0 {
+			return fmt.Errorf("固定長度格式第%d欄(%s)必須指定 width", i+1, column.Field)
+		}
+
+		if column.Align != "" && column.Align != AlignLeft && column.Align != AlignRight {
+			return fmt.Errorf("第%d欄 align 必須為 left 或 right", i+1)
+		}
+
+		// 補字字元直接以位元組輸出,限定一個 ASCII 字元才不會因編碼不同而超出欄寬
+		if len(column.Pad) > 1 || (column.Pad != "" && column.Pad[0] >= 0x80) {
+			return fmt.Errorf("第%d欄 pad 只能是一個 ASCII 字元", i+1)
+		}
+	}
+
+	return nil
+}
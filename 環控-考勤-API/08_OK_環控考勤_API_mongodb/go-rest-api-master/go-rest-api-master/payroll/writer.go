@@ -0,0 +1,276 @@
+package payroll
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// Row 一位員工的薪資資料(key 對應 Column.Field)
+// 值可為 string、int、float64、time.Time
+type Row map[string]interface{}
+
+// Write 依版面定義輸出薪資檔
+func Write(w io.Writer, layout Layout, rows []Row) error {
+
+	encoder := newEncoder(layout.Encoding)
+
+	if layout.Header {
+
+		var fields [][]byte
+		for _, column := range layout.Columns {
+
+			field, err := encode(encoder, column.Title)
+			if err != nil {
+				return err
+			}
+
+			fields = append(fields, field)
+		}
+
+		if err := writeLine(w, layout, fields, nil); err != nil {
+			return err
+		}
+	}
+
+	for r, row := range rows {
+
+		var fields [][]byte
+		var numeric []bool
+
+		for _, column := range layout.Columns {
+
+			text, isNumber := formatValue(layout, column, row)
+
+			field, err := encode(encoder, text)
+			if err != nil {
+				return err
+			}
+
+			fields = append(fields, field)
+			numeric = append(numeric, isNumber)
+		}
+
+		if err := writeLine(w, layout, fields, numeric); err != nil {
+			return fmt.Errorf("第%d筆資料%v", r+1, err)
+		}
+	}
+
+	return nil
+}
+
+// writeLine 輸出一行(固定長度格式補齊欄寬,CSV 格式加上分隔字元)
+func writeLine(w io.Writer, layout Layout, fields [][]byte, numeric []bool) error {
+
+	var line bytes.Buffer
+
+	for i, field := range fields {
+
+		column := layout.Columns[i]
+
+		if layout.Format == FormatFixed {
+
+			isNumber := numeric != nil && numeric[i]
+
+			fixed, err := fixedWidth(field, column, isNumber, layout.Encoding)
+			if err != nil {
+				return fmt.Errorf("第%d欄(%s): %v", i+1, column.Field, err)
+			}
+
+			line.Write(fixed)
+			continue
+		}
+
+		if i > 0 {
+			line.WriteString(layout.Delimiter)
+		}
+
+		line.Write(quoteCSV(field, layout.Delimiter))
+	}
+
+	line.WriteString(layout.Line_ending)
+
+	_, err := w.Write(line.Bytes())
+
+	return err
+}
+
+// fixedWidth 將欄位補齊或截斷為固定位元組數(不會切斷多位元組字元)
+// 只有文字可以截斷,數字超過欄寬時回傳錯誤,避免金額被截斷後仍然輸出
+func fixedWidth(field []byte, column Column, isNumber bool, encodingName string) ([]byte, error) {
+
+	if len(field) > column.Width {
+
+		if isNumber {
+			return nil, fmt.Errorf("數字 %s 超過欄寬 %d", field, column.Width)
+		}
+
+		field = truncateBytes(field, column.Width, encodingName)
+	}
+
+	pad := column.Pad
+	if pad == "" {
+		pad = " "
+	}
+
+	align := column.Align
+	if align == "" {
+		align = AlignLeft
+		if isNumber {
+			align = AlignRight
+		}
+	}
+
+	// 補字字元限定 ASCII(見 Layout.Validate),UTF-8 與 Big5 的位元組相同
+	padding := bytes.Repeat([]byte(pad), column.Width-len(field))
+
+	// 負數靠右補零時,負號要放在最前面 ex: -000012
+	if align == AlignRight && pad == "0" && len(field) > 0 && field[0] == '-' {
+		return append(append([]byte("-"), padding...), field[1:]...), nil
+	}
+
+	if align == AlignRight {
+		return append(padding, field...), nil
+	}
+
+	return append(field, padding...), nil
+}
+
+// truncateBytes 截斷為最多 n 個位元組,不切斷多位元組字元
+func truncateBytes(field []byte, n int, encodingName string) []byte {
+
+	if encodingName == EncodingBig5 {
+
+		// Big5 的中文字為 2 個位元組,第一個位元組 >= 0x81
+		i := 0
+		for i < len(field) {
+
+			size := 1
+			if field[i] >= 0x81 {
+				size = 2
+			}
+
+			if i+size > n {
+				break
+			}
+
+			i += size
+		}
+
+		return field[:i]
+	}
+
+	// UTF-8
+	i := n
+	for i > 0 && i < len(field) && field[i]&0xC0 == 0x80 {
+		i--
+	}
+
+	return field[:i]
+}
+
+// quoteCSV 欄位含分隔字元、引號或換行時加上引號
+func quoteCSV(field []byte, delimiter string) []byte {
+
+	if !bytes.Contains(field, []byte(delimiter)) && !bytes.ContainsAny(field, "\"\r\n") {
+		return field
+	}
+
+	quoted := bytes.Replace(field, []byte(`"`), []byte(`""`), -1)
+
+	return append(append([]byte(`"`), quoted...), '"')
+}
+
+// formatValue 依欄位定義將資料轉為文字,並回傳是否為數字
+func formatValue(layout Layout, column Column, row Row) (string, bool) {
+
+	if column.Field == "" {
+		return column.Value, false
+	}
+
+	value, ok := row[column.Field]
+	if !ok {
+
+		// 資料沒有此欄位時使用預設值(ex: 當月沒有請病假,value 設為 "0")
+		if number, err := strconv.ParseFloat(column.Value, 64); err == nil {
+			return formatNumber(number, column), true
+		}
+
+		return column.Value, false
+	}
+
+	switch v := value.(type) {
+
+	case int:
+		return formatNumber(float64(v), column), true
+
+	case float64:
+		return formatNumber(v, column), true
+
+	case time.Time:
+		dateFormat := column.Date_format
+		if dateFormat == "" {
+			dateFormat = layout.Date_format
+		}
+		return FormatDate(v, dateFormat), false
+
+	case string:
+		return v, false
+	}
+
+	if value == nil {
+		return "", false
+	}
+
+	return fmt.Sprint(value), false
+}
+
+// formatNumber 數字依小數位數輸出
+func formatNumber(number float64, column Column) string {
+
+	if column.Implied_decimal {
+		return strconv.FormatFloat(math.Round(number*math.Pow10(column.Decimals)), 'f', 0, 64)
+	}
+
+	return strconv.FormatFloat(number, 'f', column.Decimals, 64)
+}
+
+// FormatDate 依日期格式輸出: yyyy 西元年、yyy 民國年、MM 月、dd 日
+func FormatDate(t time.Time, dateFormat string) string {
+
+	replacer := strings.NewReplacer(
+		"yyyy", fmt.Sprintf("%04d", t.Year()),
+		"yyy", fmt.Sprintf("%03d", t.Year()-1911),
+		"MM", fmt.Sprintf("%02d", int(t.Month())),
+		"dd", fmt.Sprintf("%02d", t.Day()),
+	)
+
+	return replacer.Replace(dateFormat)
+}
+
+// newEncoder 取得編碼器(Big5 無法表示的字元以 ? 取代)
+func newEncoder(encodingName string) *encoding.Encoder {
+
+	if encodingName == EncodingBig5 {
+		return encoding.ReplaceUnsupported(traditionalchinese.Big5.NewEncoder())
+	}
+
+	return nil
+}
+
+// encode 將文字轉為指定編碼
+func encode(encoder *encoding.Encoder, text string) ([]byte, error) {
+
+	if encoder == nil {
+		return []byte(text), nil
+	}
+
+	return encoder.Bytes([]byte(text))
+}
@@ -0,0 +1,111 @@
+package payroll
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFixedWidth(t *testing.T) {
+
+	big5 := func(text string) []byte {
+		field, err := encode(newEncoder(EncodingBig5), text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return field
+	}
+
+	cases := []struct {
+		name     string
+		field    []byte
+		column   Column
+		isNumber bool
+		encoding string
+		want     []byte
+	}{
+		{"文字靠左補空白", []byte("A01"), Column{Width: 5}, false, EncodingUTF8, []byte("A01  ")},
+		{"數字靠右補零", []byte("1250"), Column{Width: 6, Pad: "0"}, true, EncodingUTF8, []byte("001250")},
+		{"負數負號在前", []byte("-12"), Column{Width: 6, Pad: "0"}, true, EncodingUTF8, []byte("-00012")},
+		{"數字剛好等寬", []byte("123456"), Column{Width: 6}, true, EncodingUTF8, []byte("123456")},
+		{"Big5中文補空白", big5("王小明"), Column{Width: 8}, false, EncodingBig5, append(big5("王小明"), "  "...)},
+		{"Big5截斷不切斷中文字", big5("王小明"), Column{Width: 5}, false, EncodingBig5, append(big5("王小"), ' ')},
+		{"Big5中英混合截斷", big5("A王小"), Column{Width: 4}, false, EncodingBig5, append(big5("A王"), ' ')},
+		{"UTF-8截斷不切斷中文字", []byte("王小明"), Column{Width: 7}, false, EncodingUTF8, []byte("王小 ")},
+	}
+
+	for _, c := range cases {
+
+		got, err := fixedWidth(c.field, c.column, c.isNumber, c.encoding)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+
+		if !bytes.Equal(got, c.want) {
+			t.Errorf("%s: fixedWidth = %q, want %q", c.name, got, c.want)
+		}
+
+		if len(got) > c.column.Width {
+			t.Errorf("%s: 長度 %d 超過欄寬 %d", c.name, len(got), c.column.Width)
+		}
+	}
+}
+
+func TestFixedWidthNumberOverflow(t *testing.T) {
+
+	if _, err := fixedWidth([]byte("1234567"), Column{Width: 6}, true, EncodingBig5); err == nil {
+		t.Error("數字超過欄寬應回傳錯誤")
+	}
+}
+
+func TestWriteNumberOverflow(t *testing.T) {
+
+	layout := Layout{
+		Format:   FormatFixed,
+		Encoding: EncodingBig5,
+		Columns: []Column{
+			{Field: "name", Width: 6},
+			{Field: "salary", Width: 6, Pad: "0"},
+		},
+	}
+	layout.applyDefaults()
+
+	rows := []Row{
+		{"name": "王小明", "salary": 35000},
+		{"name": "李大華", "salary": 1234567},
+	}
+
+	err := Write(&bytes.Buffer{}, layout, rows)
+	if err == nil {
+		t.Fatal("數字超過欄寬應回傳錯誤")
+	}
+
+	if !strings.Contains(err.Error(), "第2筆") || !strings.Contains(err.Error(), "salary") {
+		t.Errorf("錯誤訊息應包含列與欄位: %v", err)
+	}
+}
+
+func TestValidatePad(t *testing.T) {
+
+	cases := []struct {
+		pad     string
+		wantErr bool
+	}{
+		{"", false},
+		{" ", false},
+		{"0", false},
+		{"00", true},
+		{"＊", true},
+		{"　", true},
+	}
+
+	for _, c := range cases {
+
+		layout := Layout{Format: FormatFixed, Encoding: EncodingBig5, Columns: []Column{{Field: "name", Width: 6, Pad: c.pad}}}
+
+		if err := layout.Validate(); (err != nil) != c.wantErr {
+			t.Errorf("pad %q: Validate() = %v, wantErr %v", c.pad, err, c.wantErr)
+		}
+	}
+}
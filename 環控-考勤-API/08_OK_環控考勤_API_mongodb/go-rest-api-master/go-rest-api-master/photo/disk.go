@@ -0,0 +1,91 @@
+package photo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DiskStore 存放在本機目錄的照片(key 為檔名)
+type DiskStore struct {
+	directory string
+}
+
+// NewDiskStore 建立本機磁碟照片儲存區(目錄不存在時自動建立)
+func NewDiskStore(directory string) (*DiskStore, error) {
+
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+
+	return &DiskStore{directory: directory}, nil
+}
+
+// Name 儲存區名稱
+func (store *DiskStore) Name() string {
+	return StoreDisk
+}
+
+// path 照片檔案路徑(key 不可含路徑,避免讀到目錄外的檔案)
+func (store *DiskStore) path(key string) (string, error) {
+
+	if key == "" || key != filepath.Base(key) || strings.HasPrefix(key, ".") {
+		return "", ErrNotFound
+	}
+
+	return filepath.Join(store.directory, key), nil
+}
+
+// Put 存入照片(先寫暫存檔再改名,避免讀到寫一半的檔案)
+func (store *DiskStore) Put(name string, data []byte) (string, error) {
+
+	path, err := store.path(filepath.Base(name))
+	if err != nil {
+		return "", err
+	}
+
+	temp := path + ".tmp"
+	if err := ioutil.WriteFile(temp, data, 0644); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return "", err
+	}
+
+	return filepath.Base(path), nil
+}
+
+// Get 讀取照片
+func (store *DiskStore) Get(key string) ([]byte, error) {
+
+	path, err := store.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+// Delete 刪除照片
+func (store *DiskStore) Delete(key string) error {
+
+	path, err := store.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+
+	return err
+}
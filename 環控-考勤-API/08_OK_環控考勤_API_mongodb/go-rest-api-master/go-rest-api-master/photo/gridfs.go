@@ -0,0 +1,79 @@
+package photo
+
+import (
+	"bytes"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GridFSStore 存放在 MongoDB GridFS 的照片(key 為檔案 _id)
+type GridFSStore struct {
+	bucket *gridfs.Bucket
+}
+
+// NewGridFSStore 建立 GridFS 照片儲存區
+func NewGridFSStore(database *mongo.Database, bucketName string) (*GridFSStore, error) {
+
+	bucket, err := gridfs.NewBucket(database, options.GridFSBucket().SetName(bucketName))
+	if err != nil {
+		return nil, err
+	}
+
+	return &GridFSStore{bucket: bucket}, nil
+}
+
+// Name 儲存區名稱
+func (store *GridFSStore) Name() string {
+	return StoreGridFS
+}
+
+// Put 存入照片
+func (store *GridFSStore) Put(name string, data []byte) (string, error) {
+
+	fileID, err := store.bucket.UploadFromStream(name, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	return fileID.Hex(), nil
+}
+
+// Get 讀取照片
+func (store *GridFSStore) Get(key string) ([]byte, error) {
+
+	fileID, err := primitive.ObjectIDFromHex(key)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	var buffer bytes.Buffer
+	if _, err := store.bucket.DownloadToStream(fileID, &buffer); err != nil {
+		if err == gridfs.ErrFileNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Delete 刪除照片
+func (store *GridFSStore) Delete(key string) error {
+
+	fileID, err := primitive.ObjectIDFromHex(key)
+	if err != nil {
+		return ErrNotFound
+	}
+
+	if err := store.bucket.Delete(fileID); err != nil {
+		if err == gridfs.ErrFileNotFound {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+// Package photo 打卡照片的儲存(GridFS 或本機磁碟),打卡紀錄只保留照片的參照
+package photo
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	// StoreGridFS :存放在 MongoDB GridFS
+	StoreGridFS = "gridfs"
+
+	// StoreDisk :存放在本機磁碟
+	StoreDisk = "disk"
+)
+
+// ErrNotFound 找不到照片
+var ErrNotFound = errors.New("找不到照片")
+
+// ErrUnsupportedType 不支援的照片格式
+var ErrUnsupportedType = errors.New("照片格式必須為 png、jpeg、gif 或 webp")
+
+// contentTypes 允許的照片內容類型(回應時直接當作 Content-Type,不能照單全收)
+var contentTypes = map[string]string{
+	"image/png":  "image/png",
+	"image/jpeg": "image/jpeg",
+	"image/jpg":  "image/jpeg",
+	"image/gif":  "image/gif",
+	"image/webp": "image/webp",
+}
+
+// NormalizeContentType 檢查照片內容類型(忽略大小寫與參數),回傳標準寫法
+func NormalizeContentType(contentType string) (string, error) {
+
+	if index := strings.Index(contentType, ";"); index >= 0 {
+		contentType = contentType[:index]
+	}
+
+	normalized, ok := contentTypes[strings.ToLower(strings.TrimSpace(contentType))]
+	if !ok {
+		return "", ErrUnsupportedType
+	}
+
+	return normalized, nil
+}
+
+// ServeContentType 回應照片時的內容類型: 記錄的類型不在允許清單時,改依內容判斷,仍不是允許的格式則回傳錯誤
+func ServeContentType(contentType string, data []byte) (string, error) {
+
+	if normalized, err := NormalizeContentType(contentType); err == nil {
+		return normalized, nil
+	}
+
+	return NormalizeContentType(http.DetectContentType(data))
+}
+
+// Store 照片儲存區
+type Store interface {
+
+	// Name 儲存區名稱(寫在參照的前綴)
+	Name() string
+
+	// Put 存入照片,回傳儲存區內的 key
+	Put(name string, data []byte) (string, error)
+
+	// Get 讀取照片
+	Get(key string) ([]byte, error)
+
+	// Delete 刪除照片
+	Delete(key string) error
+}
+
+// Reference 照片參照 ex: gridfs:5f8d0d55b54764421b7156c9
+func Reference(store Store, key string) string {
+	return store.Name() + ":" + key
+}
+
+// ParseReference 拆解照片參照為儲存區名稱與 key
+func ParseReference(ref string) (string, string, error) {
+
+	index := strings.Index(ref, ":")
+	if index <= 0 || index == len(ref)-1 {
+		return "", "", errors.New("照片參照格式錯誤: " + ref)
+	}
+
+	return ref[:index], ref[index+1:], nil
+}
+
+// IsDataURL 是否為內嵌的 data URL 照片
+func IsDataURL(value string) bool {
+	return strings.HasPrefix(value, "data:")
+}
+
+// DecodeDataURL 解開 data:image/png;base64,... 格式的照片,回傳內容類型與內容(只接受允許的照片格式)
+func DecodeDataURL(value string) (string, []byte, error) {
+
+	if !IsDataURL(value) {
+		return "", nil, errors.New("不是 data URL")
+	}
+
+	comma := strings.Index(value, ",")
+	if comma < 0 {
+		return "", nil, errors.New("data URL 格式錯誤")
+	}
+
+	header := strings.TrimPrefix(value[:comma], "data:")
+	if !strings.HasSuffix(header, ";base64") {
+		return "", nil, errors.New("只支援 base64 編碼的照片")
+	}
+
+	contentType, err := NormalizeContentType(strings.TrimSuffix(header, ";base64"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value[comma+1:]))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return contentType, data, nil
+}
+
+// Extension 內容類型對應的副檔名
+func Extension(contentType string) string {
+
+	switch contentType {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	}
+
+	return ".bin"
+}
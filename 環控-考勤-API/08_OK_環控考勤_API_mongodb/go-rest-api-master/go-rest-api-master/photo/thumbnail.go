@@ -0,0 +1,128 @@
+package photo
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+
+	// 註冊 gif 解碼
+	_ "image/gif"
+)
+
+// ErrImageTooLarge 原圖像素超過上限,不產生縮圖
+var ErrImageTooLarge = errors.New("照片尺寸過大,無法產生縮圖")
+
+// Thumbnail 產生縮圖: 等比例縮小到寬高都不超過 size(原圖較小時不放大)
+// 先讀取圖檔標頭檢查寬高,像素超過 maxPixels 時不解碼;沒有解碼器的格式(ex: webp)回傳 ErrUnsupportedType
+// jpeg 原圖輸出 jpeg,其他格式輸出 png,回傳內容類型與內容
+func Thumbnail(data []byte, size int, maxPixels int) (string, []byte, error) {
+
+	if size <= 0 {
+		return "", nil, errors.New("縮圖尺寸必須大於 0")
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err == image.ErrFormat {
+		return "", nil, ErrUnsupportedType
+	}
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return "", nil, ErrImageTooLarge
+	}
+
+	source, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, err
+	}
+
+	thumbnail := shrink(source, size)
+
+	var buffer bytes.Buffer
+
+	if format == "jpeg" {
+		if err := jpeg.Encode(&buffer, thumbnail, &jpeg.Options{Quality: 85}); err != nil {
+			return "", nil, err
+		}
+		return "image/jpeg", buffer.Bytes(), nil
+	}
+
+	if err := png.Encode(&buffer, thumbnail); err != nil {
+		return "", nil, err
+	}
+
+	return "image/png", buffer.Bytes(), nil
+}
+
+// shrink 以區域平均縮小圖片(每個縮圖像素取原圖對應區塊的平均色)
+func shrink(source image.Image, size int) *image.NRGBA {
+
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// 轉成 NRGBA 以便直接讀取像素
+	src := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(src, src.Bounds(), source, bounds.Min, draw.Src)
+
+	if width <= size && height <= size {
+		return src
+	}
+
+	dstWidth, dstHeight := size, size
+	if width > height {
+		dstHeight = maxInt(1, height*size/width)
+	} else {
+		dstWidth = maxInt(1, width*size/height)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < dstHeight; y++ {
+
+		y0, y1 := y*height/dstHeight, maxInt((y+1)*height/dstHeight, y*height/dstHeight+1)
+
+		for x := 0; x < dstWidth; x++ {
+
+			x0, x1 := x*width/dstWidth, maxInt((x+1)*width/dstWidth, x*width/dstWidth+1)
+
+			var r, g, b, a, count int
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					pixel := src.Pix[offset : offset+4]
+					r += int(pixel[0]) * int(pixel[3])
+					g += int(pixel[1]) * int(pixel[3])
+					b += int(pixel[2]) * int(pixel[3])
+					a += int(pixel[3])
+					count++
+					offset += 4
+				}
+			}
+
+			// 依透明度加權,避免透明像素的顏色滲入
+			pixel := dst.Pix[dst.PixOffset(x, y) : dst.PixOffset(x, y)+4]
+			if a > 0 {
+				pixel[0] = uint8(r / a)
+				pixel[1] = uint8(g / a)
+				pixel[2] = uint8(b / a)
+			}
+			pixel[3] = uint8(a / count)
+		}
+	}
+
+	return dst
+}
+
+// maxInt 取較大值
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
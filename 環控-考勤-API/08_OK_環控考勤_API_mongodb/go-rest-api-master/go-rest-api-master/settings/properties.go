@@ -10,6 +10,228 @@ const (
 	// CollectionNameOfCheckInStatistics :Collection名:打卡統計
 	CollectionNameOfCheckInStatistics = "check_in_statistics" //Collection
 
+	// CollectionNameOfShift :Collection名:班別
+	CollectionNameOfShift = "shift" //Collection
+
+	// CollectionNameOfShiftAssignment :Collection名:員工排班
+	CollectionNameOfShiftAssignment = "shift_assignment" //Collection
+
+	// DefaultShiftStartTime :未排班員工的預設上班時間
+	DefaultShiftStartTime = "09:00"
+
+	// DefaultShiftEndTime :未排班員工的預設下班時間
+	DefaultShiftEndTime = "18:00"
+
+	// CollectionNameOfHoliday :Collection名:行事曆例外日(國定假日、補班)
+	CollectionNameOfHoliday = "holiday" //Collection
+
+	// OvertimeRoundingMinutes :加班時數捨入單位(分鐘),未滿一單位不計
+	OvertimeRoundingMinutes = 15
+
+	// OvertimeBreakMinutes :計算工作時數時,連續工作超過 OvertimeBreakAfterMinutes 扣除的休息分鐘數
+	OvertimeBreakMinutes = 60
+
+	// OvertimeBreakAfterMinutes :連續工作超過此分鐘數才扣除休息時間(勞基法第35條)
+	OvertimeBreakAfterMinutes = 240
+
+	// CollectionNameOfEmployee :Collection名:員工
+	CollectionNameOfEmployee = "employee" //Collection
+
+	// LateGraceMinutes :遲到寬限分鐘數(上班時間後幾分鐘內打卡不算遲到)
+	LateGraceMinutes = 0
+
+	// CollectionNameOfVisitor :Collection名:訪客登記
+	CollectionNameOfVisitor = "visitor" //Collection
+
+	// ViewsDirectory :報表頁面樣板目錄(相對於執行目錄)
+	ViewsDirectory = "./views"
+
+	// PayrollLayoutDirectory :薪資檔版面定義目錄(每個 .json 檔為一種版面,相對於執行目錄)
+	PayrollLayoutDirectory = "./payroll_layouts"
+
+	// DefaultPayrollLayout :預設薪資檔版面名稱
+	DefaultPayrollLayout = "default"
+
+	// LeaveHoursPerDay :請假一天折算的時數
+	LeaveHoursPerDay = 8
+
+	// StatisticsCutoffTime :每天產生打卡統計(check_in_statistics)的時間(HH:MM)
+	StatisticsCutoffTime = "23:30"
+
+	// StatisticsSettleGraceMinutes :最晚的班別(含跨夜班)下班後再等待的分鐘數,之後才結算該營業日
+	StatisticsSettleGraceMinutes = 30
+
+	// StatisticsJobRecheckMinutes :等待結算期間重新檢查班別設定的間隔(分鐘)
+	StatisticsJobRecheckMinutes = 10
+
+	// StatisticsCatchUpMaxDays :啟動時補結算的最多天數(從最後結算的營業日往後補)
+	StatisticsCatchUpMaxDays = 31
+
+	// CollectionNameOfAttendanceException :Collection名:出勤異常
+	CollectionNameOfAttendanceException = "attendance_exception" //Collection
+
+	// DuplicatePunchSeconds :與前一筆打卡間隔少於此秒數視為重複打卡
+	DuplicatePunchSeconds = 60
+
+	// OddPunchToleranceMinutes :打卡時間早於上班或晚於下班超過此分鐘數視為異常時間打卡
+	OddPunchToleranceMinutes = 240
+
+	// CollectionNameOfAuditLog :Collection名:資料異動紀錄(只新增)
+	CollectionNameOfAuditLog = "audit_log" //Collection
+
+	// AuditActorHeader :指定異動者的 header
+	AuditActorHeader = "X-Actor"
+
+	// AuditReasonHeader :說明異動原因的 header
+	AuditReasonHeader = "X-Audit-Reason"
+
+	// AuditLogDefaultLimit :查詢異動紀錄預設回傳筆數
+	AuditLogDefaultLimit = 200
+
+	// AuditLogMaxLimit :查詢異動紀錄筆數上限
+	AuditLogMaxLimit = 1000
+
+	// CollectionNameOfCorrectionRequest :Collection名:忘打卡補登申請
+	CollectionNameOfCorrectionRequest = "correction_request" //Collection
+
+	// CollectionNameOfWebhook :Collection名:webhook 接收端
+	CollectionNameOfWebhook = "webhook" //Collection
+
+	// CollectionNameOfWebhookDelivery :Collection名:webhook 傳送紀錄
+	CollectionNameOfWebhookDelivery = "webhook_delivery" //Collection
+
+	// WebhookMaxAttempts :webhook 最多傳送次數(含第一次)
+	WebhookMaxAttempts = 6
+
+	// WebhookRetryBaseSeconds :webhook 第一次重試的等待秒數,之後每次加倍
+	WebhookRetryBaseSeconds = 30
+
+	// WebhookTimeoutSeconds :webhook 等待接收端回應的秒數
+	WebhookTimeoutSeconds = 10
+
+	// WebhookPollSeconds :檢查待傳送 webhook 的間隔秒數
+	WebhookPollSeconds = 5
+
+	// WebhookDeliveryQueryLimit :查詢傳送紀錄最多回傳筆數
+	WebhookDeliveryQueryLimit = 500
+
+	// LiveFeedHeartbeatSeconds :即時推播心跳間隔(秒)
+	LiveFeedHeartbeatSeconds = 15
+
+	// LiveFeedPollSeconds :即時推播檢查新打卡紀錄(含外部匯入)的間隔(秒)
+	LiveFeedPollSeconds = 2
+
+	// LiveFeedBatchSize :即時推播每次最多讀取的新打卡紀錄筆數
+	LiveFeedBatchSize = 500
+
+	// LiveFeedBufferSize :每個連線最多暫存的事件數(來不及接收時丟棄)
+	LiveFeedBufferSize = 256
+
+	// LiveFeedStatisticsDays :即時推播保留統計變動比對的天數
+	LiveFeedStatisticsDays = 2
+
+	// PhotoStore :新照片的儲存區(gridfs 或 disk)
+	PhotoStore = "gridfs"
+
+	// PhotoBucketName :GridFS 照片 bucket 名稱
+	PhotoBucketName = "check_in_photo"
+
+	// PhotoDirectory :本機磁碟照片目錄(PhotoStore 為 disk 時使用)
+	PhotoDirectory = "./photos"
+
+	// PhotoMigrationBatchSize :搬移內嵌照片時每批處理筆數
+	PhotoMigrationBatchSize = 100
+
+	// PhotoThumbnailMaxPixels :可產生縮圖的原圖像素上限(寬 × 高),避免解碼超大圖檔耗盡記憶體
+	PhotoThumbnailMaxPixels = 40000000
+
+	// CollectionNameOfRetentionRun :Collection名:保存期限清理的執行報告
+	CollectionNameOfRetentionRun = "retention_run" //Collection
+
+	// PhotoRetentionDays :照片(打卡、訪客)保存天數,過期刪除
+	PhotoRetentionDays = 90
+
+	// PersonalDataRetentionYears :姓名等個人資料保存年數,過期匿名化(彙總統計保留)
+	PersonalDataRetentionYears = 3
+
+	// RetentionRunTime :每天執行保存期限清理的時間
+	RetentionRunTime = "03:00"
+
+	// RetentionScheduleDryRun :排程清理只試算(不異動資料)
+	RetentionScheduleDryRun = false
+
+	// RetentionBatchSize :保存期限清理每批處理筆數
+	RetentionBatchSize = 200
+
+	// ClosedDateMaxAgeSeconds :已結算營業日的查詢結果可快取秒數(補登仍可能異動,不設為永久)
+	ClosedDateMaxAgeSeconds = 3600
+
+	// ShiftTableCacheSeconds :判斷營業日是否已結算時,班別與排班的快取秒數(班別、排班異動時立即失效)
+	ShiftTableCacheSeconds = 60
+
+	// EnvDbName :環控資料庫名
+	EnvDbName = "Leapsy-Environmental-Control-Database" //DB
+
+	// CollectionNameOfEnvSecondRecord :Collection名:環控每秒紀錄
+	CollectionNameOfEnvSecondRecord = "second-records" //Collection
+
+	// CollectionNameOfEnvSensor :Collection名:環控感測器
+	CollectionNameOfEnvSensor = "sensors" //Collection
+
+	// CollectionNameOfEnvAlertRule :Collection名:環控警報規則
+	CollectionNameOfEnvAlertRule = "alert-rules" //Collection
+
+	// CollectionNameOfEnvAlert :Collection名:環控警報
+	CollectionNameOfEnvAlert = "alerts" //Collection
+
+	// CollectionNameOfEnvAlertCursor :Collection名:環控警報各規則、感測器已檢查到的紀錄
+	CollectionNameOfEnvAlertCursor = "alert-cursors" //Collection
+
+	// EnvDefaultRangeHours :環控查詢未指定 from 時,往前查詢的小時數
+	EnvDefaultRangeHours = 24
+
+	// EnvMaxRangeDays :環控查詢區間上限(天)
+	EnvMaxRangeDays = 366
+
+	// EnvDefaultLimit :環控查詢預設筆數
+	EnvDefaultLimit = 1000
+
+	// EnvMaxLimit :環控查詢筆數上限
+	EnvMaxLimit = 10000
+
+	// EnvMaxBuckets :環控區間彙總最多回傳的區間數
+	EnvMaxBuckets = 10000
+
+	// EnvDefaultPoints :環控 LTTB 降取樣預設點數
+	EnvDefaultPoints = 500
+
+	// EnvMaxPoints :環控 LTTB 降取樣點數上限
+	EnvMaxPoints = 5000
+
+	// EnvCursorBatchSize :環控降取樣逐筆讀取時每批筆數
+	EnvCursorBatchSize = 5000
+
+	// EnvIngestMaxPoints :環控批次寫入每次最多筆數
+	EnvIngestMaxPoints = 50000
+
+	// EnvIngestBatchSize :環控批次寫入每次 bulk write 筆數
+	EnvIngestBatchSize = 5000
+
+	// EnvIngestMaxFutureSeconds :環控紀錄時間最多可超前伺服器時間的秒數(容許時鐘誤差)
+	EnvIngestMaxFutureSeconds = 300
+
+	// EnvSettleMinutes :環控查詢的結束時間早於現在此分鐘數以上時允許快取(裝置補傳的緩衝,與出勤的營業日結算無關)
+	EnvSettleMinutes = 60
+
+	// EnvAlertEvaluateSeconds :定期檢查環控警報規則的間隔(秒),寫入紀錄時也會立即檢查
+	EnvAlertEvaluateSeconds = 60
+
+	// EnvAlertStaleSeconds :規則第一次檢查某感測器時,只檢查此秒數內寫入的紀錄(之後依寫入順序接續檢查)
+	EnvAlertStaleSeconds = 300
+
+	// EnvAlertBatchSize :環控警報每次檢查一個規則、感測器時最多取出的新寫入紀錄筆數(超過時下一輪接續)
+	EnvAlertBatchSize = 50000
+
 	// const CollectionName = "persion"                                //Collection //範例程式
 
 	// PortOfAPI :開API的Port
@@ -19,3 +241,6 @@ const (
 	// PortOfMongoDB :MongoDB的Port
 	PortOfMongoDB string = "27017"
 )
+
+// PhotoThumbnailSizes :可產生的縮圖尺寸(寬高上限,px),以 /checkInRecord/:id/photo?size=64 取用
+var PhotoThumbnailSizes = []int{64, 128}
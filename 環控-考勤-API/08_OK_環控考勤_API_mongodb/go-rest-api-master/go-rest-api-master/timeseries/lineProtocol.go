@@ -0,0 +1,201 @@
+package timeseries
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Line InfluxDB line protocol 的一行
+// 格式: measurement[,tag=value...] field=value[,field=value...] [timestamp]
+type Line struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]float64 // 只保留數值欄位(浮點數、1i 整數、布林值轉為 1、0),字串欄位略過
+	Time        time.Time          // 沒有 timestamp 時為零值,由呼叫端決定預設時間
+}
+
+// Precisions line protocol timestamp 可用的精度
+var Precisions = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// ParseLine 解析一行 line protocol,timestamp 依 precision 換算(ex: time.Millisecond)
+func ParseLine(line string, precision time.Duration) (Line, error) {
+
+	result := Line{Tags: map[string]string{}, Fields: map[string]float64{}}
+
+	sections := splitUnescaped(strings.TrimSpace(line), ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return result, errors.New("格式應為 measurement[,tag=value] field=value [timestamp]")
+	}
+
+	// measurement 與 tag
+	keys := splitUnescaped(sections[0], ',', false)
+	result.Measurement = unescape(keys[0])
+	if result.Measurement == "" {
+		return result, errors.New("缺少 measurement")
+	}
+
+	for _, tag := range keys[1:] {
+
+		pair := splitUnescaped(tag, '=', false)
+		if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+			return result, errors.New("tag 格式錯誤: " + tag)
+		}
+
+		result.Tags[unescape(pair[0])] = unescape(pair[1])
+	}
+
+	// field
+	for _, field := range splitUnescaped(sections[1], ',', true) {
+
+		index := indexUnescaped(field, '=')
+		if index <= 0 {
+			return result, errors.New("field 格式錯誤: " + field)
+		}
+
+		key, raw := unescape(field[:index]), field[index+1:]
+
+		// 字串欄位略過
+		if strings.HasPrefix(raw, `"`) {
+			if len(raw) < 2 || !strings.HasSuffix(raw, `"`) {
+				return result, errors.New("field 字串未結束: " + field)
+			}
+			continue
+		}
+
+		value, err := parseFieldValue(raw)
+		if err != nil {
+			return result, errors.New("field " + key + " " + err.Error())
+		}
+
+		result.Fields[key] = value
+	}
+
+	if len(result.Fields) == 0 && !strings.Contains(sections[1], `"`) {
+		return result, errors.New("缺少 field")
+	}
+
+	// timestamp
+	if len(sections) == 3 {
+
+		timestamp, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return result, errors.New("timestamp 必須為整數: " + sections[2])
+		}
+
+		if precision <= 0 {
+			precision = time.Nanosecond
+		}
+
+		if timestamp > math.MaxInt64/int64(precision) || timestamp < math.MinInt64/int64(precision) {
+			return result, errors.New("timestamp 超出範圍: " + sections[2])
+		}
+
+		result.Time = time.Unix(0, timestamp*int64(precision))
+	}
+
+	return result, nil
+}
+
+// parseFieldValue 解析數值欄位(1.5、15i、15u、true、false)
+func parseFieldValue(raw string) (float64, error) {
+
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, nil
+	}
+
+	if strings.HasSuffix(raw, "i") || strings.HasSuffix(raw, "u") {
+
+		value, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return 0, errors.New("整數格式錯誤: " + raw)
+		}
+
+		return float64(value), nil
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, errors.New("數值格式錯誤: " + raw)
+	}
+
+	return value, nil
+}
+
+// splitUnescaped 以未跳脫(\)的 separator 切割,quoted 為 true 時雙引號內的 separator 不切割
+// 以空白切割時忽略連續的空白
+func splitUnescaped(s string, separator byte, quoted bool) []string {
+
+	parts := []string{}
+	start := 0
+	inQuote := false
+
+	for i := 0; i < len(s); i++ {
+
+		switch {
+		case s[i] == '\\':
+			i++
+		case quoted && s[i] == '"':
+			inQuote = !inQuote
+		case s[i] == separator && !inQuote:
+			if separator != ' ' || i > start {
+				parts = append(parts, s[start:i])
+			}
+			start = i + 1
+		}
+	}
+
+	if separator != ' ' || len(s) > start {
+		parts = append(parts, s[start:])
+	}
+
+	return parts
+}
+
+// indexUnescaped 第一個未跳脫的字元位置(找不到為 -1)
+func indexUnescaped(s string, c byte) int {
+
+	for i := 0; i < len(s); i++ {
+
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+
+		if s[i] == c {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// unescape 移除跳脫字元(\, \= \空白)
+func unescape(s string) string {
+
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+
+		builder.WriteByte(s[i])
+	}
+
+	return builder.String()
+}
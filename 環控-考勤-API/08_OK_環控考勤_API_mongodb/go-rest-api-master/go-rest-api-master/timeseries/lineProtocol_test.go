@@ -0,0 +1,116 @@
+package timeseries
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseLine(t *testing.T) {
+
+	newYear := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name        string
+		line        string
+		precision   time.Duration
+		measurement string
+		tags        map[string]string
+		fields      map[string]float64
+		time        time.Time
+	}{
+		{
+			"毫秒 timestamp",
+			"env,sensor_id=A1,location=101 co2=450,pm25=12i 1577836800000", time.Millisecond,
+			"env", map[string]string{"sensor_id": "A1", "location": "101"}, map[string]float64{"co2": 450, "pm25": 12}, newYear,
+		},
+		{
+			"秒 timestamp",
+			"env temp=21.5 1577836800", time.Second,
+			"env", map[string]string{}, map[string]float64{"temp": 21.5}, newYear,
+		},
+		{
+			"未指定精度為奈秒",
+			"env temp=21.5 1577836800000000000", 0,
+			"env", map[string]string{}, map[string]float64{"temp": 21.5}, newYear,
+		},
+		{
+			"沒有 timestamp",
+			"env temp=-3.5e1", time.Second,
+			"env", map[string]string{}, map[string]float64{"temp": -35}, time.Time{},
+		},
+		{
+			"跳脫的空白、逗號、等號",
+			`my\ env,location=101\ 會議室,sensor\,id=A\=1 room\ temp=21`, time.Second,
+			"my env", map[string]string{"location": "101 會議室", "sensor,id": "A=1"}, map[string]float64{"room temp": 21}, time.Time{},
+		},
+		{
+			"字串欄位略過(引號內的逗號與空白不切割)",
+			`env,sensor_id=A1 note="hello, world",temp=20 1577836800`, time.Second,
+			"env", map[string]string{"sensor_id": "A1"}, map[string]float64{"temp": 20}, newYear,
+		},
+		{
+			"只有字串欄位",
+			`env note="x"`, time.Second,
+			"env", map[string]string{}, map[string]float64{}, time.Time{},
+		},
+		{
+			"布林值與無號整數",
+			"env ok=t,bad=FALSE,count=7u", time.Second,
+			"env", map[string]string{}, map[string]float64{"ok": 1, "bad": 0, "count": 7}, time.Time{},
+		},
+		{
+			"連續空白",
+			"  env  temp=1   1577836800  ", time.Second,
+			"env", map[string]string{}, map[string]float64{"temp": 1}, newYear,
+		},
+		{
+			"奈秒的最大值",
+			"env temp=1 9223372036854775807", time.Nanosecond,
+			"env", map[string]string{}, map[string]float64{"temp": 1}, time.Unix(0, 9223372036854775807),
+		},
+	}
+
+	for _, c := range cases {
+
+		got, err := ParseLine(c.line, c.precision)
+		if err != nil {
+			t.Errorf("%s: ParseLine(%q) error: %v", c.name, c.line, err)
+			continue
+		}
+
+		if got.Measurement != c.measurement || !reflect.DeepEqual(got.Tags, c.tags) || !reflect.DeepEqual(got.Fields, c.fields) || !got.Time.Equal(c.time) {
+			t.Errorf("%s: ParseLine(%q) = %+v, want %s %v %v %v", c.name, c.line, got, c.measurement, c.tags, c.fields, c.time)
+		}
+	}
+}
+
+func TestParseLineErrors(t *testing.T) {
+
+	cases := []struct {
+		name      string
+		line      string
+		precision time.Duration
+	}{
+		{"缺少 field", "env", time.Second},
+		{"缺少 measurement", ",sensor_id=A1 temp=1", time.Second},
+		{"tag 沒有值", "env,sensor_id temp=1", time.Second},
+		{"tag 值為空", "env,sensor_id= temp=1", time.Second},
+		{"field 沒有名稱", "env =1", time.Second},
+		{"field 不是數字", "env temp=abc", time.Second},
+		{"field 為 NaN", "env temp=NaN", time.Second},
+		{"field 為 Inf", "env temp=+Inf", time.Second},
+		{"整數格式錯誤", "env count=1.5i", time.Second},
+		{"字串未結束", `env note="abc`, time.Second},
+		{"timestamp 不是整數", "env temp=1 2020-01-01", time.Second},
+		{"多餘的欄位", "env temp=1 1577836800 extra", time.Second},
+		{"毫秒超出範圍", "env temp=1 9223372036854775807", time.Millisecond},
+		{"秒超出範圍(負數)", "env temp=1 -9223372036854775", time.Second},
+	}
+
+	for _, c := range cases {
+		if got, err := ParseLine(c.line, c.precision); err == nil {
+			t.Errorf("%s: ParseLine(%q) = %+v, want error", c.name, c.line, got)
+		}
+	}
+}
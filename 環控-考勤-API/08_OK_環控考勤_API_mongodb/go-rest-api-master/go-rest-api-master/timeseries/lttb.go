@@ -0,0 +1,181 @@
+// Package timeseries 時間序列資料處理(圖表用的降取樣、InfluxDB line protocol 解析)
+package timeseries
+
+import (
+	"math"
+	"time"
+)
+
+// Point 時間序列的一個點
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// LTTB 以 Largest-Triangle-Three-Buckets 演算法把 total 個點降為 threshold 個點,保留曲線的形狀(峰值、谷值)
+// 點依時間順序逐一加入,只暫存兩個區間的點,資料量大時也不會整份放進記憶體
+type LTTB struct {
+	total     int
+	threshold int
+	every     float64
+
+	index    int     // 下一個加入的點的序號
+	selected []Point // 已選出的點
+	previous Point   // 上一個選出的點
+
+	current      []Point // 目前區間的點
+	currentIndex int     // 目前區間序號
+	next         []Point // 下一個區間的點
+}
+
+// NewLTTB 建立降取樣: total 為總點數,threshold 為輸出點數(至少 3)
+func NewLTTB(total int, threshold int) *LTTB {
+
+	if threshold < 3 {
+		threshold = 3
+	}
+
+	lttb := &LTTB{total: total, threshold: threshold, currentIndex: -1}
+
+	if total > threshold {
+		lttb.every = float64(total-2) / float64(threshold-2)
+	}
+
+	return lttb
+}
+
+// bucketOf 點所屬的區間: -1 為第一個點,threshold-2 為最後一個點
+func (lttb *LTTB) bucketOf(index int) int {
+
+	if index == 0 {
+		return -1
+	}
+
+	if index >= lttb.total-1 {
+		return lttb.threshold - 2
+	}
+
+	// 區間 i 的範圍為 [floor(i*every)+1, floor((i+1)*every)+1)
+	bucket := int(float64(index-1) / lttb.every)
+	for bucket < lttb.threshold-3 && int(math.Floor(float64(bucket+1)*lttb.every))+1 <= index {
+		bucket++
+	}
+	for bucket > 0 && int(math.Floor(float64(bucket)*lttb.every))+1 > index {
+		bucket--
+	}
+
+	return bucket
+}
+
+// Add 依時間順序加入一個點
+func (lttb *LTTB) Add(point Point) {
+
+	index := lttb.index
+	lttb.index++
+
+	// 點數不超過輸出點數時全部保留
+	if lttb.every == 0 {
+		lttb.selected = append(lttb.selected, point)
+		return
+	}
+
+	bucket := lttb.bucketOf(index)
+
+	switch {
+
+	case bucket < 0:
+		lttb.selected = append(lttb.selected, point)
+		lttb.previous = point
+
+	case lttb.currentIndex < 0:
+		lttb.currentIndex = bucket
+		lttb.current = append(lttb.current, point)
+
+	case bucket == lttb.currentIndex:
+		lttb.current = append(lttb.current, point)
+
+	case bucket == lttb.currentIndex+1:
+		lttb.next = append(lttb.next, point)
+
+	default:
+		// 下一個區間已完整,可以從目前區間選出一個點
+		lttb.selectFrom(lttb.current, average(lttb.next))
+		lttb.current, lttb.next = lttb.next, []Point{point}
+		lttb.currentIndex++
+	}
+}
+
+// Result 取得降取樣的結果(依時間排序)
+func (lttb *LTTB) Result() []Point {
+
+	if lttb.every == 0 || lttb.currentIndex < 0 {
+		return lttb.selected
+	}
+
+	result := append([]Point{}, lttb.selected...)
+
+	if len(lttb.next) == 0 {
+		// 實際點數比 total 少: 目前區間當作最後一個區間
+		return append(result, lttb.current[len(lttb.current)-1])
+	}
+
+	chosen := largestTriangle(lttb.previous, lttb.current, average(lttb.next))
+
+	// 最後一個區間只保留最後一個點
+	return append(result, chosen, lttb.next[len(lttb.next)-1])
+}
+
+// selectFrom 從區間選出與上一個選出的點、下一個區間平均點構成最大三角形的點
+func (lttb *LTTB) selectFrom(bucket []Point, nextAverage Point) {
+
+	chosen := largestTriangle(lttb.previous, bucket, nextAverage)
+	lttb.selected = append(lttb.selected, chosen)
+	lttb.previous = chosen
+}
+
+// largestTriangle 找出與 a、c 構成最大三角形的點
+func largestTriangle(a Point, bucket []Point, c Point) Point {
+
+	origin := a.Time
+	ax, ay := 0.0, a.Value
+	cx, cy := c.Time.Sub(origin).Seconds(), c.Value
+
+	chosen := bucket[0]
+	maxArea := -1.0
+
+	for _, b := range bucket {
+
+		bx, by := b.Time.Sub(origin).Seconds(), b.Value
+		area := math.Abs((ax-cx)*(by-ay)-(ax-bx)*(cy-ay)) / 2
+
+		if area > maxArea {
+			maxArea = area
+			chosen = b
+		}
+	}
+
+	return chosen
+}
+
+// average 區間的平均點(時間與數值都取平均)
+func average(points []Point) Point {
+
+	if len(points) == 0 {
+		return Point{}
+	}
+
+	origin := points[0].Time
+
+	var seconds, value float64
+	for _, point := range points {
+		seconds += point.Time.Sub(origin).Seconds()
+		value += point.Value
+	}
+
+	count := float64(len(points))
+
+	return Point{
+		Time:  origin.Add(time.Duration(seconds / count * float64(time.Second))),
+		Value: value / count,
+	}
+}
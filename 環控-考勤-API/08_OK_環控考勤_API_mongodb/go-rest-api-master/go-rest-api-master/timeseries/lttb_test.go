@@ -0,0 +1,150 @@
+package timeseries
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testSeries 產生每秒一點的測試資料(數值為有峰谷的曲線)
+func testSeries(count int) []Point {
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	points := make([]Point, count)
+	for i := range points {
+		points[i] = Point{Time: start.Add(time.Duration(i) * time.Second), Value: math.Sin(float64(i)/3) * float64(i%7)}
+	}
+
+	return points
+}
+
+// referenceLTTB 一次讀入全部資料的 LTTB,用來比對逐點加入的結果
+func referenceLTTB(points []Point, threshold int) []Point {
+
+	if len(points) <= threshold {
+		return points
+	}
+
+	every := float64(len(points)-2) / float64(threshold-2)
+	result := []Point{points[0]}
+	previous := points[0]
+
+	for i := 0; i < threshold-2; i++ {
+
+		start := int(math.Floor(float64(i)*every)) + 1
+		end := int(math.Floor(float64(i+1)*every)) + 1
+		nextEnd := int(math.Floor(float64(i+2)*every)) + 1
+		if nextEnd > len(points) {
+			nextEnd = len(points)
+		}
+
+		previous = largestTriangle(previous, points[start:end], average(points[end:nextEnd]))
+		result = append(result, previous)
+	}
+
+	return append(result, points[len(points)-1])
+}
+
+func TestLTTBBucketBoundaries(t *testing.T) {
+
+	cases := []struct {
+		total     int
+		threshold int
+		want      []int
+	}{
+		// every = 8/3: 區間 0 為 [1,3)、區間 1 為 [3,6)、區間 2 為 [6,9)
+		{10, 5, []int{-1, 0, 0, 1, 1, 1, 2, 2, 2, 3}},
+		// every = 1: 每個區間一個點
+		{6, 6, nil},
+		// every = 5/4: 最後一個中間區間為 [4,6)
+		{7, 6, []int{-1, 0, 1, 2, 3, 3, 4}},
+		// 只有一個中間區間
+		{5, 3, []int{-1, 0, 0, 0, 1}},
+	}
+
+	for _, c := range cases {
+
+		lttb := NewLTTB(c.total, c.threshold)
+
+		// 點數不超過輸出點數時不分區間
+		if c.want == nil {
+			if lttb.every != 0 {
+				t.Errorf("NewLTTB(%d, %d) 不應分區間", c.total, c.threshold)
+			}
+			continue
+		}
+
+		var got []int
+		for index := 0; index < c.total; index++ {
+			got = append(got, lttb.bucketOf(index))
+		}
+
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("NewLTTB(%d, %d) 區間 = %v, want %v", c.total, c.threshold, got, c.want)
+		}
+	}
+}
+
+func TestLTTBMatchesReference(t *testing.T) {
+
+	cases := []struct {
+		total     int
+		threshold int
+	}{
+		{3, 3},
+		{10, 3},
+		{10, 5},
+		{100, 7},
+		{1000, 37},
+		{1001, 500},
+		{20, 2}, // 輸出點數至少為 3
+	}
+
+	for _, c := range cases {
+
+		points := testSeries(c.total)
+		lttb := NewLTTB(c.total, c.threshold)
+		for _, point := range points {
+			lttb.Add(point)
+		}
+
+		threshold := c.threshold
+		if threshold < 3 {
+			threshold = 3
+		}
+
+		got := lttb.Result()
+		want := referenceLTTB(points, threshold)
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("LTTB(%d, %d) 與一次讀入的結果不同: %d 點, want %d 點", c.total, c.threshold, len(got), len(want))
+			continue
+		}
+
+		// 第一個點與最後一個點一定保留
+		if len(got) > 0 && (!got[0].Time.Equal(points[0].Time) || !got[len(got)-1].Time.Equal(points[len(points)-1].Time)) {
+			t.Errorf("LTTB(%d, %d) 沒有保留頭尾的點", c.total, c.threshold)
+		}
+	}
+}
+
+func TestLTTBFewerPointsThanTotal(t *testing.T) {
+
+	// 筆數在計數之後才減少(ex: 保存期限清理),實際點數比 total 少
+	points := testSeries(8)
+	lttb := NewLTTB(20, 5)
+	for _, point := range points {
+		lttb.Add(point)
+	}
+
+	got := lttb.Result()
+	if len(got) == 0 || len(got) > 5 {
+		t.Fatalf("點數 = %d, want 1~5", len(got))
+	}
+
+	if !got[0].Time.Equal(points[0].Time) || !got[len(got)-1].Time.Equal(points[len(points)-1].Time) {
+		t.Errorf("沒有保留頭尾的點: %v", got)
+	}
+}